@@ -3,10 +3,12 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/nbvehbq/go-metrics-harvester/internal/agent"
 	"github.com/nbvehbq/go-metrics-harvester/internal/grpclient"
@@ -45,19 +47,9 @@ func main() {
 		cancel()
 	}()
 
-	var client agent.Publisher
-	if cfg.Protocol == string(agent.HTTPProtocol) {
-		client, err = httpclient.NewHTTPClient(cfg)
-		if err != nil {
-			log.Fatal(err, "initialize http client")
-		}
-	}
-
-	if cfg.Protocol == string(agent.GRPCProtocol) {
-		client, err = grpclient.NewGRPClient(cfg)
-		if err != nil {
-			log.Fatal(err, "initialize grpc client")
-		}
+	client, err := newPublisher(cfg)
+	if err != nil {
+		log.Fatal(err, "initialize client")
 	}
 
 	agent, err := agent.NewAgent(runner, cfg, client)
@@ -69,4 +61,77 @@ func main() {
 	if err := runner.Wait(); err != nil {
 		log.Printf("exit reason: %s \n", err)
 	}
+
+	if c, ok := client.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// newPublisher returns client of the server or fan-out publisher if several servers are configured
+func newPublisher(cfg *agent.Config) (agent.Publisher, error) {
+	destinations, err := cfg.DestinationConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(destinations) == 0 {
+		return newClient(cfg)
+	}
+
+	list := make([]agent.Destination, 0, len(destinations))
+	for _, d := range destinations {
+		dcfg := cfg.ForDestination(d)
+
+		client, err := newClient(dcfg)
+		if err != nil {
+			return nil, fmt.Errorf("destination %s: %w", d.Name, err)
+		}
+
+		dest := agent.Destination{Name: d.Name, Publisher: client}
+		if d.SpoolDir != "" {
+			dest.Spool, err = agent.NewDestinationSpool(d.Name, d.SpoolDir, cfg.SpoolMaxBytes,
+				time.Second*time.Duration(cfg.SpoolMaxAge), time.Second*time.Duration(cfg.PollInterval))
+			if err != nil {
+				return nil, fmt.Errorf("destination %s: %w", d.Name, err)
+			}
+		}
+		list = append(list, dest)
+	}
+
+	return agent.NewFanout(cfg.FanoutMode, list)
+}
+
+func newClient(cfg *agent.Config) (agent.Publisher, error) {
+	switch agent.Protocol(cfg.Protocol) {
+	case agent.GRPCProtocol:
+		return grpclient.NewGRPClient(cfg)
+	case agent.AutoProtocol:
+		return newAutoClient(cfg)
+	default:
+		return httpclient.NewHTTPClient(cfg)
+	}
+}
+
+// newAutoClient returns gRPC client falling back to HTTP
+func newAutoClient(cfg *agent.Config) (agent.Publisher, error) {
+	grpcCfg, httpCfg, err := cfg.AutoConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	grpcClient, err := grpclient.NewGRPClient(grpcCfg)
+	if err != nil {
+		return nil, err
+	}
+	httpClient, err := httpclient.NewHTTPClient(httpCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return agent.NewFallback(
+		agent.Transport{Protocol: agent.GRPCProtocol, Publisher: grpcClient},
+		agent.Transport{Protocol: agent.HTTPProtocol, Publisher: httpClient},
+		time.Second*time.Duration(cfg.ProtocolProbe),
+		time.Second*time.Duration(cfg.PollInterval),
+	), nil
 }
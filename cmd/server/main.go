@@ -76,6 +76,15 @@ func main() {
 		}
 	}
 
+	retention := time.Second * time.Duration(cfg.HistoryRetention)
+	if mem, ok := db.(*memory.Storage); ok && cfg.HistoryDepth > 0 {
+		mem.EnableHistory(cfg.HistoryDepth, retention)
+	}
+
+	if pg, ok := db.(*postgres.Storage); ok && retention > 0 {
+		pg.RunPruner(ctx, runner, retention)
+	}
+
 	service := service.NewService(db)
 	grpcServer, err := grpc.NewGrpc(ctx, runner, service, cfg)
 	if err != nil {
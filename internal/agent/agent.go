@@ -5,40 +5,80 @@ import (
 	"compress/gzip"
 	"context"
 	"fmt"
-	"math/rand"
 	"net"
-	"net/http"
-	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/nbvehbq/go-metrics-harvester/internal/agent/collector"
 	"github.com/nbvehbq/go-metrics-harvester/internal/logger"
 	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
 	"github.com/pkg/errors"
-	"github.com/shirou/gopsutil/v4/cpu"
-	"github.com/shirou/gopsutil/v4/mem"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 )
 
-type HTTPClient interface {
-	Do(req *http.Request) (*http.Response, error)
-}
+type HTTPClient = collector.HTTPClient
 
 type Publisher interface {
 	Publish(ctx context.Context, m []metric.Metric) error
 }
 
+// publisherCollectors - Publisher с собственными метриками, например очередями серверов
+type publisherCollectors interface {
+	Collectors() []collector.Collector
+}
+
 // Agent is a metrics harvester agent
 type Agent struct {
 	cfg    *Config
 	runner *errgroup.Group
 	client Publisher
 	// publicKey []byte
+	collectors *collector.Registry
+	spool      *Spool
+
+	// mu - отчеты отправляются по одному
+	mu sync.Mutex
+	// pending - части пакета, не подтвержденные сервером, отправляются повторно с теми же идентификаторами
+	pending []metric.Chunk
+	dropped droppedBatches
 }
 
 // NewAgent creates a new agent
 func NewAgent(r *errgroup.Group, cfg *Config, client Publisher) (*Agent, error) {
-	return &Agent{runner: r, cfg: cfg, client: client}, nil
+	collectors, err := newRegistry(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "collectors")
+	}
+
+	a := &Agent{runner: r, cfg: cfg, client: client, collectors: collectors}
+	a.dropped.interval = time.Second * time.Duration(cfg.PollInterval)
+	if err := collectors.Register(&a.dropped); err != nil {
+		return nil, err
+	}
+
+	if p, ok := client.(publisherCollectors); ok {
+		for _, c := range p.Collectors() {
+			if err := collectors.Register(c); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if cfg.SpoolDir != "" {
+		a.spool, err = NewSpool(cfg.SpoolDir, cfg.SpoolMaxBytes,
+			time.Second*time.Duration(cfg.SpoolMaxAge), time.Second*time.Duration(cfg.PollInterval))
+		if err != nil {
+			return nil, err
+		}
+		if err := collectors.Register(a.spool); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
 }
 
 // Run runs the agent
@@ -46,26 +86,14 @@ func (a *Agent) Run(ctx context.Context) {
 	logger.Log.Info("Agent started.")
 	metrics := metric.NewMetrics()
 
-	a.runner.Go(func() error {
-		for {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(time.Second * time.Duration(a.cfg.PollInterval)):
-				a.runner.Go(func() error {
-					if err := requestMemoryMetrics(ctx, metrics); err != nil {
-						logger.Log.Error("requestMemoryMetrics", zap.Error(err))
-					}
-					return nil
-				})
-
-				a.runner.Go(func() error {
-					requestMetrics(metrics)
-					return nil
-				})
-			}
+	for _, c := range a.collectors.List() {
+		if l, ok := c.(collector.Listener); ok {
+			a.runner.Go(func() error {
+				return l.Listen(ctx)
+			})
 		}
-	})
+		a.runCollector(ctx, c, metrics)
+	}
 
 	a.runner.Go(func() error {
 		const numJobs = 1024
@@ -96,98 +124,232 @@ func (a *Agent) Run(ctx context.Context) {
 	})
 }
 
-func floatPtr(val float64) *float64 {
-	return &val
+// PublishName - имя коллектора метрик отправки
+const PublishName = "publish"
+
+// droppedBatches - части пакетов, отклоненные сервером и отброшенные агентом
+type droppedBatches struct {
+	interval time.Duration
+	n        atomic.Int64
 }
 
-func intPtr(val int64) *int64 {
-	return &val
+func (d *droppedBatches) Add(n int64) {
+	d.n.Add(n)
 }
 
-func requestMetrics(m *metric.Metrics) {
-	var rtm runtime.MemStats
-	runtime.ReadMemStats(&rtm)
+func (d *droppedBatches) Name() string {
+	return PublishName
+}
 
-	m.Mu.Lock()
+func (d *droppedBatches) Interval() time.Duration {
+	return d.interval
+}
 
-	m.Metrics["Alloc"] = metric.Metric{ID: "Alloc", MType: metric.Gauge, Value: floatPtr(float64(rtm.Alloc))}
-	m.Metrics["BuckHashSys"] = metric.Metric{ID: "BuckHashSys", MType: metric.Gauge, Value: floatPtr(float64(rtm.BuckHashSys))}
-	m.Metrics["Frees"] = metric.Metric{ID: "Frees", MType: metric.Gauge, Value: floatPtr(float64(rtm.Frees))}
-	m.Metrics["GCCPUFraction"] = metric.Metric{ID: "GCCPUFraction", MType: metric.Gauge, Value: floatPtr(float64(rtm.GCCPUFraction))}
-	m.Metrics["GCSys"] = metric.Metric{ID: "GCSys", MType: metric.Gauge, Value: floatPtr(float64(rtm.GCSys))}
-	m.Metrics["HeapAlloc"] = metric.Metric{ID: "HeapAlloc", MType: metric.Gauge, Value: floatPtr(float64(rtm.HeapAlloc))}
-	m.Metrics["HeapIdle"] = metric.Metric{ID: "HeapIdle", MType: metric.Gauge, Value: floatPtr(float64(rtm.HeapIdle))}
-	m.Metrics["HeapInuse"] = metric.Metric{ID: "HeapInuse", MType: metric.Gauge, Value: floatPtr(float64(rtm.HeapInuse))}
-	m.Metrics["HeapObjects"] = metric.Metric{ID: "HeapObjects", MType: metric.Gauge, Value: floatPtr(float64(rtm.HeapObjects))}
-	m.Metrics["HeapReleased"] = metric.Metric{ID: "HeapReleased", MType: metric.Gauge, Value: floatPtr(float64(rtm.HeapReleased))}
-	m.Metrics["HeapSys"] = metric.Metric{ID: "HeapSys", MType: metric.Gauge, Value: floatPtr(float64(rtm.HeapSys))}
-	m.Metrics["LastGC"] = metric.Metric{ID: "LastGC", MType: metric.Gauge, Value: floatPtr(float64(rtm.LastGC))}
-	m.Metrics["Lookups"] = metric.Metric{ID: "Lookups", MType: metric.Gauge, Value: floatPtr(float64(rtm.Lookups))}
-	m.Metrics["MCacheInuse"] = metric.Metric{ID: "MCacheInuse", MType: metric.Gauge, Value: floatPtr(float64(rtm.MCacheInuse))}
-	m.Metrics["MCacheSys"] = metric.Metric{ID: "MCacheSys", MType: metric.Gauge, Value: floatPtr(float64(rtm.MCacheSys))}
-	m.Metrics["MSpanInuse"] = metric.Metric{ID: "MSpanInuse", MType: metric.Gauge, Value: floatPtr(float64(rtm.MSpanInuse))}
-	m.Metrics["MSpanSys"] = metric.Metric{ID: "MSpanSys", MType: metric.Gauge, Value: floatPtr(float64(rtm.MSpanSys))}
-	m.Metrics["Mallocs"] = metric.Metric{ID: "Mallocs", MType: metric.Gauge, Value: floatPtr(float64(rtm.Mallocs))}
-	m.Metrics["NextGC"] = metric.Metric{ID: "NextGC", MType: metric.Gauge, Value: floatPtr(float64(rtm.NextGC))}
-	m.Metrics["NumForcedGC"] = metric.Metric{ID: "NumForcedGC", MType: metric.Gauge, Value: floatPtr(float64(rtm.NumForcedGC))}
-	m.Metrics["NumGC"] = metric.Metric{ID: "NumGC", MType: metric.Gauge, Value: floatPtr(float64(rtm.NumGC))}
-	m.Metrics["OtherSys"] = metric.Metric{ID: "OtherSys", MType: metric.Gauge, Value: floatPtr(float64(rtm.OtherSys))}
-	m.Metrics["PauseTotalNs"] = metric.Metric{ID: "PauseTotalNs", MType: metric.Gauge, Value: floatPtr(float64(rtm.PauseTotalNs))}
-	m.Metrics["StackInuse"] = metric.Metric{ID: "StackInuse", MType: metric.Gauge, Value: floatPtr(float64(rtm.StackInuse))}
-	m.Metrics["StackSys"] = metric.Metric{ID: "StackSys", MType: metric.Gauge, Value: floatPtr(float64(rtm.StackSys))}
-	m.Metrics["Sys"] = metric.Metric{ID: "Sys", MType: metric.Gauge, Value: floatPtr(float64(rtm.Sys))}
-	m.Metrics["TotalAlloc"] = metric.Metric{ID: "TotalAlloc", MType: metric.Gauge, Value: floatPtr(float64(rtm.TotalAlloc))}
-
-	m.Metrics["PollCount"] = metric.Metric{ID: "PollCount", MType: metric.Counter, Delta: intPtr(1)}
-	m.Metrics["RandomValue"] = metric.Metric{ID: "RandomValue", MType: metric.Gauge, Value: floatPtr(rand.Float64())}
-
-	m.Mu.Unlock()
-
-	logger.Log.Info("Metric requested")
+// Collect returns number of chunks dropped since previous poll
+func (d *droppedBatches) Collect(_ context.Context) ([]metric.Metric, error) {
+	n := d.n.Swap(0)
+	return []metric.Metric{{ID: "PublishDropped", MType: metric.Counter, Delta: &n}}, nil
 }
 
-func requestMemoryMetrics(ctx context.Context, m *metric.Metrics) error {
+// storeMetrics puts collected metrics to the report set,
+// counter deltas are summed up until they are published
+func storeMetrics(m *metric.Metrics, list []metric.Metric) {
 	m.Mu.Lock()
 	defer m.Mu.Unlock()
 
-	v, err := mem.VirtualMemoryWithContext(ctx)
-	if err != nil {
-		return errors.Wrap(err, "memory")
-	}
-	percents, err := cpu.PercentWithContext(ctx, 0, true)
-	if err != nil {
-		return errors.Wrap(err, "cpu")
+	for _, v := range list {
+		key := v.Key()
+		old, ok := m.Metrics[key]
+		switch {
+		case ok && v.MType == metric.Counter && old.Delta != nil && v.Delta != nil:
+			sum := *old.Delta + *v.Delta
+			v.Delta = &sum
+		case ok && v.MType == metric.Histogram && old.MType == metric.Histogram:
+			metric.MergeHistogram(&old, v)
+			v = old
+		}
+		m.Metrics[key] = v
 	}
+}
+
+// commitMetrics subtracts published counter deltas and histogram observations,
+// so values collected during publishing go to the next report
+func commitMetrics(m *metric.Metrics, published []metric.Metric) {
+	m.Mu.Lock()
+	defer m.Mu.Unlock()
+
+	for _, v := range published {
+		key := v.Key()
+		cur, ok := m.Metrics[key]
+		if !ok || cur.MType != v.MType {
+			continue
+		}
+
+		switch v.MType {
+		case metric.Counter:
+			if cur.Delta == nil || v.Delta == nil {
+				continue
+			}
+
+			rest := *cur.Delta - *v.Delta
+			if rest == 0 {
+				delete(m.Metrics, key)
+				continue
+			}
+			cur.Delta = &rest
+		case metric.Histogram:
+			if !sameHistogram(cur, v) {
+				continue
+			}
 
-	m.Metrics["TotalMemory"] = metric.Metric{ID: "TotalMemory", MType: metric.Gauge, Value: floatPtr(float64(v.Total))}
-	m.Metrics["FreeMemory"] = metric.Metric{ID: "FreeMemory", MType: metric.Gauge, Value: floatPtr(float64(v.Free))}
+			count := *cur.Count - *v.Count
+			if count == 0 {
+				delete(m.Metrics, key)
+				continue
+			}
 
-	for i, p := range percents {
-		ID := fmt.Sprintf("CPUutilization%d", i+1)
-		m.Metrics[ID] = metric.Metric{ID: ID, MType: metric.Gauge, Value: floatPtr(float64(p))}
+			counts := make([]uint64, len(cur.Counts))
+			for i := range counts {
+				counts[i] = cur.Counts[i] - v.Counts[i]
+			}
+			sum := *cur.Sum - *v.Sum
+			cur.Counts, cur.Sum, cur.Count = counts, &sum, &count
+		default:
+			continue
+		}
+		m.Metrics[key] = cur
 	}
+}
 
-	return nil
+// sameHistogram reports whether published histogram is a part of current one
+func sameHistogram(cur, published metric.Metric) bool {
+	return cur.Count != nil && published.Count != nil && cur.Sum != nil && published.Sum != nil &&
+		slices.Equal(cur.Buckets, published.Buckets) && len(cur.Counts) == len(published.Counts) &&
+		*cur.Count >= *published.Count
 }
 
+// runCollector polls collector with its own interval
+func (a *Agent) runCollector(ctx context.Context, c collector.Collector, m *metric.Metrics) {
+	a.runner.Go(func() error {
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.Interval()):
+				list, err := c.Collect(ctx)
+				if err != nil {
+					logger.Log.Error("collect", zap.String("collector", c.Name()), zap.Error(err))
+					continue
+				}
+				storeMetrics(m, list)
+				logger.Log.Debug("Metric requested", zap.String("collector", c.Name()))
+			}
+		}
+	})
+}
+
+// publishMetrics sends the pending batch or, when there is none, the current report.
+// Values collected meanwhile wait for the next report, so a batch applied by server
+// but not confirmed is never sent again merged with new values under another id
 func (a *Agent) publishMetrics(ctx context.Context, m *metric.Metrics) error {
-	m.Mu.RLock()
-	defer func() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.pending) == 0 {
+		m.Mu.RLock()
+		list := make([]metric.Metric, 0, len(m.Metrics))
+		for _, v := range m.Metrics {
+			list = append(list, v)
+		}
 		m.Mu.RUnlock()
-		logger.Log.Info("Metrics published")
-	}()
 
-	list := make([]metric.Metric, 0, len(m.Metrics))
-	for _, v := range m.Metrics {
-		list = append(list, v)
+		// повторы отправки несут тот же идентификатор, сервер применит пакет один раз
+		a.pending = []metric.Chunk{{BatchID: metric.NewBatchID(), Metrics: list}}
 	}
 
-	err := a.client.Publish(ctx, list)
-	if err != nil {
-		return errors.Wrap(err, "client post")
+	var err error
+	if a.spool != nil {
+		// отложенные пакеты отправляются раньше текущего
+		if err = a.spool.Replay(ctx, a.client.Publish); err != nil {
+			err = fmt.Errorf("spool replay: %v", err)
+		}
 	}
 
-	return nil
+	failed := a.pending
+	if err == nil {
+		err = metric.PublishChunks(ctx, a.pending, a.client.Publish)
+		if err == nil {
+			commitMetrics(m, chunkMetrics(a.pending))
+			a.pending = nil
+			logger.Log.Info("Metrics published")
+			return nil
+		}
+
+		var rejected []metric.Chunk
+		var published []metric.Metric
+		failed, rejected, published = undelivered(a.pending, err)
+		// доставленные части пакета больше не отправляются
+		commitMetrics(m, published)
+
+		// отклоненные части не будут приняты и при повторе, они отбрасываются
+		if len(rejected) > 0 {
+			logger.Log.Error("publish, batch rejected and dropped",
+				zap.Int("chunks", len(rejected)), zap.Error(err))
+			a.dropped.Add(int64(len(rejected)))
+			commitMetrics(m, chunkMetrics(rejected))
+		}
+	}
+	a.pending = failed
+	if len(failed) == 0 {
+		return errors.Wrap(err, "client post, batch dropped")
+	}
+
+	// неотправленные части уходят в очередь и считаются отправленными
+	if a.spool != nil {
+		spoolErr := a.spool.PushChunks(failed)
+		if spoolErr == nil {
+			commitMetrics(m, chunkMetrics(failed))
+			a.pending = nil
+			return errors.Wrap(err, "client post, batch spooled")
+		}
+		logger.Log.Error("spool", zap.Error(spoolErr))
+	}
+
+	return errors.Wrap(err, "client post")
+}
+
+// undelivered sorts chunks by publish error: failed ones are worth sending again,
+// rejected ones are refused by server permanently
+func undelivered(chunks []metric.Chunk, err error) (failed, rejected []metric.Chunk, published []metric.Metric) {
+	var ce *metric.ChunkError
+	if !errors.As(err, &ce) {
+		if permanent(err) {
+			return nil, chunks, nil
+		}
+		return chunks, nil, nil
+	}
+
+	for i, c := range ce.Chunks {
+		switch {
+		case ce.Errs[i] == nil:
+			published = append(published, c.Metrics...)
+		case permanent(ce.Errs[i]):
+			rejected = append(rejected, c)
+		default:
+			failed = append(failed, c)
+		}
+	}
+
+	return failed, rejected, published
+}
+
+func chunkMetrics(chunks []metric.Chunk) []metric.Metric {
+	var res []metric.Metric
+	for _, c := range chunks {
+		res = append(res, c.Metrics...)
+	}
+
+	return res
 }
 
 func compress(data []byte) ([]byte, error) {
@@ -217,7 +379,6 @@ func (a *Agent) worker(ctx context.Context, jobs <-chan *metric.Metrics, results
 				return nil
 			}
 			results <- a.publishMetrics(ctx, job)
-			return nil
 		}
 	}
 }
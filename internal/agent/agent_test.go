@@ -6,85 +6,175 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/nbvehbq/go-metrics-harvester/internal/agent/collector"
 	"github.com/nbvehbq/go-metrics-harvester/internal/agent/mocks"
 	"github.com/nbvehbq/go-metrics-harvester/internal/crypto"
 	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/nbvehbq/go-metrics-harvester/pkg/retry"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/sync/errgroup"
 )
 
 func ptr[T any](v T) *T { return &v }
 
-func Test_requestMetrics(t *testing.T) {
-	type args struct {
-		m *metric.Metrics
-	}
+func Test_newRegistry(t *testing.T) {
 	tests := []struct {
-		name string
-		args args
+		name    string
+		cfg     *Config
+		want    []string
+		wantErr bool
 	}{
 		{
-			name: "request metrics",
-			args: args{m: metric.NewMetrics()},
+			name: "default collectors",
+			cfg:  &Config{PollInterval: 2, Collectors: defaultCollectors},
+			want: []string{collector.MemoryName, collector.RuntimeName},
+		},
+		{
+			name: "runtime only",
+			cfg:  &Config{PollInterval: 2, Collectors: collector.RuntimeName},
+			want: []string{collector.RuntimeName},
+		},
+		{
+			name:    "bad runtime mode",
+			cfg:     &Config{PollInterval: 2, Collectors: collector.RuntimeName, RuntimeMode: "full"},
+			wantErr: true,
+		},
+		{
+			name: "disk with patterns",
+			cfg:  &Config{PollInterval: 2, Collectors: "disk", DiskMountInclude: "/, /mnt/*"},
+			want: []string{collector.DiskName},
+		},
+		{
+			name:    "bad disk pattern",
+			cfg:     &Config{PollInterval: 2, Collectors: "disk", DiskDeviceExclude: "[a-"},
+			wantErr: true,
+		},
+		{
+			name: "net with deny list",
+			cfg:  &Config{PollInterval: 2, Collectors: "net", NetDeny: "lo,docker*"},
+			want: []string{collector.NetName},
+		},
+		{
+			name: "process",
+			cfg:  &Config{PollInterval: 2, Collectors: "process", Processes: []string{"web=name:^nginx$"}},
+			want: []string{collector.ProcessName},
+		},
+		{
+			name: "exec",
+			cfg:  &Config{PollInterval: 2, Collectors: "exec", Scripts: []string{"check:30s:5s=/bin/true"}},
+			want: []string{collector.ExecName},
+		},
+		{
+			name:    "exec with duplicate scripts",
+			cfg:     &Config{PollInterval: 2, Collectors: "exec", Scripts: []string{"check=/bin/true", "check=/bin/false"}},
+			wantErr: true,
+		},
+		{
+			name: "probe",
+			cfg:  &Config{PollInterval: 2, Collectors: "probe", Probes: []string{"site=https://example.com ok"}},
+			want: []string{collector.ProbeName},
+		},
+		{
+			name:    "probe with bad url",
+			cfg:     &Config{PollInterval: 2, Collectors: "probe", Probes: []string{"site=example.com"}},
+			wantErr: true,
+		},
+		{
+			name: "logtail",
+			cfg: &Config{PollInterval: 2, Collectors: "logtail",
+				LogRules: []string{"Errors=/var/log/app.log ERROR", `Latency:histogram:0.1,1=/var/log/app.log took (\d+)ms`}},
+			want: []string{collector.LogTailName},
+		},
+		{
+			name: "statsd",
+			cfg:  &Config{PollInterval: 2, Collectors: "statsd", StatsDAddress: "127.0.0.1:0"},
+			want: []string{collector.StatsDName},
+		},
+		{
+			name:    "statsd with bad address",
+			cfg:     &Config{PollInterval: 2, Collectors: "statsd", StatsDAddress: "127.0.0.1:http-alt-x"},
+			wantErr: true,
+		},
+		{
+			name: "push",
+			cfg:  &Config{PollInterval: 2, Collectors: "push", PushAddress: "127.0.0.1:0"},
+			want: []string{collector.PushName},
+		},
+		{
+			name:    "process without matches",
+			cfg:     &Config{PollInterval: 2, Collectors: "process"},
+			wantErr: true,
+		},
+		{
+			name: "cgroup",
+			cfg:  &Config{PollInterval: 2, Collectors: "cgroup"},
+			want: []string{collector.CgroupName},
+		},
+		{
+			name:    "unknown collector",
+			cfg:     &Config{PollInterval: 2, Collectors: "runtime,unknown"},
+			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			requestMetrics(tt.args.m)
-			assert.Contains(t, tt.args.m.Metrics, "Alloc")
-			assert.Contains(t, tt.args.m.Metrics, "BuckHashSys")
-			assert.Contains(t, tt.args.m.Metrics, "Frees")
-			assert.Contains(t, tt.args.m.Metrics, "GCCPUFraction")
-			assert.Contains(t, tt.args.m.Metrics, "GCSys")
-			assert.Contains(t, tt.args.m.Metrics, "HeapAlloc")
-			assert.Contains(t, tt.args.m.Metrics, "HeapIdle")
-			assert.Contains(t, tt.args.m.Metrics, "HeapInuse")
-			assert.Contains(t, tt.args.m.Metrics, "HeapObjects")
-			assert.Contains(t, tt.args.m.Metrics, "HeapReleased")
-			assert.Contains(t, tt.args.m.Metrics, "HeapSys")
-			assert.Contains(t, tt.args.m.Metrics, "LastGC")
-			assert.Contains(t, tt.args.m.Metrics, "Lookups")
-			assert.Contains(t, tt.args.m.Metrics, "MCacheInuse")
-			assert.Contains(t, tt.args.m.Metrics, "MCacheSys")
-			assert.Contains(t, tt.args.m.Metrics, "MSpanInuse")
-			assert.Contains(t, tt.args.m.Metrics, "MSpanSys")
-			assert.Contains(t, tt.args.m.Metrics, "Mallocs")
-			assert.Contains(t, tt.args.m.Metrics, "NextGC")
-			assert.Contains(t, tt.args.m.Metrics, "NumForcedGC")
-			assert.Contains(t, tt.args.m.Metrics, "NumGC")
-			assert.Contains(t, tt.args.m.Metrics, "OtherSys")
-			assert.Contains(t, tt.args.m.Metrics, "PauseTotalNs")
-			assert.Contains(t, tt.args.m.Metrics, "StackInuse")
-			assert.Contains(t, tt.args.m.Metrics, "StackSys")
-			assert.Contains(t, tt.args.m.Metrics, "Sys")
-			assert.Contains(t, tt.args.m.Metrics, "TotalAlloc")
+			registry, err := newRegistry(tt.cfg)
+			assert.Equal(t, tt.wantErr, err != nil)
+			if tt.wantErr {
+				return
+			}
+
+			var names []string
+			for _, c := range registry.List() {
+				names = append(names, c.Name())
+				assert.Equal(t, 2*time.Second, c.Interval())
+			}
+			assert.Equal(t, tt.want, names)
 		})
 	}
 }
 
-func Test_requestMemoryMetrics(t *testing.T) {
-	type args struct {
-		m *metric.Metrics
-	}
-	tests := []struct {
-		name string
-		args args
-	}{
-		{
-			name: "request memory metrics",
-			args: args{m: metric.NewMetrics()},
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := requestMemoryMetrics(context.Background(), tt.args.m)
-			assert.NoError(t, err)
-			assert.Contains(t, tt.args.m.Metrics, "TotalMemory")
-			assert.Contains(t, tt.args.m.Metrics, "FreeMemory")
-		})
+func Test_storeMetrics(t *testing.T) {
+	m := metric.NewMetrics()
+	storeMetrics(m, []metric.Metric{
+		{ID: "cpu", MType: metric.Gauge, Value: ptr(1.0), Labels: metric.Labels{"core": "1"}},
+		{ID: "cpu", MType: metric.Gauge, Value: ptr(2.0), Labels: metric.Labels{"core": "2"}},
+		{ID: "Alloc", MType: metric.Gauge, Value: ptr(3.0)},
+	})
+
+	assert.Len(t, m.Metrics, 3)
+	assert.Contains(t, m.Metrics, "Alloc")
+	assert.Contains(t, m.Metrics, `cpu{core="1"}`)
+
+	storeMetrics(m, []metric.Metric{{ID: "PollCount", MType: metric.Counter, Delta: ptr[int64](1)}})
+	published := []metric.Metric{m.Metrics["PollCount"]}
+	storeMetrics(m, []metric.Metric{{ID: "PollCount", MType: metric.Counter, Delta: ptr[int64](1)}})
+	assert.Equal(t, int64(2), *m.Metrics["PollCount"].Delta)
+	assert.Equal(t, int64(1), *published[0].Delta)
+
+	commitMetrics(m, published)
+	assert.Equal(t, int64(1), *m.Metrics["PollCount"].Delta)
+
+	commitMetrics(m, []metric.Metric{m.Metrics["PollCount"]})
+	assert.NotContains(t, m.Metrics, "PollCount")
+
+	hist := func(counts []uint64, sum float64, count uint64) metric.Metric {
+		return metric.Metric{ID: "Latency", MType: metric.Histogram, Buckets: []float64{1},
+			Counts: counts, Sum: ptr(sum), Count: ptr(count)}
 	}
+	storeMetrics(m, []metric.Metric{hist([]uint64{1, 0}, 0.5, 1)})
+	published = []metric.Metric{m.Metrics["Latency"]}
+	storeMetrics(m, []metric.Metric{hist([]uint64{1, 1}, 2.5, 2)})
+	assert.Equal(t, hist([]uint64{2, 1}, 3.0, 3), m.Metrics["Latency"])
+
+	commitMetrics(m, published)
+	assert.Equal(t, hist([]uint64{1, 1}, 2.5, 2), m.Metrics["Latency"])
+
+	commitMetrics(m, []metric.Metric{m.Metrics["Latency"]})
+	assert.NotContains(t, m.Metrics, "Latency")
 }
 
 func Test_commpress(t *testing.T) {
@@ -128,7 +218,11 @@ func Test_publishMetrics(t *testing.T) {
 
 	// prepare metrics
 	mt := metric.NewMetrics()
-	requestMetrics(mt)
+	rt, err := collector.NewRuntime(time.Second, collector.RuntimeModeMemStats)
+	assert.NoError(t, err)
+	list, err := rt.Collect(context.Background())
+	assert.NoError(t, err)
+	storeMetrics(mt, list)
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -152,3 +246,86 @@ func Test_publishMetrics(t *testing.T) {
 		})
 	}
 }
+
+func Test_publishPending(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mocks.NewMockPublisher(ctrl)
+
+	a := &Agent{cfg: &Config{}, runner: &errgroup.Group{}, client: client}
+	m := metric.NewMetrics()
+	one := []metric.Metric{{ID: "PollCount", MType: metric.Counter, Delta: ptr[int64](1)}}
+
+	var batchID string
+	storeMetrics(m, one)
+	client.EXPECT().Publish(gomock.Any(), one).
+		DoAndReturn(func(ctx context.Context, _ []metric.Metric) error {
+			batchID = metric.BatchID(ctx)
+			return errDown
+		})
+	assert.Error(t, a.publishMetrics(context.Background(), m))
+
+	// неподтвержденный пакет отправляется с прежним идентификатором и без новых значений
+	storeMetrics(m, one)
+	gomock.InOrder(
+		client.EXPECT().Publish(gomock.Any(), one).
+			DoAndReturn(func(ctx context.Context, _ []metric.Metric) error {
+				assert.Equal(t, batchID, metric.BatchID(ctx))
+				return nil
+			}),
+		client.EXPECT().Publish(gomock.Any(), one).
+			DoAndReturn(func(ctx context.Context, _ []metric.Metric) error {
+				assert.NotEqual(t, batchID, metric.BatchID(ctx))
+				return nil
+			}),
+	)
+	assert.NoError(t, a.publishMetrics(context.Background(), m))
+	assert.Equal(t, int64(1), *m.Metrics["PollCount"].Delta)
+	assert.NoError(t, a.publishMetrics(context.Background(), m))
+	assert.Empty(t, m.Metrics)
+}
+
+func Test_publishRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mocks.NewMockPublisher(ctrl)
+
+	a := &Agent{cfg: &Config{}, runner: &errgroup.Group{}, client: client}
+	m := metric.NewMetrics()
+	one := []metric.Metric{{ID: "PollCount", MType: metric.Counter, Delta: ptr[int64](1)}}
+
+	// отклоненный пакет не задерживает следующие
+	storeMetrics(m, one)
+	client.EXPECT().Publish(gomock.Any(), one).Return(retry.Permanent(errDown))
+	assert.ErrorIs(t, a.publishMetrics(context.Background(), m), errDown)
+	assert.Empty(t, a.pending)
+	assert.Empty(t, m.Metrics)
+
+	storeMetrics(m, one)
+	client.EXPECT().Publish(gomock.Any(), one).Return(nil)
+	assert.NoError(t, a.publishMetrics(context.Background(), m))
+
+	list, err := a.dropped.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), *list[0].Delta)
+
+	// из частично отклоненного пакета повторяются только неотклоненные части
+	storeMetrics(m, batch("one"))
+	storeMetrics(m, batch("two"))
+	client.EXPECT().Publish(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, m []metric.Metric) error {
+			chunks := metric.SplitBatch("b", m, 1, 0, nil)
+			errs := make([]error, len(chunks))
+			for i, c := range chunks {
+				errs[i] = errDown
+				if c.Metrics[0].ID == "one" {
+					errs[i] = retry.Permanent(errDown)
+				}
+			}
+			return &metric.ChunkError{Chunks: chunks, Errs: errs}
+		})
+	assert.Error(t, a.publishMetrics(context.Background(), m))
+	assert.Len(t, a.pending, 1)
+	assert.Equal(t, "two", a.pending[0].Metrics[0].ID)
+	assert.NotContains(t, m.Metrics, "one")
+}
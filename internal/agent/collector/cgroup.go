@@ -0,0 +1,182 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/pkg/errors"
+)
+
+const (
+	CgroupName = "cgroup"
+
+	DefaultCgroupPath = "/sys/fs/cgroup"
+)
+
+// cgroupCPUCounters - поля cpu.stat, которые отправляются как счетчики
+var cgroupCPUCounters = map[string]string{
+	"usage_usec":     "CgroupCPUUsageUsec",
+	"user_usec":      "CgroupCPUUserUsec",
+	"system_usec":    "CgroupCPUSystemUsec",
+	"nr_throttled":   "CgroupCPUThrottledPeriods",
+	"throttled_usec": "CgroupCPUThrottledUsec",
+}
+
+// cgroupIOCounters - поля io.stat, которые отправляются как счетчики по устройствам
+var cgroupIOCounters = map[string]string{
+	"rbytes": "CgroupIOReadBytes",
+	"wbytes": "CgroupIOWriteBytes",
+	"rios":   "CgroupIOReads",
+	"wios":   "CgroupIOWrites",
+}
+
+// Cgroup - ресурсы контейнера из файлов cgroup v2. Файлы отключенных
+// контроллеров пропускаются
+type Cgroup struct {
+	interval time.Duration
+	root     string
+
+	prev map[string]uint64 // ключ серии -> предыдущее значение счетчика
+}
+
+func NewCgroup(interval time.Duration, root string) *Cgroup {
+	return &Cgroup{interval: interval, root: root}
+}
+
+func (c *Cgroup) Name() string {
+	return CgroupName
+}
+
+func (c *Cgroup) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect returns memory and pids gauges, cpu and io counters are reported
+// as deltas starting from the second poll
+func (c *Cgroup) Collect(_ context.Context) ([]metric.Metric, error) {
+	var res []metric.Metric
+
+	for file, ID := range map[string]string{
+		"memory.current": "CgroupMemoryCurrent",
+		"memory.max":     "CgroupMemoryMax",
+		"pids.current":   "CgroupPids",
+	} {
+		v, ok, err := c.readValue(file)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			res = append(res, gauge(ID, float64(v)))
+		}
+	}
+
+	cur := make(map[string]uint64)
+
+	cpu, err := c.readFile("cpu.stat")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range cpu {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		ID, ok := cgroupCPUCounters[fields[0]]
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cpu.stat %s", fields[0])
+		}
+		cur[metric.SeriesKey(ID, nil)] = v
+		res = c.appendCounter(res, counter(ID, 0), v)
+	}
+
+	io, err := c.readFile("io.stat")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range io {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		labels := metric.Labels{"device": fields[0]}
+
+		for _, field := range fields[1:] {
+			name, value, _ := strings.Cut(field, "=")
+			ID, ok := cgroupIOCounters[name]
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "io.stat %s", field)
+			}
+			m := withLabels(counter(ID, 0), labels)
+			cur[m.Key()] = v
+			res = c.appendCounter(res, m, v)
+		}
+	}
+
+	c.prev = cur
+
+	return res, nil
+}
+
+// appendCounter appends counter with delta since previous poll
+func (c *Cgroup) appendCounter(res []metric.Metric, m metric.Metric, v uint64) []metric.Metric {
+	prev, ok := c.prev[m.Key()]
+	if !ok {
+		return res
+	}
+
+	d := delta(v, prev)
+	m.Delta = &d
+
+	return append(res, m)
+}
+
+// readValue reads single number file, "max" means no limit and is skipped
+func (c *Cgroup) readValue(name string) (uint64, bool, error) {
+	lines, err := c.readFile(name)
+	if err != nil || len(lines) == 0 || lines[0] == "max" {
+		return 0, false, err
+	}
+
+	v, err := strconv.ParseUint(lines[0], 10, 64)
+	if err != nil {
+		return 0, false, errors.Wrap(err, name)
+	}
+
+	return v, true, nil
+}
+
+// readFile returns lines of cgroup file, missing file means disabled controller
+func (c *Cgroup) readFile(name string) ([]string, error) {
+	buf, err := os.ReadFile(filepath.Join(c.root, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, name)
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, scanner.Err()
+}
@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCgroup_Collect(t *testing.T) {
+	c := NewCgroup(time.Second, "testdata/cgroup")
+
+	res, err := c.Collect(context.Background())
+	assert.NoError(t, err)
+
+	got := make(map[string]metric.Metric)
+	for _, m := range res {
+		got[m.Key()] = m
+	}
+	assert.Len(t, got, 3)
+	assert.Equal(t, 104857600.0, *got["CgroupMemoryCurrent"].Value)
+	assert.Equal(t, 536870912.0, *got["CgroupMemoryMax"].Value)
+	assert.Equal(t, 12.0, *got["CgroupPids"].Value)
+
+	c.root = "testdata/cgroup_next"
+	res, err = c.Collect(context.Background())
+	assert.NoError(t, err)
+
+	got = make(map[string]metric.Metric)
+	for _, m := range res {
+		got[m.Key()] = m
+	}
+	assert.NotContains(t, got, "CgroupMemoryMax")
+	assert.Equal(t, 14.0, *got["CgroupPids"].Value)
+	assert.Equal(t, int64(500000), *got["CgroupCPUUsageUsec"].Delta)
+	assert.Equal(t, int64(1), *got["CgroupCPUThrottledPeriods"].Delta)
+	assert.Equal(t, int64(8192), *got[`CgroupIOReadBytes{device="8:0"}`].Delta)
+	assert.Equal(t, int64(0), *got[`CgroupIOWrites{device="253:1"}`].Delta)
+}
+
+func TestCgroup_CollectMissing(t *testing.T) {
+	res, err := NewCgroup(time.Second, t.TempDir()).Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, res)
+}
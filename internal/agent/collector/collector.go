@@ -0,0 +1,122 @@
+// Package collector - источники метрик агента
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+)
+
+// Collector - независимый источник метрик со своим интервалом опроса
+type Collector interface {
+	Name() string
+	Interval() time.Duration
+	Collect(ctx context.Context) ([]metric.Metric, error)
+}
+
+// Listener - коллектор, который сам принимает метрики, Listen работает до отмены контекста
+type Listener interface {
+	Listen(ctx context.Context) error
+}
+
+// Registry - набор включенных коллекторов
+type Registry struct {
+	mu         sync.RWMutex
+	collectors map[string]Collector
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+// Register adds collector, names must be unique
+func (r *Registry) Register(c Collector) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.collectors[c.Name()]; ok {
+		return fmt.Errorf("collector %s already registered", c.Name())
+	}
+	r.collectors[c.Name()] = c
+
+	return nil
+}
+
+// Get returns collector by name
+func (r *Registry) Get(name string) (Collector, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.collectors[name]
+	return c, ok
+}
+
+// List returns registered collectors sorted by name
+func (r *Registry) List() []Collector {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	res := make([]Collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		res = append(res, c)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name() < res[j].Name() })
+
+	return res
+}
+
+func gauge(ID string, value float64) metric.Metric {
+	return metric.Metric{ID: ID, MType: metric.Gauge, Value: &value}
+}
+
+func counter(ID string, delta int64) metric.Metric {
+	return metric.Metric{ID: ID, MType: metric.Counter, Delta: &delta}
+}
+
+func withLabels(m metric.Metric, labels metric.Labels) metric.Metric {
+	m.Labels = labels
+	return m
+}
+
+// pending - метрики, принятые между опросами: счетчики суммируются,
+// histogram объединяются, gauge хранят последнее значение
+type pending map[string]metric.Metric
+
+func (p pending) add(m metric.Metric) {
+	key := m.Key()
+	old, ok := p[key]
+	switch {
+	case ok && m.MType == metric.Counter && old.MType == metric.Counter:
+		sum := *old.Delta + *m.Delta
+		m.Delta = &sum
+	case ok && m.MType == metric.Histogram && old.MType == metric.Histogram:
+		metric.MergeHistogram(&old, m)
+		m = old
+	}
+	p[key] = m
+}
+
+// drain returns accumulated metrics and forgets them
+func (p pending) drain() []metric.Metric {
+	res := make([]metric.Metric, 0, len(p))
+	for _, m := range p {
+		res = append(res, m)
+	}
+	clear(p)
+
+	return res
+}
+
+// delta - прирост монотонного счетчика, после сброса счетчика прирост равен текущему значению
+func delta(cur, prev uint64) int64 {
+	if cur < prev {
+		return int64(cur)
+	}
+
+	return int64(cur - prev)
+}
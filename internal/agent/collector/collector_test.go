@@ -0,0 +1,30 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+
+	rt, err := NewRuntime(time.Second, RuntimeModeBoth)
+	assert.NoError(t, err)
+	again, err := NewRuntime(time.Minute, RuntimeModeBoth)
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.Register(rt))
+	assert.NoError(t, r.Register(NewMemory(time.Second)))
+	assert.Error(t, r.Register(again))
+
+	c, ok := r.Get(RuntimeName)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, c.Interval())
+
+	list := r.List()
+	assert.Len(t, list, 2)
+	assert.Equal(t, MemoryName, list[0].Name())
+	assert.Equal(t, RuntimeName, list[1].Name())
+}
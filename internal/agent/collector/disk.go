@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/logger"
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/v4/disk"
+	"go.uber.org/zap"
+)
+
+const DiskName = "disk"
+
+// Disk - заполненность файловых систем и счетчики ввода-вывода устройств
+type Disk struct {
+	interval time.Duration
+	mounts   Filter
+	devices  Filter
+
+	partitions func(ctx context.Context, all bool) ([]disk.PartitionStat, error)
+	usage      func(ctx context.Context, path string) (*disk.UsageStat, error)
+	ioCounters func(ctx context.Context, names ...string) (map[string]disk.IOCountersStat, error)
+
+	prev map[string]disk.IOCountersStat
+}
+
+func NewDisk(interval time.Duration, mounts, devices Filter) *Disk {
+	return &Disk{
+		interval:   interval,
+		mounts:     mounts,
+		devices:    devices,
+		partitions: disk.PartitionsWithContext,
+		usage:      disk.UsageWithContext,
+		ioCounters: disk.IOCountersWithContext,
+	}
+}
+
+func (c *Disk) Name() string {
+	return DiskName
+}
+
+func (c *Disk) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect returns usage gauges per mountpoint and io counters per device,
+// counters are reported starting from the second poll
+func (c *Disk) Collect(ctx context.Context) ([]metric.Metric, error) {
+	parts, err := c.partitions(ctx, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "partitions")
+	}
+
+	var res []metric.Metric
+
+	seen := make(map[string]struct{}, len(parts))
+	for _, p := range parts {
+		if _, ok := seen[p.Mountpoint]; ok || !c.mounts.Match(p.Mountpoint) {
+			continue
+		}
+		seen[p.Mountpoint] = struct{}{}
+
+		u, err := c.usage(ctx, p.Mountpoint)
+		if err != nil {
+			logger.Log.Debug("disk usage", zap.String("mountpoint", p.Mountpoint), zap.Error(err))
+			continue
+		}
+
+		labels := metric.Labels{"mountpoint": p.Mountpoint}
+		res = append(res,
+			withLabels(gauge("DiskTotal", float64(u.Total)), labels),
+			withLabels(gauge("DiskUsed", float64(u.Used)), labels),
+			withLabels(gauge("DiskFree", float64(u.Free)), labels),
+			withLabels(gauge("DiskInodesUsed", float64(u.InodesUsed)), labels),
+			withLabels(gauge("DiskInodesFree", float64(u.InodesFree)), labels),
+		)
+	}
+
+	counters, err := c.ioCounters(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "io counters")
+	}
+
+	cur := make(map[string]disk.IOCountersStat, len(counters))
+	for name, st := range counters {
+		if !c.devices.Match(name) {
+			continue
+		}
+		cur[name] = st
+
+		prev, ok := c.prev[name]
+		if !ok {
+			continue
+		}
+
+		labels := metric.Labels{"device": name}
+		res = append(res,
+			withLabels(counter("DiskReadBytes", delta(st.ReadBytes, prev.ReadBytes)), labels),
+			withLabels(counter("DiskWriteBytes", delta(st.WriteBytes, prev.WriteBytes)), labels),
+			withLabels(counter("DiskReads", delta(st.ReadCount, prev.ReadCount)), labels),
+			withLabels(counter("DiskWrites", delta(st.WriteCount, prev.WriteCount)), labels),
+		)
+	}
+	c.prev = cur
+
+	return res, nil
+}
@@ -0,0 +1,53 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisk_Collect(t *testing.T) {
+	mounts, _ := NewFilter(nil, []string{"/boot"})
+	devices, _ := NewFilter([]string{"sd*"}, nil)
+
+	c := NewDisk(time.Second, mounts, devices)
+	c.partitions = func(context.Context, bool) ([]disk.PartitionStat, error) {
+		return []disk.PartitionStat{{Mountpoint: "/"}, {Mountpoint: "/boot"}, {Mountpoint: "/"}}, nil
+	}
+	c.usage = func(_ context.Context, path string) (*disk.UsageStat, error) {
+		return &disk.UsageStat{Path: path, Total: 100, Used: 40, Free: 60, InodesUsed: 3, InodesFree: 7}, nil
+	}
+
+	reads := uint64(10)
+	c.ioCounters = func(context.Context, ...string) (map[string]disk.IOCountersStat, error) {
+		reads += 5
+		return map[string]disk.IOCountersStat{
+			"sda":   {Name: "sda", ReadCount: reads, ReadBytes: reads * 512},
+			"loop0": {Name: "loop0", ReadCount: reads},
+		}, nil
+	}
+
+	res, err := c.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, res, 5)
+	for _, m := range res {
+		assert.Equal(t, metric.Labels{"mountpoint": "/"}, m.Labels)
+	}
+
+	res, err = c.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, res, 9)
+
+	got := make(map[string]metric.Metric)
+	for _, m := range res {
+		got[m.Key()] = m
+	}
+	assert.Equal(t, 60.0, *got[`DiskFree{mountpoint="/"}`].Value)
+	assert.Equal(t, int64(5), *got[`DiskReads{device="sda"}`].Delta)
+	assert.Equal(t, int64(5*512), *got[`DiskReadBytes{device="sda"}`].Delta)
+	assert.NotContains(t, got, `DiskReads{device="loop0"}`)
+}
@@ -0,0 +1,257 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/logger"
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"go.uber.org/zap"
+)
+
+const ExecName = "exec"
+
+// exitCodeFailed - код завершения скрипта, который не удалось запустить или дождаться
+const exitCodeFailed = -1
+
+// Script - внешняя команда, которая печатает метрики в stdout.
+// Интервал и таймаут по умолчанию равны интервалу коллектора
+type Script struct {
+	Name     string
+	Command  []string
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// ParseScript parses rule in form name[:interval[:timeout]]=command args,
+// command is started without shell
+func ParseScript(s string) (Script, error) {
+	head, command, ok := strings.Cut(s, "=")
+	if !ok {
+		return Script{}, fmt.Errorf("bad script %q", s)
+	}
+
+	parts := strings.Split(head, ":")
+	if parts[0] == "" || len(parts) > 3 {
+		return Script{}, fmt.Errorf("bad script %q", s)
+	}
+
+	sc := Script{Name: parts[0], Command: strings.Fields(command)}
+	if len(sc.Command) == 0 {
+		return Script{}, fmt.Errorf("bad script %q: empty command", s)
+	}
+
+	for i, dst := range []*time.Duration{&sc.Interval, &sc.Timeout} {
+		if len(parts) <= i+1 || parts[i+1] == "" {
+			continue
+		}
+		d, err := time.ParseDuration(parts[i+1])
+		if err != nil || d <= 0 {
+			return Script{}, fmt.Errorf("bad script %q: duration %q", s, parts[i+1])
+		}
+		*dst = d
+	}
+
+	return sc, nil
+}
+
+// scriptResult - итог одного запуска скрипта
+type scriptResult struct {
+	metrics  []metric.Metric
+	exitCode int
+	duration time.Duration
+}
+
+// Exec - метрики внешних скриптов. Коллектор опрашивается со своим интервалом
+// и на каждом опросе параллельно запускает скрипты, чей интервал истек
+type Exec struct {
+	interval time.Duration
+	scripts  []Script
+
+	run func(ctx context.Context, sc Script) scriptResult
+	now func() time.Time
+
+	next map[string]time.Time
+}
+
+func NewExec(interval time.Duration, scripts []Script) *Exec {
+	return &Exec{
+		interval: interval,
+		scripts:  scripts,
+		run:      runScript,
+		now:      time.Now,
+		next:     make(map[string]time.Time, len(scripts)),
+	}
+}
+
+func (c *Exec) Name() string {
+	return ExecName
+}
+
+func (c *Exec) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect runs due scripts, script failures are logged and reported
+// via ScriptExitCode, they never fail the collector
+func (c *Exec) Collect(ctx context.Context) ([]metric.Metric, error) {
+	now := c.now()
+
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		res []metric.Metric
+	)
+
+	for _, sc := range c.scripts {
+		if now.Before(c.next[sc.Name]) {
+			continue
+		}
+		c.next[sc.Name] = now.Add(c.scriptInterval(sc))
+
+		if sc.Timeout == 0 {
+			sc.Timeout = c.interval
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			r := c.run(ctx, sc)
+			labels := metric.Labels{"script": sc.Name}
+
+			mu.Lock()
+			defer mu.Unlock()
+			res = append(res, r.metrics...)
+			res = append(res,
+				withLabels(gauge("ScriptExitCode", float64(r.exitCode)), labels),
+				withLabels(gauge("ScriptDuration", r.duration.Seconds()), labels),
+			)
+		}()
+	}
+	wg.Wait()
+
+	return res, nil
+}
+
+func (c *Exec) scriptInterval(sc Script) time.Duration {
+	if sc.Interval > 0 {
+		return sc.Interval
+	}
+	return c.interval
+}
+
+func runScript(ctx context.Context, sc Script) scriptResult {
+	ctx, cancel := context.WithTimeout(ctx, sc.Timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, sc.Command[0], sc.Command[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// потомки скрипта могут держать stdout открытым после его завершения
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	res := scriptResult{duration: time.Since(start)}
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		logger.Log.Warn("script timeout", zap.String("script", sc.Name), zap.Duration("timeout", sc.Timeout))
+		res.exitCode = exitCodeFailed
+		return res
+	case errors.As(err, &exitErr):
+		logger.Log.Warn("script failed", zap.String("script", sc.Name),
+			zap.Int("code", exitErr.ExitCode()), zap.String("stderr", stderr.String()))
+		res.exitCode = exitErr.ExitCode()
+	case err != nil:
+		logger.Log.Warn("script failed", zap.String("script", sc.Name), zap.Error(err))
+		res.exitCode = exitCodeFailed
+		return res
+	}
+
+	list, err := parseScriptOutput(stdout.Bytes())
+	if err != nil {
+		logger.Log.Warn("script output", zap.String("script", sc.Name), zap.Error(err))
+	}
+	res.metrics = list
+
+	return res
+}
+
+// parseScriptOutput parses JSON array of metrics or lines in form "name type value",
+// empty lines and lines starting with # are skipped
+func parseScriptOutput(out []byte) ([]metric.Metric, error) {
+	out = bytes.TrimSpace(out)
+	if bytes.HasPrefix(out, []byte("[")) {
+		return parseScriptJSON(out)
+	}
+
+	var res []metric.Metric
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		m, err := parseScriptLine(line)
+		if err != nil {
+			return res, fmt.Errorf("line %d: %w", n, err)
+		}
+		res = append(res, m)
+	}
+
+	return res, scanner.Err()
+}
+
+func parseScriptLine(line string) (metric.Metric, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return metric.Metric{}, fmt.Errorf("want name type value, got %q", line)
+	}
+
+	ID, mtype, value := fields[0], fields[1], fields[2]
+	switch mtype {
+	case metric.Gauge:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return metric.Metric{}, metric.ErrMetricBadValue
+		}
+		return gauge(ID, v), nil
+	case metric.Counter:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return metric.Metric{}, metric.ErrMetricBadValue
+		}
+		return counter(ID, v), nil
+	default:
+		return metric.Metric{}, metric.ErrMetricBadType
+	}
+}
+
+func parseScriptJSON(out []byte) ([]metric.Metric, error) {
+	var list []metric.Metric
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, err
+	}
+
+	for _, m := range list {
+		if err := m.Validate(); err != nil {
+			return nil, fmt.Errorf("metric %q: %w", m.ID, err)
+		}
+	}
+
+	return list, nil
+}
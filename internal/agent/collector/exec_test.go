@@ -0,0 +1,191 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScript(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Script
+		wantErr bool
+	}{
+		{
+			value: "backup=/opt/check_backup.sh --json",
+			want:  Script{Name: "backup", Command: []string{"/opt/check_backup.sh", "--json"}},
+		},
+		{
+			value: "queue:1m:10s=/opt/queue.sh",
+			want:  Script{Name: "queue", Command: []string{"/opt/queue.sh"}, Interval: time.Minute, Timeout: 10 * time.Second},
+		},
+		{
+			value: "queue::10s=/opt/queue.sh",
+			want:  Script{Name: "queue", Command: []string{"/opt/queue.sh"}, Timeout: 10 * time.Second},
+		},
+		{value: "queue=", wantErr: true},
+		{value: "=/opt/queue.sh", wantErr: true},
+		{value: "/opt/queue.sh", wantErr: true},
+		{value: "queue:often=/opt/queue.sh", wantErr: true},
+		{value: "queue:1m:1s:1s=/opt/queue.sh", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseScript(tt.value)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_parseScriptOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    []metric.Metric
+		wantErr bool
+	}{
+		{
+			name: "lines",
+			out:  "# queue stats\nQueueSize gauge 12.5\n\nQueueProcessed counter 3\n",
+			want: []metric.Metric{gauge("QueueSize", 12.5), counter("QueueProcessed", 3)},
+		},
+		{
+			name: "json",
+			out:  ` [{"id":"QueueSize","type":"gauge","value":1,"labels":{"queue":"mail"}}]`,
+			want: []metric.Metric{withLabels(gauge("QueueSize", 1), metric.Labels{"queue": "mail"})},
+		},
+		{
+			name:    "bad line keeps parsed metrics",
+			out:     "QueueSize gauge 1\nQueueSize gauge\n",
+			want:    []metric.Metric{gauge("QueueSize", 1)},
+			wantErr: true,
+		},
+		{
+			name:    "bad counter",
+			out:     "QueueProcessed counter 1.5",
+			wantErr: true,
+		},
+		{
+			name:    "json without value",
+			out:     `[{"id":"QueueSize","type":"gauge"}]`,
+			wantErr: true,
+		},
+		{
+			name: "empty",
+			out:  "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseScriptOutput([]byte(tt.out))
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "check.sh")
+	assert.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755))
+
+	return path
+}
+
+func Test_runScript(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		timeout  time.Duration
+		wantCode int
+		wantIDs  []string
+	}{
+		{
+			name:    "success",
+			body:    "echo 'Answer gauge 42'\n",
+			timeout: time.Second,
+			wantIDs: []string{"Answer"},
+		},
+		{
+			name:     "exit code",
+			body:     "echo 'Answer gauge 42'\nexit 2\n",
+			timeout:  time.Second,
+			wantCode: 2,
+			wantIDs:  []string{"Answer"},
+		},
+		{
+			name:     "timeout",
+			body:     "sleep 5\necho 'Answer gauge 42'\n",
+			timeout:  50 * time.Millisecond,
+			wantCode: exitCodeFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := Script{Name: "check", Command: []string{writeScript(t, tt.body)}, Timeout: tt.timeout}
+
+			r := runScript(context.Background(), sc)
+			assert.Equal(t, tt.wantCode, r.exitCode)
+			assert.Less(t, r.duration, 3*time.Second)
+
+			var got []string
+			for _, m := range r.metrics {
+				got = append(got, m.ID)
+			}
+			assert.Equal(t, tt.wantIDs, got)
+		})
+	}
+}
+
+func Test_runScriptNotFound(t *testing.T) {
+	sc := Script{Name: "check", Command: []string{filepath.Join(t.TempDir(), "missing")}, Timeout: time.Second}
+
+	r := runScript(context.Background(), sc)
+	assert.Equal(t, exitCodeFailed, r.exitCode)
+	assert.Empty(t, r.metrics)
+}
+
+func TestExec_Collect(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	var mu sync.Mutex
+	runs := make(map[string]int)
+
+	c := NewExec(time.Second, []Script{
+		{Name: "fast", Command: []string{"fast"}},
+		{Name: "slow", Command: []string{"slow"}, Interval: time.Minute},
+	})
+	c.now = func() time.Time { return now }
+	c.run = func(_ context.Context, sc Script) scriptResult {
+		mu.Lock()
+		runs[sc.Name]++
+		mu.Unlock()
+		assert.Equal(t, time.Second, sc.Timeout)
+		return scriptResult{metrics: []metric.Metric{gauge(sc.Name, 1)}, duration: time.Millisecond}
+	}
+
+	list, err := c.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, list, 6)
+
+	now = now.Add(time.Second)
+	list, err = c.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, list, 3)
+	assert.Equal(t, map[string]int{"fast": 2, "slow": 1}, runs)
+
+	keys := make(map[string]struct{})
+	for _, m := range list {
+		keys[m.Key()] = struct{}{}
+	}
+	assert.Contains(t, keys, `ScriptExitCode{script="fast"}`)
+	assert.Contains(t, keys, `ScriptDuration{script="fast"}`)
+}
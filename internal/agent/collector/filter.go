@@ -0,0 +1,44 @@
+package collector
+
+import (
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// Filter - шаблоны filepath.Match для отбора имен. Пустой include пропускает все,
+// exclude применяется после include
+type Filter struct {
+	include []string
+	exclude []string
+}
+
+// NewFilter validates patterns and creates filter
+func NewFilter(include, exclude []string) (Filter, error) {
+	for _, p := range append(append([]string{}, include...), exclude...) {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return Filter{}, errors.Wrapf(err, "pattern %q", p)
+		}
+	}
+
+	return Filter{include: include, exclude: exclude}, nil
+}
+
+// Match reports whether name passes the filter
+func (f Filter) Match(name string) bool {
+	if len(f.include) > 0 && !matchAny(f.include, name) {
+		return false
+	}
+
+	return !matchAny(f.exclude, name)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,33 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		value   string
+		want    bool
+	}{
+		{name: "empty", value: "/", want: true},
+		{name: "included", include: []string{"/", "/mnt/*"}, value: "/mnt/data", want: true},
+		{name: "not included", include: []string{"/mnt/*"}, value: "/boot", want: false},
+		{name: "excluded", exclude: []string{"loop*"}, value: "loop0", want: false},
+		{name: "included and excluded", include: []string{"sd*"}, exclude: []string{"sdb"}, value: "sdb", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFilter(tt.include, tt.exclude)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, f.Match(tt.value))
+		})
+	}
+
+	_, err := NewFilter([]string{"[a-"}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,342 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/logger"
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const LogTailName = "logtail"
+
+// тип значения, извлекаемого из строки лога
+const (
+	LogValueNone      = ""
+	LogValueGauge     = metric.Gauge
+	LogValueHistogram = metric.Histogram
+)
+
+// logReadLimit - сколько байт файла читается за один опрос, остаток дочитывается на следующем
+const logReadLimit = 16 << 20
+
+var defaultLogBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// LogRule - правило подсчета строк лога. Если Kind задан, число из группы value
+// (или первой группы) регулярного выражения отправляется как gauge или histogram
+type LogRule struct {
+	Name    string
+	Path    string
+	Regex   *regexp.Regexp
+	Kind    string
+	Buckets []float64
+}
+
+// ParseLogRule parses rule in form name[:kind[:buckets]]=path regexp,
+// kind is gauge or histogram, buckets are comma separated upper bounds
+func ParseLogRule(s string) (LogRule, error) {
+	head, rule, ok := strings.Cut(s, "=")
+	if !ok {
+		return LogRule{}, fmt.Errorf("bad log rule %q", s)
+	}
+
+	parts := strings.SplitN(head, ":", 3)
+	path, pattern, _ := strings.Cut(strings.TrimSpace(rule), " ")
+	pattern = strings.TrimSpace(pattern)
+	if parts[0] == "" || path == "" || pattern == "" {
+		return LogRule{}, fmt.Errorf("bad log rule %q", s)
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return LogRule{}, errors.Wrapf(err, "log rule %q", s)
+	}
+
+	r := LogRule{Name: parts[0], Path: path, Regex: re}
+	if len(parts) > 1 {
+		r.Kind = parts[1]
+	}
+
+	switch r.Kind {
+	case LogValueNone:
+		return r, nil
+	case LogValueGauge:
+		if len(parts) > 2 {
+			return LogRule{}, fmt.Errorf("bad log rule %q: buckets for gauge", s)
+		}
+	case LogValueHistogram:
+		r.Buckets = defaultLogBuckets
+		if len(parts) > 2 {
+			if r.Buckets, err = parseBuckets(parts[2]); err != nil {
+				return LogRule{}, fmt.Errorf("bad log rule %q: %w", s, err)
+			}
+		}
+	default:
+		return LogRule{}, fmt.Errorf("unknown log rule kind %q", r.Kind)
+	}
+
+	if re.NumSubexp() == 0 {
+		return LogRule{}, fmt.Errorf("bad log rule %q: no capture group", s)
+	}
+
+	return r, nil
+}
+
+func parseBuckets(s string) ([]float64, error) {
+	var res []float64
+	for _, v := range strings.Split(s, ",") {
+		b, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || math.IsNaN(b) || math.IsInf(b, 0) || (len(res) > 0 && b <= res[len(res)-1]) {
+			return nil, fmt.Errorf("bad buckets %q", s)
+		}
+		res = append(res, b)
+	}
+
+	return res, nil
+}
+
+// value returns number captured by group value or by the first group,
+// NaN and infinities are skipped: server does not accept them
+func (r LogRule) value(match []string) (float64, bool) {
+	idx := r.Regex.SubexpIndex("value")
+	if idx < 0 {
+		idx = 1
+	}
+
+	v, err := strconv.ParseFloat(match[idx], 64)
+	return v, err == nil && !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// logState - накопленное с прошлого опроса по правилу
+type logState struct {
+	count  int64
+	last   *float64
+	counts []uint64
+	sum    float64
+	total  uint64
+}
+
+func (s *logState) observe(r LogRule, v float64) {
+	switch r.Kind {
+	case LogValueGauge:
+		s.last = &v
+	case LogValueHistogram:
+		if s.counts == nil {
+			s.counts = make([]uint64, len(r.Buckets)+1)
+		}
+		i, _ := slices.BinarySearch(r.Buckets, v)
+		s.counts[i]++
+		s.sum += v
+		s.total++
+	}
+}
+
+func (s *logState) metrics(r LogRule) []metric.Metric {
+	res := []metric.Metric{counter(r.Name+".Count", s.count)}
+
+	switch {
+	case s.last != nil:
+		res = append(res, gauge(r.Name+".Value", *s.last))
+	case s.total > 0:
+		sum, total := s.sum, s.total
+		res = append(res, metric.Metric{
+			ID:      r.Name + ".Value",
+			MType:   metric.Histogram,
+			Buckets: r.Buckets,
+			Counts:  s.counts,
+			Sum:     &sum,
+			Count:   &total,
+		})
+	}
+
+	return res
+}
+
+// tailFile - читаемый файл, переживает ротацию (переименование) и усечение.
+// Усечение замечается, только если к опросу файл стал короче прочитанного
+type tailFile struct {
+	path    string
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	limit   int64 // сколько байт читается за один вызов lines
+	partial []byte
+	// seen - файл уже открывался, новый файл после ротации читается с начала
+	seen bool
+}
+
+// lines returns complete lines appended since previous call
+func (t *tailFile) lines() ([]string, error) {
+	if t.file == nil {
+		if err := t.open(); err != nil {
+			return nil, err
+		}
+		if t.file == nil {
+			return nil, nil
+		}
+	}
+
+	info, statErr := os.Stat(t.path)
+	if statErr == nil && os.SameFile(info, t.info) && info.Size() < t.offset {
+		// файл усечен, читаем заново
+		t.offset, t.partial = 0, nil
+	}
+
+	buf, err := t.read()
+	if err != nil {
+		return nil, err
+	}
+
+	if statErr == nil && !os.SameFile(info, t.info) {
+		// файл ротирован: старый дочитывается до конца, только потом читается новый
+		cur, err := t.file.Stat()
+		if err != nil {
+			return nil, errors.Wrapf(err, "stat %s", t.path)
+		}
+		if t.offset < cur.Size() {
+			return t.split(buf), nil
+		}
+
+		// незавершенная строка старого файла уже не будет дописана
+		res := t.split(buf)
+		if len(t.partial) > 0 {
+			res = append(res, string(t.partial))
+		}
+		t.file.Close()
+		t.file = nil
+		if err := t.open(); err != nil {
+			return nil, err
+		}
+		if t.file != nil {
+			next, err := t.read()
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, t.split(next)...)
+		}
+
+		return res, nil
+	}
+
+	return t.split(buf), nil
+}
+
+func (t *tailFile) open() error {
+	f, err := os.Open(t.path)
+	if errors.Is(err, os.ErrNotExist) {
+		// файл может появиться позже
+		t.seen = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	t.file, t.info, t.offset, t.partial = f, info, 0, nil
+	if !t.seen {
+		// при запуске агента старые строки не считаются
+		t.offset = info.Size()
+	}
+	t.seen = true
+
+	return nil
+}
+
+func (t *tailFile) read() ([]byte, error) {
+	buf, err := io.ReadAll(io.NewSectionReader(t.file, t.offset, t.limit))
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", t.path)
+	}
+	t.offset += int64(len(buf))
+
+	return buf, nil
+}
+
+func (t *tailFile) split(buf []byte) []string {
+	buf = append(t.partial, buf...)
+
+	end := bytes.LastIndexByte(buf, '\n')
+	if end < 0 {
+		t.partial = buf
+		return nil
+	}
+	t.partial = slices.Clone(buf[end+1:])
+
+	return strings.Split(string(buf[:end]), "\n")
+}
+
+// LogTail - счетчики строк лог-файлов, совпавших с правилами
+type LogTail struct {
+	interval time.Duration
+	rules    []LogRule
+	files    map[string]*tailFile
+}
+
+func NewLogTail(interval time.Duration, rules []LogRule) *LogTail {
+	files := make(map[string]*tailFile)
+	for _, r := range rules {
+		files[r.Path] = &tailFile{path: r.Path, limit: logReadLimit}
+	}
+
+	return &LogTail{interval: interval, rules: rules, files: files}
+}
+
+func (c *LogTail) Name() string {
+	return LogTailName
+}
+
+func (c *LogTail) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect reads lines appended since previous poll, the first poll starts at the end of files
+func (c *LogTail) Collect(_ context.Context) ([]metric.Metric, error) {
+	lines := make(map[string][]string, len(c.files))
+	for path, f := range c.files {
+		list, err := f.lines()
+		if err != nil {
+			logger.Log.Warn("log tail", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		lines[path] = list
+	}
+
+	res := make([]metric.Metric, 0, len(c.rules)*2)
+	for _, r := range c.rules {
+		var s logState
+		for _, line := range lines[r.Path] {
+			match := r.Regex.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			s.count++
+
+			if r.Kind == LogValueNone {
+				continue
+			}
+			if v, ok := r.value(match); ok {
+				s.observe(r, v)
+			}
+		}
+		res = append(res, s.metrics(r)...)
+	}
+
+	return res, nil
+}
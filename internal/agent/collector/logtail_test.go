@@ -0,0 +1,204 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLogRule(t *testing.T) {
+	tests := []struct {
+		value       string
+		wantKind    string
+		wantBuckets []float64
+		wantErr     bool
+	}{
+		{value: "Errors=/var/log/app.log level=error"},
+		{value: `Queue:gauge=/var/log/app.log queue=(\d+)`, wantKind: LogValueGauge},
+		{value: `Latency:histogram=/var/log/app.log took (?P<value>[\d.]+)s`, wantKind: LogValueHistogram, wantBuckets: defaultLogBuckets},
+		{value: `Latency:histogram:0.1,1,10=/var/log/app.log took ([\d.]+)s`, wantKind: LogValueHistogram, wantBuckets: []float64{0.1, 1, 10}},
+		{value: `Latency:histogram:1,0.1=/var/log/app.log took ([\d.]+)s`, wantErr: true},
+		{value: `Latency:histogram:1,+Inf=/var/log/app.log took ([\d.]+)s`, wantErr: true},
+		{value: `Latency:histogram:NaN=/var/log/app.log took ([\d.]+)s`, wantErr: true},
+		{value: `Queue:gauge:1=/var/log/app.log queue=(\d+)`, wantErr: true},
+		{value: "Queue:gauge=/var/log/app.log queue", wantErr: true},
+		{value: "Queue:sum=/var/log/app.log queue=(\\d+)", wantErr: true},
+		{value: "Errors=/var/log/app.log", wantErr: true},
+		{value: "Errors=/var/log/app.log (", wantErr: true},
+		{value: "=/var/log/app.log error", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseLogRule(tt.value)
+			assert.Equal(t, tt.wantErr, err != nil)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, "/var/log/app.log", got.Path)
+			assert.Equal(t, tt.wantKind, got.Kind)
+			assert.Equal(t, tt.wantBuckets, got.Buckets)
+		})
+	}
+}
+
+func appendLog(t *testing.T, path, lines string) {
+	t.Helper()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	assert.NoError(t, err)
+	_, err = f.WriteString(lines)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+}
+
+func collectLog(t *testing.T, c *LogTail) map[string]metric.Metric {
+	t.Helper()
+
+	list, err := c.Collect(context.Background())
+	assert.NoError(t, err)
+
+	res := make(map[string]metric.Metric, len(list))
+	for _, m := range list {
+		assert.NoError(t, m.Validate())
+		res[m.ID] = m
+	}
+
+	return res
+}
+
+func mustLogRule(t *testing.T, s string) LogRule {
+	t.Helper()
+
+	r, err := ParseLogRule(s)
+	assert.NoError(t, err)
+
+	return r
+}
+
+func TestLogTail_Collect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendLog(t, path, "ERROR old line\n")
+
+	c := NewLogTail(time.Second, []LogRule{
+		mustLogRule(t, "Errors="+path+" ERROR"),
+		mustLogRule(t, "Queue:gauge="+path+` queue=(\d+)`),
+		mustLogRule(t, "Latency:histogram:0.1,1="+path+` took (?P<value>[\d.]+)s`),
+	})
+
+	// старые строки не считаются
+	got := collectLog(t, c)
+	assert.Equal(t, int64(0), *got["Errors.Count"].Delta)
+	assert.NotContains(t, got, "Queue.Value")
+	assert.NotContains(t, got, "Latency.Value")
+
+	appendLog(t, path, "ERROR one\nINFO queue=5\nINFO queue=7 took 0.05s\nERROR took 2s\nERROR not finished")
+
+	got = collectLog(t, c)
+	assert.Equal(t, int64(2), *got["Errors.Count"].Delta)
+	assert.Equal(t, 7.0, *got["Queue.Value"].Value)
+	assert.Equal(t, []uint64{1, 0, 1}, got["Latency.Value"].Counts)
+	assert.Equal(t, uint64(2), *got["Latency.Value"].Count)
+	assert.InDelta(t, 2.05, *got["Latency.Value"].Sum, 1e-9)
+
+	// дописанная строка считается целиком
+	appendLog(t, path, " yet\n")
+	got = collectLog(t, c)
+	assert.Equal(t, int64(1), *got["Errors.Count"].Delta)
+}
+
+func TestLogTail_NonFinite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendLog(t, path, "")
+
+	c := NewLogTail(time.Second, []LogRule{
+		mustLogRule(t, "Queue:gauge="+path+` queue=(\S+)`),
+		mustLogRule(t, "Latency:histogram:0.1,1="+path+` took (?P<value>\S+)s`),
+	})
+	collectLog(t, c)
+
+	// NaN и бесконечности не отправляются, строки при этом считаются
+	appendLog(t, path, "queue=NaN took NaNs\nqueue=+Inf took Infs\nqueue=3 took 0.5s\nqueue=-Inf\n")
+	got := collectLog(t, c)
+	assert.Equal(t, int64(4), *got["Queue.Count"].Delta)
+	assert.Equal(t, 3.0, *got["Queue.Value"].Value)
+	assert.Equal(t, uint64(1), *got["Latency.Value"].Count)
+	assert.Equal(t, 0.5, *got["Latency.Value"].Sum)
+}
+
+func TestLogTail_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendLog(t, path, "")
+
+	c := NewLogTail(time.Second, []LogRule{mustLogRule(t, "Errors="+path+" ERROR")})
+	collectLog(t, c)
+
+	// строки, дописанные перед ротацией, не теряются
+	appendLog(t, path, "ERROR before rotation\n")
+	assert.NoError(t, os.Rename(path, path+".1"))
+	appendLog(t, path, "ERROR after rotation\nERROR again\n")
+
+	got := collectLog(t, c)
+	assert.Equal(t, int64(3), *got["Errors.Count"].Delta)
+
+	// ротация без нового файла
+	assert.NoError(t, os.Rename(path, path+".2"))
+	got = collectLog(t, c)
+	assert.Equal(t, int64(0), *got["Errors.Count"].Delta)
+
+	appendLog(t, path, "ERROR new file\n")
+	got = collectLog(t, c)
+	assert.Equal(t, int64(1), *got["Errors.Count"].Delta)
+}
+
+func TestLogTail_RotationLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendLog(t, path, "")
+
+	c := NewLogTail(time.Second, []LogRule{mustLogRule(t, "Errors="+path+" ERROR")})
+	c.files[path].limit = 16
+	collectLog(t, c)
+
+	// старый файл больше лимита чтения дочитывается за несколько опросов до перехода на новый
+	appendLog(t, path, "ERROR one\nERROR two\nERROR three\n")
+	assert.NoError(t, os.Rename(path, path+".1"))
+	appendLog(t, path, "ERROR new\n")
+
+	var total int64
+	for range 4 {
+		total += *collectLog(t, c)["Errors.Count"].Delta
+	}
+	assert.Equal(t, int64(4), total)
+}
+
+func TestLogTail_Truncation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendLog(t, path, "INFO old\nINFO old\nINFO old\n")
+
+	c := NewLogTail(time.Second, []LogRule{mustLogRule(t, "Errors="+path+" ERROR")})
+	collectLog(t, c)
+
+	assert.NoError(t, os.Truncate(path, 0))
+	appendLog(t, path, "ERROR after truncate\n")
+
+	got := collectLog(t, c)
+	assert.Equal(t, int64(1), *got["Errors.Count"].Delta)
+}
+
+func TestLogTail_MissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	c := NewLogTail(time.Second, []LogRule{mustLogRule(t, "Errors="+path+" ERROR")})
+	got := collectLog(t, c)
+	assert.Equal(t, int64(0), *got["Errors.Count"].Delta)
+
+	// появившийся позже файл читается с начала
+	appendLog(t, path, "ERROR first\n")
+	got = collectLog(t, c)
+	assert.Equal(t, int64(1), *got["Errors.Count"].Delta)
+}
@@ -0,0 +1,54 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/mem"
+)
+
+const MemoryName = "memory"
+
+// Memory - объем памяти и загрузка процессоров системы
+type Memory struct {
+	interval time.Duration
+}
+
+func NewMemory(interval time.Duration) *Memory {
+	return &Memory{interval: interval}
+}
+
+func (c *Memory) Name() string {
+	return MemoryName
+}
+
+func (c *Memory) Interval() time.Duration {
+	return c.interval
+}
+
+func (c *Memory) Collect(ctx context.Context) ([]metric.Metric, error) {
+	v, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "memory")
+	}
+	percents, err := cpu.PercentWithContext(ctx, 0, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "cpu")
+	}
+
+	res := make([]metric.Metric, 0, len(percents)+2)
+	res = append(res,
+		gauge("TotalMemory", float64(v.Total)),
+		gauge("FreeMemory", float64(v.Free)),
+	)
+
+	for i, p := range percents {
+		res = append(res, gauge(fmt.Sprintf("CPUutilization%d", i+1), p))
+	}
+
+	return res, nil
+}
@@ -0,0 +1,15 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory_Collect(t *testing.T) {
+	got := ids(t, NewMemory(time.Second))
+
+	assert.Contains(t, got, "TotalMemory")
+	assert.Contains(t, got, "FreeMemory")
+}
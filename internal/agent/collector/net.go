@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/v4/net"
+)
+
+const NetName = "net"
+
+// tcpStates - состояния TCP, которые отправляются всегда, даже с нулевым числом соединений
+var tcpStates = []string{
+	"ESTABLISHED", "SYN_SENT", "SYN_RECV", "FIN_WAIT1", "FIN_WAIT2", "TIME_WAIT",
+	"CLOSE", "CLOSE_WAIT", "LAST_ACK", "LISTEN", "CLOSING",
+}
+
+// Net - счетчики сетевых интерфейсов и число TCP соединений по состояниям
+type Net struct {
+	interval   time.Duration
+	interfaces Filter
+
+	ioCounters  func(ctx context.Context, pernic bool) ([]net.IOCountersStat, error)
+	connections func(ctx context.Context, kind string) ([]net.ConnectionStat, error)
+
+	prev map[string]net.IOCountersStat
+}
+
+func NewNet(interval time.Duration, interfaces Filter) *Net {
+	return &Net{
+		interval:    interval,
+		interfaces:  interfaces,
+		ioCounters:  net.IOCountersWithContext,
+		connections: net.ConnectionsWithoutUidsWithContext,
+	}
+}
+
+func (c *Net) Name() string {
+	return NetName
+}
+
+func (c *Net) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect returns interface counters as deltas since previous poll and TCP state gauges,
+// counters are reported starting from the second poll
+func (c *Net) Collect(ctx context.Context) ([]metric.Metric, error) {
+	counters, err := c.ioCounters(ctx, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "io counters")
+	}
+
+	var res []metric.Metric
+
+	cur := make(map[string]net.IOCountersStat, len(counters))
+	for _, st := range counters {
+		if !c.interfaces.Match(st.Name) {
+			continue
+		}
+		cur[st.Name] = st
+
+		prev, ok := c.prev[st.Name]
+		if !ok {
+			continue
+		}
+
+		labels := metric.Labels{"interface": st.Name}
+		res = append(res,
+			withLabels(counter("NetBytesRecv", delta(st.BytesRecv, prev.BytesRecv)), labels),
+			withLabels(counter("NetBytesSent", delta(st.BytesSent, prev.BytesSent)), labels),
+			withLabels(counter("NetPacketsRecv", delta(st.PacketsRecv, prev.PacketsRecv)), labels),
+			withLabels(counter("NetPacketsSent", delta(st.PacketsSent, prev.PacketsSent)), labels),
+			withLabels(counter("NetErrIn", delta(st.Errin, prev.Errin)), labels),
+			withLabels(counter("NetErrOut", delta(st.Errout, prev.Errout)), labels),
+			withLabels(counter("NetDropIn", delta(st.Dropin, prev.Dropin)), labels),
+			withLabels(counter("NetDropOut", delta(st.Dropout, prev.Dropout)), labels),
+		)
+	}
+	c.prev = cur
+
+	conns, err := c.connections(ctx, "tcp")
+	if err != nil {
+		return nil, errors.Wrap(err, "connections")
+	}
+
+	states := make(map[string]int, len(tcpStates))
+	for _, s := range tcpStates {
+		states[s] = 0
+	}
+	for _, conn := range conns {
+		states[conn.Status]++
+	}
+
+	for s, n := range states {
+		res = append(res, withLabels(gauge("TCPConnections", float64(n)), metric.Labels{"state": s}))
+	}
+
+	return res, nil
+}
@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/shirou/gopsutil/v4/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNet_Collect(t *testing.T) {
+	interfaces, _ := NewFilter(nil, []string{"lo"})
+
+	c := NewNet(time.Second, interfaces)
+
+	recv := uint64(1000)
+	c.ioCounters = func(context.Context, bool) ([]net.IOCountersStat, error) {
+		recv += 500
+		return []net.IOCountersStat{
+			{Name: "eth0", BytesRecv: recv, PacketsRecv: recv / 100},
+			{Name: "lo", BytesRecv: recv},
+		}, nil
+	}
+	c.connections = func(context.Context, string) ([]net.ConnectionStat, error) {
+		return []net.ConnectionStat{{Status: "ESTABLISHED"}, {Status: "ESTABLISHED"}, {Status: "LISTEN"}}, nil
+	}
+
+	res, err := c.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, res, len(tcpStates))
+
+	res, err = c.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, res, len(tcpStates)+8)
+
+	got := make(map[string]metric.Metric)
+	for _, m := range res {
+		got[m.Key()] = m
+	}
+	assert.Equal(t, int64(500), *got[`NetBytesRecv{interface="eth0"}`].Delta)
+	assert.Equal(t, int64(5), *got[`NetPacketsRecv{interface="eth0"}`].Delta)
+	assert.NotContains(t, got, `NetBytesRecv{interface="lo"}`)
+	assert.Equal(t, 2.0, *got[`TCPConnections{state="ESTABLISHED"}`].Value)
+	assert.Equal(t, 0.0, *got[`TCPConnections{state="TIME_WAIT"}`].Value)
+}
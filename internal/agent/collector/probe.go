@@ -0,0 +1,212 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/logger"
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const ProbeName = "probe"
+
+// probeBodyLimit - сколько байт тела ответа проверяется на совпадение
+const probeBodyLimit = 1 << 20
+
+// HTTPClient - клиент, которым выполняются запросы проверок
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// ProbeTarget - проверяемый адрес, Match - регулярное выражение для тела ответа
+type ProbeTarget struct {
+	Name  string
+	URL   string
+	Match *regexp.Regexp
+}
+
+// ParseProbeTarget parses rule in form name=url [regexp]
+func ParseProbeTarget(s string) (ProbeTarget, error) {
+	name, rule, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return ProbeTarget{}, fmt.Errorf("bad probe target %q", s)
+	}
+
+	rawURL, pattern, _ := strings.Cut(strings.TrimSpace(rule), " ")
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ProbeTarget{}, fmt.Errorf("bad probe target %q: url %q", s, rawURL)
+	}
+
+	t := ProbeTarget{Name: name, URL: rawURL}
+	if pattern = strings.TrimSpace(pattern); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return ProbeTarget{}, errors.Wrapf(err, "probe target %q", s)
+		}
+		t.Match = re
+	}
+
+	return t, nil
+}
+
+// probeTimings - фазы запроса, собранные через httptrace
+type probeTimings struct {
+	mu sync.Mutex
+
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	firstByte                 time.Time
+}
+
+func (p *probeTimings) set(dst *time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// при нескольких попытках соединения важна первая
+	if dst.IsZero() {
+		*dst = time.Now()
+	}
+}
+
+func (p *probeTimings) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { p.set(&p.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { p.set(&p.dnsDone) },
+		ConnectStart:         func(string, string) { p.set(&p.connectStart) },
+		ConnectDone:          func(string, string, error) { p.set(&p.connectDone) },
+		TLSHandshakeStart:    func() { p.set(&p.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { p.set(&p.tlsDone) },
+		GotFirstResponseByte: func() { p.set(&p.firstByte) },
+	}
+}
+
+func phase(from, to time.Time) float64 {
+	if from.IsZero() || to.IsZero() {
+		return 0
+	}
+	return to.Sub(from).Seconds()
+}
+
+// Probe - синтетические проверки HTTP адресов, таймаут проверки равен интервалу коллектора
+type Probe struct {
+	interval time.Duration
+	targets  []ProbeTarget
+	client   HTTPClient
+}
+
+func NewProbe(interval time.Duration, targets []ProbeTarget, client HTTPClient) *Probe {
+	return &Probe{interval: interval, targets: targets, client: client}
+}
+
+func (c *Probe) Name() string {
+	return ProbeName
+}
+
+func (c *Probe) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect checks all targets in parallel, failed checks are reported with ProbeSuccess 0
+func (c *Probe) Collect(ctx context.Context) ([]metric.Metric, error) {
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		res = make([]metric.Metric, 0, len(c.targets)*8)
+	)
+
+	for _, t := range c.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			list := c.probe(ctx, t)
+
+			mu.Lock()
+			defer mu.Unlock()
+			res = append(res, list...)
+		}()
+	}
+	wg.Wait()
+
+	return res, nil
+}
+
+func (c *Probe) probe(ctx context.Context, t ProbeTarget) []metric.Metric {
+	ctx, cancel := context.WithTimeout(ctx, c.interval)
+	defer cancel()
+
+	var (
+		timings probeTimings
+		status  int
+		matched bool
+	)
+
+	start := time.Now()
+	err := func() error {
+		req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, timings.trace()), http.MethodGet, t.URL, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		status = resp.StatusCode
+
+		body, err := io.ReadAll(io.LimitReader(resp.Body, probeBodyLimit))
+		if err != nil {
+			return errors.Wrap(err, "read body")
+		}
+		matched = t.Match == nil || t.Match.Match(body)
+
+		return nil
+	}()
+	end := time.Now()
+
+	success := err == nil && status >= 200 && status < 400 && matched
+	if err != nil {
+		logger.Log.Debug("probe", zap.String("target", t.Name), zap.Error(err))
+	}
+
+	// неудачные попытки соединения могут завершиться уже после ответа
+	timings.mu.Lock()
+	defer timings.mu.Unlock()
+
+	labels := metric.Labels{"target": t.Name}
+	res := []metric.Metric{
+		withLabels(gauge("ProbeDNSLookup", phase(timings.dnsStart, timings.dnsDone)), labels),
+		withLabels(gauge("ProbeConnect", phase(timings.connectStart, timings.connectDone)), labels),
+		withLabels(gauge("ProbeTLSHandshake", phase(timings.tlsStart, timings.tlsDone)), labels),
+		withLabels(gauge("ProbeFirstByte", phase(start, timings.firstByte)), labels),
+		withLabels(gauge("ProbeDuration", end.Sub(start).Seconds()), labels),
+		withLabels(gauge("ProbeStatusCode", float64(status)), labels),
+		withLabels(gauge("ProbeSuccess", boolGauge(success)), labels),
+	}
+	if t.Match != nil {
+		res = append(res, withLabels(gauge("ProbeBodyMatch", boolGauge(err == nil && matched)), labels))
+	}
+
+	return res
+}
+
+func boolGauge(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProbeTarget(t *testing.T) {
+	tests := []struct {
+		value     string
+		wantMatch bool
+		wantErr   bool
+	}{
+		{value: "site=https://example.com"},
+		{value: "api=http://localhost:8080/ping  ^pong$", wantMatch: true},
+		{value: "site=example.com", wantErr: true},
+		{value: "site=ftp://example.com", wantErr: true},
+		{value: "=https://example.com", wantErr: true},
+		{value: "site=https://example.com [", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseProbeTarget(tt.value)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantMatch, got.Match != nil)
+		})
+	}
+}
+
+func values(list []metric.Metric) map[string]float64 {
+	res := make(map[string]float64, len(list))
+	for _, m := range list {
+		res[m.Key()] = *m.Value
+	}
+
+	return res
+}
+
+func TestProbe_Collect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("status: ok"))
+	}))
+	defer srv.Close()
+
+	// как и в агенте, каждое соединение новое
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	tests := []struct {
+		name   string
+		target string
+		want   map[string]float64
+	}{
+		{
+			name:   "success",
+			target: "site=" + srv.URL + " ok$",
+			want: map[string]float64{
+				`ProbeStatusCode{target="site"}`: 200,
+				`ProbeSuccess{target="site"}`:    1,
+				`ProbeBodyMatch{target="site"}`:  1,
+			},
+		},
+		{
+			name:   "body mismatch",
+			target: "site=" + srv.URL + " ^fail",
+			want: map[string]float64{
+				`ProbeStatusCode{target="site"}`: 200,
+				`ProbeSuccess{target="site"}`:    0,
+				`ProbeBodyMatch{target="site"}`:  0,
+			},
+		},
+		{
+			name:   "bad status",
+			target: "site=" + srv.URL + "/missing",
+			want: map[string]float64{
+				`ProbeStatusCode{target="site"}`: 404,
+				`ProbeSuccess{target="site"}`:    0,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := ParseProbeTarget(tt.target)
+			assert.NoError(t, err)
+
+			list, err := NewProbe(time.Second, []ProbeTarget{target}, client).Collect(context.Background())
+			assert.NoError(t, err)
+
+			got := values(list)
+			for k, v := range tt.want {
+				assert.Equal(t, v, got[k], k)
+			}
+			assert.Greater(t, got[`ProbeDuration{target="site"}`], 0.0)
+			assert.Greater(t, got[`ProbeConnect{target="site"}`], 0.0)
+			assert.Greater(t, got[`ProbeFirstByte{target="site"}`], 0.0)
+		})
+	}
+}
+
+type failingClient struct{}
+
+func (failingClient) Do(*http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestProbe_CollectError(t *testing.T) {
+	target, err := ParseProbeTarget("site=http://localhost:1 ok")
+	assert.NoError(t, err)
+
+	list, err := NewProbe(time.Second, []ProbeTarget{target}, failingClient{}).Collect(context.Background())
+	assert.NoError(t, err)
+
+	got := values(list)
+	assert.Equal(t, 0.0, got[`ProbeSuccess{target="site"}`])
+	assert.Equal(t, 0.0, got[`ProbeStatusCode{target="site"}`])
+	assert.Equal(t, 0.0, got[`ProbeBodyMatch{target="site"}`])
+}
@@ -0,0 +1,216 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+const ProcessName = "process"
+
+// ProcessMatch - правило отбора процессов, Name используется как префикс метрик.
+// Задается одним из Regex (по имени процесса), Cmdline (подстрока) или PIDFile
+type ProcessMatch struct {
+	Name    string
+	Regex   *regexp.Regexp
+	Cmdline string
+	PIDFile string
+}
+
+// ParseProcessMatch parses rule in form name=kind:pattern, kind is one of name, cmdline, pidfile
+func ParseProcessMatch(s string) (ProcessMatch, error) {
+	name, rule, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return ProcessMatch{}, fmt.Errorf("bad process match %q", s)
+	}
+
+	kind, pattern, ok := strings.Cut(rule, ":")
+	if !ok || pattern == "" {
+		return ProcessMatch{}, fmt.Errorf("bad process match %q", s)
+	}
+
+	m := ProcessMatch{Name: name}
+	switch kind {
+	case "name":
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return ProcessMatch{}, errors.Wrapf(err, "process match %q", s)
+		}
+		m.Regex = re
+	case "cmdline":
+		m.Cmdline = pattern
+	case "pidfile":
+		m.PIDFile = pattern
+	default:
+		return ProcessMatch{}, fmt.Errorf("unknown process match kind %q", kind)
+	}
+
+	return m, nil
+}
+
+// procHandle - методы gopsutil process.Process, которые использует коллектор
+type procHandle interface {
+	NameWithContext(ctx context.Context) (string, error)
+	CmdlineWithContext(ctx context.Context) (string, error)
+	CreateTimeWithContext(ctx context.Context) (int64, error)
+	MemoryInfoWithContext(ctx context.Context) (*process.MemoryInfoStat, error)
+	NumFDsWithContext(ctx context.Context) (int32, error)
+	NumThreadsWithContext(ctx context.Context) (int32, error)
+	PercentWithContext(ctx context.Context, interval time.Duration) (float64, error)
+}
+
+// tracked - процесс, который живет между опросами, чтобы считать загрузку CPU
+type tracked struct {
+	handle  procHandle
+	name    string
+	cmdline string
+	created time.Time
+}
+
+// Process - метрики процессов, отобранных правилами
+type Process struct {
+	interval time.Duration
+	matches  []ProcessMatch
+
+	pids func(ctx context.Context) ([]int32, error)
+	open func(ctx context.Context, pid int32) (procHandle, error)
+	now  func() time.Time
+
+	tracked map[int32]*tracked
+}
+
+func NewProcess(interval time.Duration, matches []ProcessMatch) *Process {
+	return &Process{
+		interval: interval,
+		matches:  matches,
+		pids:     process.PidsWithContext,
+		open: func(ctx context.Context, pid int32) (procHandle, error) {
+			return process.NewProcessWithContext(ctx, pid)
+		},
+		now:     time.Now,
+		tracked: make(map[int32]*tracked),
+	}
+}
+
+func (c *Process) Name() string {
+	return ProcessName
+}
+
+func (c *Process) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect returns summary of processes selected by every match,
+// gone processes are forgotten and new ones are picked up on each poll
+func (c *Process) Collect(ctx context.Context) ([]metric.Metric, error) {
+	pids, err := c.pids(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "pids")
+	}
+
+	alive := make(map[int32]*tracked, len(pids))
+	for _, pid := range pids {
+		if t := c.track(ctx, pid); t != nil {
+			alive[pid] = t
+		}
+	}
+	c.tracked = alive
+
+	res := make([]metric.Metric, 0, len(c.matches)*6)
+	for _, m := range c.matches {
+		res = append(res, c.summary(ctx, m, c.selectProcesses(m))...)
+	}
+
+	return res, nil
+}
+
+func (c *Process) track(ctx context.Context, pid int32) *tracked {
+	if t, ok := c.tracked[pid]; ok {
+		return t
+	}
+
+	h, err := c.open(ctx, pid)
+	if err != nil {
+		return nil
+	}
+
+	created, err := h.CreateTimeWithContext(ctx)
+	if err != nil {
+		return nil
+	}
+
+	name, _ := h.NameWithContext(ctx)
+	cmdline, _ := h.CmdlineWithContext(ctx)
+
+	return &tracked{handle: h, name: name, cmdline: cmdline, created: time.UnixMilli(created)}
+}
+
+func (c *Process) selectProcesses(m ProcessMatch) []*tracked {
+	if m.PIDFile != "" {
+		buf, err := os.ReadFile(m.PIDFile)
+		if err != nil {
+			return nil
+		}
+		pid, err := strconv.ParseInt(strings.TrimSpace(string(buf)), 10, 32)
+		if err != nil {
+			return nil
+		}
+		if t, ok := c.tracked[int32(pid)]; ok {
+			return []*tracked{t}
+		}
+		return nil
+	}
+
+	var res []*tracked
+	for _, t := range c.tracked {
+		switch {
+		case m.Regex != nil && m.Regex.MatchString(t.name):
+			res = append(res, t)
+		case m.Cmdline != "" && strings.Contains(t.cmdline, m.Cmdline):
+			res = append(res, t)
+		}
+	}
+
+	return res
+}
+
+func (c *Process) summary(ctx context.Context, m ProcessMatch, list []*tracked) []metric.Metric {
+	var (
+		cpu, rss, fds, threads float64
+		uptime                 time.Duration
+	)
+
+	now := c.now()
+	for _, t := range list {
+		if p, err := t.handle.PercentWithContext(ctx, 0); err == nil {
+			cpu += p
+		}
+		if mem, err := t.handle.MemoryInfoWithContext(ctx); err == nil {
+			rss += float64(mem.RSS)
+		}
+		if n, err := t.handle.NumFDsWithContext(ctx); err == nil {
+			fds += float64(n)
+		}
+		if n, err := t.handle.NumThreadsWithContext(ctx); err == nil {
+			threads += float64(n)
+		}
+		uptime = max(uptime, now.Sub(t.created))
+	}
+
+	return []metric.Metric{
+		gauge(m.Name+".Count", float64(len(list))),
+		gauge(m.Name+".CPUPercent", cpu),
+		gauge(m.Name+".RSS", rss),
+		gauge(m.Name+".OpenFDs", fds),
+		gauge(m.Name+".Threads", threads),
+		gauge(m.Name+".Uptime", uptime.Seconds()),
+	}
+}
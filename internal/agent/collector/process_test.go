@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/shirou/gopsutil/v4/process"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProc struct {
+	name    string
+	cmdline string
+	created time.Time
+	rss     uint64
+}
+
+func (p *fakeProc) NameWithContext(context.Context) (string, error)    { return p.name, nil }
+func (p *fakeProc) CmdlineWithContext(context.Context) (string, error) { return p.cmdline, nil }
+func (p *fakeProc) CreateTimeWithContext(context.Context) (int64, error) {
+	return p.created.UnixMilli(), nil
+}
+func (p *fakeProc) MemoryInfoWithContext(context.Context) (*process.MemoryInfoStat, error) {
+	return &process.MemoryInfoStat{RSS: p.rss}, nil
+}
+func (p *fakeProc) NumFDsWithContext(context.Context) (int32, error)     { return 10, nil }
+func (p *fakeProc) NumThreadsWithContext(context.Context) (int32, error) { return 2, nil }
+func (p *fakeProc) PercentWithContext(context.Context, time.Duration) (float64, error) {
+	return 1.5, nil
+}
+
+func TestParseProcessMatch(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{value: "web=name:^nginx$"},
+		{value: "api=cmdline:--port 8080"},
+		{value: "db=pidfile:/var/run/postgres.pid"},
+		{value: "web=name:[", wantErr: true},
+		{value: "web=comm:nginx", wantErr: true},
+		{value: "name:nginx", wantErr: true},
+		{value: "web=name:", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			_, err := ParseProcessMatch(tt.value)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestProcess_Collect(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	procs := map[int32]*fakeProc{
+		1: {name: "nginx", created: now.Add(-time.Hour), rss: 100},
+		2: {name: "nginx", created: now.Add(-time.Minute), rss: 50},
+		3: {name: "python3", cmdline: "python3 api.py --port 8080", created: now.Add(-time.Second), rss: 10},
+	}
+
+	pidfile := filepath.Join(t.TempDir(), "api.pid")
+	assert.NoError(t, os.WriteFile(pidfile, []byte("3\n"), 0644))
+
+	web, _ := ParseProcessMatch("web=name:^nginx$")
+	api, _ := ParseProcessMatch("api=cmdline:--port 8080")
+	pid, _ := ParseProcessMatch("pid=pidfile:" + pidfile)
+
+	c := NewProcess(time.Second, []ProcessMatch{web, api, pid})
+	c.now = func() time.Time { return now }
+	c.pids = func(context.Context) ([]int32, error) {
+		res := make([]int32, 0, len(procs))
+		for pid := range procs {
+			res = append(res, pid)
+		}
+		return res, nil
+	}
+	opened := 0
+	c.open = func(_ context.Context, pid int32) (procHandle, error) {
+		p, ok := procs[pid]
+		if !ok {
+			return nil, errors.New("no such process")
+		}
+		opened++
+		return p, nil
+	}
+
+	collect := func() map[string]float64 {
+		res, err := c.Collect(context.Background())
+		assert.NoError(t, err)
+
+		got := make(map[string]float64, len(res))
+		for _, m := range res {
+			assert.Equal(t, metric.Gauge, m.MType)
+			got[m.ID] = *m.Value
+		}
+		return got
+	}
+
+	got := collect()
+	assert.Equal(t, 2.0, got["web.Count"])
+	assert.Equal(t, 150.0, got["web.RSS"])
+	assert.Equal(t, 3.0, got["web.CPUPercent"])
+	assert.Equal(t, 20.0, got["web.OpenFDs"])
+	assert.Equal(t, 4.0, got["web.Threads"])
+	assert.Equal(t, time.Hour.Seconds(), got["web.Uptime"])
+	assert.Equal(t, 1.0, got["api.Count"])
+	assert.Equal(t, 10.0, got["pid.RSS"])
+
+	delete(procs, 3)
+	got = collect()
+	assert.Equal(t, 3, opened)
+	assert.Equal(t, 0.0, got["api.Count"])
+	assert.Equal(t, 0.0, got["pid.Count"])
+	assert.Equal(t, 0.0, got["api.Uptime"])
+}
@@ -0,0 +1,160 @@
+package collector
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/logger"
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	PushName = "push"
+
+	DefaultPushAddress = "127.0.0.1:8126"
+)
+
+// pushBodyLimit - максимальный размер запроса
+const pushBodyLimit = 10 << 20
+
+// Push - прием метрик приложений по HTTP в формате JSON /updates/ сервера.
+// Принятое отправляется на сервер со следующим отчетом агента
+type Push struct {
+	interval time.Duration
+	listener net.Listener
+	server   *http.Server
+
+	mu       sync.Mutex
+	pending  pending
+	requests int64
+	rejected int64
+}
+
+// NewPush binds TCP socket, requests are served after Listen is called
+func NewPush(interval time.Duration, address string) (*Push, error) {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, errors.Wrap(err, "push listen")
+	}
+
+	c := &Push{
+		interval: interval,
+		listener: l,
+		pending:  make(pending),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /updates/", c.updatesHandler)
+	c.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	return c, nil
+}
+
+func (c *Push) Name() string {
+	return PushName
+}
+
+func (c *Push) Interval() time.Duration {
+	return c.interval
+}
+
+// Addr returns address of the socket
+func (c *Push) Addr() net.Addr {
+	return c.listener.Addr()
+}
+
+// Listen serves requests until ctx is done
+func (c *Push) Listen(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		c.server.Shutdown(shutdownCtx)
+	}()
+
+	if err := c.server.Serve(c.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return errors.Wrap(err, "push serve")
+	}
+
+	return nil
+}
+
+func (c *Push) updatesHandler(res http.ResponseWriter, req *http.Request) {
+	var body io.Reader = http.MaxBytesReader(res, req.Body, pushBodyLimit)
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			c.reject(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	var list []metric.Metric
+	if err := json.NewDecoder(body).Decode(&list); err != nil {
+		c.reject(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// правила те же, что при обновлении на сервере: пакет принимается целиком или отклоняется
+	for _, m := range list {
+		switch err := m.Validate(); {
+		case errors.Is(err, metric.ErrMetricNotFound):
+			c.reject(res, "not found", http.StatusNotFound)
+			return
+		case errors.Is(err, metric.ErrMetricBadType):
+			c.reject(res, "bad request (type)", http.StatusBadRequest)
+			return
+		case err != nil:
+			c.reject(res, "bad request (value)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	c.mu.Lock()
+	c.requests++
+	for _, m := range list {
+		c.pending.add(m)
+	}
+	c.mu.Unlock()
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+}
+
+func (c *Push) reject(res http.ResponseWriter, message string, code int) {
+	c.mu.Lock()
+	c.requests++
+	c.rejected++
+	c.mu.Unlock()
+
+	logger.Log.Debug("push rejected", zap.String("reason", message))
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(code)
+	json.NewEncoder(res).Encode(map[string]string{"error": message})
+}
+
+// Collect returns metrics pushed since previous poll
+func (c *Push) Collect(_ context.Context) ([]metric.Metric, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := append(c.pending.drain(),
+		counter("PushRequests", c.requests),
+		counter("PushRejected", c.rejected),
+	)
+	c.requests, c.rejected = 0, 0
+
+	return res, nil
+}
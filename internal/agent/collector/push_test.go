@@ -0,0 +1,101 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPush(t *testing.T) *Push {
+	t.Helper()
+
+	c, err := NewPush(time.Second, "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { c.listener.Close() })
+
+	return c
+}
+
+func TestPush_updatesHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{name: "counter", body: `[{"id":"jobs","type":"counter","delta":2}]`, code: http.StatusOK},
+		{name: "gauge", body: `[{"id":"queue","type":"gauge","value":5,"labels":{"queue":"mail"}}]`, code: http.StatusOK},
+		{name: "bad json", body: `{"id":"jobs"`, code: http.StatusBadRequest},
+		{name: "no id", body: `[{"type":"counter","delta":2}]`, code: http.StatusNotFound},
+		{name: "bad type", body: `[{"id":"jobs","type":"meter","delta":2}]`, code: http.StatusBadRequest},
+		{name: "no value", body: `[{"id":"jobs","type":"counter"}]`, code: http.StatusBadRequest},
+		{name: "partly bad", body: `[{"id":"jobs","type":"counter","delta":2},{"id":"jobs","type":"counter"}]`, code: http.StatusBadRequest},
+	}
+
+	c := newTestPush(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			c.server.Handler.ServeHTTP(w, req)
+			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		})
+	}
+
+	list, err := c.Collect(context.Background())
+	assert.NoError(t, err)
+
+	got := make(map[string]metric.Metric, len(list))
+	for _, m := range list {
+		got[m.Key()] = m
+	}
+	assert.Len(t, got, 4)
+	assert.Equal(t, int64(2), *got["jobs"].Delta)
+	assert.Equal(t, 5.0, *got[`queue{queue="mail"}`].Value)
+	assert.Equal(t, int64(len(tests)), *got["PushRequests"].Delta)
+	assert.Equal(t, int64(5), *got["PushRejected"].Delta)
+}
+
+func TestPush_Listen(t *testing.T) {
+	c := newTestPush(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Listen(ctx) }()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(`[{"id":"jobs","type":"counter","delta":2},{"id":"jobs","type":"counter","delta":3}]`))
+	assert.NoError(t, gz.Close())
+
+	for range 2 {
+		req, err := http.NewRequest(http.MethodPost, "http://"+c.Addr().String()+"/updates/", bytes.NewReader(buf.Bytes()))
+		assert.NoError(t, err)
+		req.Header.Set("Content-Encoding", "gzip")
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	list, err := c.Collect(context.Background())
+	assert.NoError(t, err)
+	for _, m := range list {
+		if m.ID == "jobs" {
+			assert.Equal(t, int64(10), *m.Delta)
+		}
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,262 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime/debug"
+	"runtime/metrics"
+	"strings"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+)
+
+const (
+	RuntimeName = "runtime"
+
+	// RuntimeModeMemStats - только прежние имена runtime.MemStats
+	RuntimeModeMemStats = "memstats"
+	// RuntimeModeMetrics - только метрики runtime/metrics
+	RuntimeModeMetrics = "metrics"
+	// RuntimeModeBoth - и то, и другое
+	RuntimeModeBoth = "both"
+)
+
+// Runtime - метрики рантайма Go из runtime/metrics, счетчик опросов и случайное значение.
+// Чтение не останавливает мир, в отличие от runtime.ReadMemStats
+type Runtime struct {
+	interval time.Duration
+	mode     string
+
+	samples []metrics.Sample
+	descs   map[string]metrics.Description
+
+	prev     map[string]uint64   // предыдущие значения накопительных счетчиков
+	prevHist map[string][]uint64 // предыдущие значения корзин гистограмм
+}
+
+func NewRuntime(interval time.Duration, mode string) (*Runtime, error) {
+	switch mode {
+	case RuntimeModeMemStats, RuntimeModeMetrics, RuntimeModeBoth:
+	default:
+		return nil, fmt.Errorf("unknown runtime mode %q", mode)
+	}
+
+	all := metrics.All()
+	c := &Runtime{
+		interval: interval,
+		mode:     mode,
+		samples:  make([]metrics.Sample, 0, len(all)),
+		descs:    make(map[string]metrics.Description, len(all)),
+		prev:     make(map[string]uint64),
+		prevHist: make(map[string][]uint64),
+	}
+
+	for _, d := range all {
+		c.samples = append(c.samples, metrics.Sample{Name: d.Name})
+		c.descs[d.Name] = d
+	}
+
+	return c, nil
+}
+
+func (c *Runtime) Name() string {
+	return RuntimeName
+}
+
+func (c *Runtime) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect returns runtime metrics, cumulative counters and histograms are
+// reported as deltas starting from the second poll
+func (c *Runtime) Collect(_ context.Context) ([]metric.Metric, error) {
+	metrics.Read(c.samples)
+
+	var res []metric.Metric
+
+	if c.mode != RuntimeModeMemStats {
+		res = append(res, c.runtimeMetrics()...)
+	}
+
+	if c.mode != RuntimeModeMetrics {
+		values := make(map[string]metrics.Value, len(c.samples))
+		for _, s := range c.samples {
+			values[s.Name] = s.Value
+		}
+		res = append(res, memStats(values)...)
+	}
+
+	return append(res,
+		counter("PollCount", 1),
+		gauge("RandomValue", rand.Float64()),
+	), nil
+}
+
+func (c *Runtime) runtimeMetrics() []metric.Metric {
+	res := make([]metric.Metric, 0, len(c.samples))
+
+	for _, s := range c.samples {
+		ID := runtimeMetricID(s.Name)
+		cumulative := c.descs[s.Name].Cumulative
+
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			v := s.Value.Uint64()
+			if !cumulative {
+				res = append(res, gauge(ID, float64(v)))
+				continue
+			}
+
+			prev, ok := c.prev[s.Name]
+			c.prev[s.Name] = v
+			if ok {
+				res = append(res, counter(ID, delta(v, prev)))
+			}
+		case metrics.KindFloat64:
+			res = append(res, gauge(ID, s.Value.Float64()))
+		case metrics.KindFloat64Histogram:
+			h := s.Value.Float64Histogram()
+
+			prev, ok := c.prevHist[s.Name]
+			c.prevHist[s.Name] = append(prev[:0:0], h.Counts...)
+			if ok && len(prev) == len(h.Counts) {
+				res = append(res, runtimeHistogram(ID, h, prev))
+			}
+		}
+	}
+
+	return res
+}
+
+// runtimeMetricID converts runtime/metrics name to metric ID,
+// eg /gc/heap/allocs:bytes -> go_gc_heap_allocs_bytes
+func runtimeMetricID(name string) string {
+	var b strings.Builder
+	b.Grow(len(name) + 2)
+	b.WriteString("go")
+
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+
+	return b.String()
+}
+
+// runtimeHistogram converts increase of runtime histogram to metric histogram.
+// Runtime buckets are [Buckets[i], Buckets[i+1]), the sum is estimated by bucket middles
+func runtimeHistogram(ID string, h *metrics.Float64Histogram, prev []uint64) metric.Metric {
+	bounds := make([]float64, 0, len(h.Counts))
+	counts := make([]uint64, 0, len(h.Counts)+1)
+
+	var (
+		sum   float64
+		total uint64
+		inf   uint64
+	)
+
+	for i, cnt := range h.Counts {
+		d := cnt - prev[i]
+		lo, hi := h.Buckets[i], h.Buckets[i+1]
+
+		if math.IsInf(hi, 1) {
+			inf += d
+		} else {
+			bounds = append(bounds, hi)
+			counts = append(counts, d)
+		}
+
+		total += d
+		switch {
+		case math.IsInf(lo, -1):
+			sum += float64(d) * hi
+		case math.IsInf(hi, 1):
+			sum += float64(d) * lo
+		default:
+			sum += float64(d) * (lo + hi) / 2
+		}
+	}
+
+	return metric.Metric{
+		ID:      ID,
+		MType:   metric.Histogram,
+		Buckets: bounds,
+		Counts:  append(counts, inf),
+		Sum:     &sum,
+		Count:   &total,
+	}
+}
+
+// memStats maps runtime/metrics values to the runtime.MemStats names
+func memStats(values map[string]metrics.Value) []metric.Metric {
+	u := func(name string) float64 {
+		if v, ok := values[name]; ok && v.Kind() == metrics.KindUint64 {
+			return float64(v.Uint64())
+		}
+		return 0
+	}
+	f := func(name string) float64 {
+		if v, ok := values[name]; ok && v.Kind() == metrics.KindFloat64 {
+			return v.Float64()
+		}
+		return 0
+	}
+
+	var gcCPUFraction float64
+	if total := f("/cpu/classes/total:cpu-seconds"); total > 0 {
+		gcCPUFraction = f("/cpu/classes/gc/total:cpu-seconds") / total
+	}
+
+	var gc debug.GCStats
+	debug.ReadGCStats(&gc)
+
+	var lastGC float64
+	if !gc.LastGC.IsZero() {
+		lastGC = float64(gc.LastGC.UnixNano())
+	}
+
+	heapObjects := u("/memory/classes/heap/objects:bytes")
+	heapUnused := u("/memory/classes/heap/unused:bytes")
+	heapFree := u("/memory/classes/heap/free:bytes")
+	heapReleased := u("/memory/classes/heap/released:bytes")
+	stacks := u("/memory/classes/heap/stacks:bytes")
+	mspan := u("/memory/classes/metadata/mspan/inuse:bytes")
+	mcache := u("/memory/classes/metadata/mcache/inuse:bytes")
+
+	return []metric.Metric{
+		gauge("Alloc", heapObjects),
+		gauge("BuckHashSys", u("/memory/classes/profiling/buckets:bytes")),
+		gauge("Frees", u("/gc/heap/frees:objects")+u("/gc/heap/tiny/allocs:objects")),
+		gauge("GCCPUFraction", gcCPUFraction),
+		gauge("GCSys", u("/memory/classes/metadata/other:bytes")),
+		gauge("HeapAlloc", heapObjects),
+		gauge("HeapIdle", heapFree+heapReleased),
+		gauge("HeapInuse", heapObjects+heapUnused),
+		gauge("HeapObjects", u("/gc/heap/objects:objects")),
+		gauge("HeapReleased", heapReleased),
+		gauge("HeapSys", heapObjects+heapUnused+heapFree+heapReleased),
+		gauge("LastGC", lastGC),
+		gauge("Lookups", 0),
+		gauge("MCacheInuse", mcache),
+		gauge("MCacheSys", mcache+u("/memory/classes/metadata/mcache/free:bytes")),
+		gauge("MSpanInuse", mspan),
+		gauge("MSpanSys", mspan+u("/memory/classes/metadata/mspan/free:bytes")),
+		gauge("Mallocs", u("/gc/heap/allocs:objects")+u("/gc/heap/tiny/allocs:objects")),
+		gauge("NextGC", u("/gc/heap/goal:bytes")),
+		gauge("NumForcedGC", u("/gc/cycles/forced:gc-cycles")),
+		gauge("NumGC", u("/gc/cycles/total:gc-cycles")),
+		gauge("OtherSys", u("/memory/classes/other:bytes")),
+		gauge("PauseTotalNs", float64(gc.PauseTotal.Nanoseconds())),
+		gauge("StackInuse", stacks),
+		gauge("StackSys", stacks+u("/memory/classes/os-stacks:bytes")),
+		gauge("Sys", u("/memory/classes/total:bytes")),
+		gauge("TotalAlloc", u("/gc/heap/allocs:bytes")),
+	}
+}
@@ -0,0 +1,103 @@
+package collector
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+func ids(t *testing.T, c Collector) []string {
+	t.Helper()
+
+	list, err := c.Collect(context.Background())
+	assert.NoError(t, err)
+
+	res := make([]string, 0, len(list))
+	for _, m := range list {
+		res = append(res, m.ID)
+	}
+
+	return res
+}
+
+var memStatsNames = []string{
+	"Alloc", "BuckHashSys", "Frees", "GCCPUFraction", "GCSys", "HeapAlloc", "HeapIdle",
+	"HeapInuse", "HeapObjects", "HeapReleased", "HeapSys", "LastGC", "Lookups", "MCacheInuse",
+	"MCacheSys", "MSpanInuse", "MSpanSys", "Mallocs", "NextGC", "NumForcedGC", "NumGC",
+	"OtherSys", "PauseTotalNs", "StackInuse", "StackSys", "Sys", "TotalAlloc",
+}
+
+func TestRuntime_Collect(t *testing.T) {
+	c, err := NewRuntime(time.Second, RuntimeModeMemStats)
+	assert.NoError(t, err)
+
+	got := ids(t, c)
+	assert.Len(t, got, len(memStatsNames)+2)
+	for _, id := range append(memStatsNames, "PollCount", "RandomValue") {
+		assert.Contains(t, got, id)
+	}
+}
+
+func TestRuntime_CollectMetrics(t *testing.T) {
+	c, err := NewRuntime(time.Second, RuntimeModeMetrics)
+	assert.NoError(t, err)
+
+	got := ids(t, c)
+	assert.Contains(t, got, "go_gc_heap_goal_bytes")
+	assert.NotContains(t, got, "Alloc")
+
+	// накопительные счетчики и гистограммы появляются со второго опроса
+	assert.NotContains(t, got, "go_gc_heap_allocs_bytes")
+	assert.NotContains(t, got, "go_sched_latencies_seconds")
+
+	list, err := c.Collect(context.Background())
+	assert.NoError(t, err)
+
+	types := make(map[string]string, len(list))
+	for _, m := range list {
+		assert.NoError(t, m.Validate(), m.ID)
+		types[m.ID] = m.MType
+	}
+
+	assert.Equal(t, metric.Counter, types["go_gc_heap_allocs_bytes"])
+	assert.Equal(t, metric.Gauge, types["go_gc_heap_goal_bytes"])
+	assert.Equal(t, metric.Histogram, types["go_sched_latencies_seconds"])
+	assert.Equal(t, metric.Histogram, types["go_gc_pauses_seconds"])
+}
+
+func TestRuntime_CollectBoth(t *testing.T) {
+	c, err := NewRuntime(time.Second, RuntimeModeBoth)
+	assert.NoError(t, err)
+
+	got := ids(t, c)
+	assert.Contains(t, got, "HeapAlloc")
+	assert.Contains(t, got, "go_gc_heap_goal_bytes")
+}
+
+func TestNewRuntime_BadMode(t *testing.T) {
+	_, err := NewRuntime(time.Second, "full")
+	assert.Error(t, err)
+}
+
+func Test_runtimeMetricID(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "/gc/heap/allocs:bytes", want: "go_gc_heap_allocs_bytes"},
+		{name: "/sched/pauses/stopping/gc:seconds", want: "go_sched_pauses_stopping_gc_seconds"},
+		{name: "/godebug/non-default-behavior/http2client:events", want: "go_godebug_non_default_behavior_http2client_events"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runtimeMetricID(tt.name)
+			assert.Equal(t, tt.want, got)
+			assert.False(t, strings.ContainsAny(got, "/:-"))
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/logger"
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	StatsDName = "statsd"
+
+	DefaultStatsDAddress = "127.0.0.1:8125"
+)
+
+// statsdPacketSize - максимальный размер UDP пакета
+const statsdPacketSize = 65535
+
+// statsdBuckets - границы корзин таймеров в миллисекундах
+var statsdBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+var errStatsDLine = errors.New("bad statsd line")
+
+// StatsD - прием метрик по протоколу StatsD через UDP.
+// Между опросами счетчики суммируются, gauge хранят последнее значение, таймеры собираются в histogram
+type StatsD struct {
+	interval time.Duration
+	conn     net.PacketConn
+
+	mu      sync.Mutex
+	pending pending
+	gauges  map[string]float64 // последние значения gauge для относительных изменений
+	packets int64
+	bad     int64
+}
+
+// NewStatsD binds UDP socket, metrics are received after Listen is called
+func NewStatsD(interval time.Duration, address string) (*StatsD, error) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, errors.Wrap(err, "statsd listen")
+	}
+
+	return &StatsD{
+		interval: interval,
+		conn:     conn,
+		pending:  make(pending),
+		gauges:   make(map[string]float64),
+	}, nil
+}
+
+func (c *StatsD) Name() string {
+	return StatsDName
+}
+
+func (c *StatsD) Interval() time.Duration {
+	return c.interval
+}
+
+// Addr returns address of the socket
+func (c *StatsD) Addr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// Listen receives packets until ctx is done
+func (c *StatsD) Listen(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		c.conn.Close()
+	}()
+
+	buf := make([]byte, statsdPacketSize)
+	for {
+		n, _, err := c.conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.Wrap(err, "statsd read")
+		}
+
+		c.handle(buf[:n])
+	}
+}
+
+func (c *StatsD) handle(packet []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.packets++
+	for _, line := range bytes.Split(packet, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		if err := c.add(string(line)); err != nil {
+			c.bad++
+			logger.Log.Debug("statsd", zap.ByteString("line", line), zap.Error(err))
+		}
+	}
+}
+
+// add parses line name:value|type[|@rate][|#tag:value,...] and aggregates it
+func (c *StatsD) add(line string) error {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return errStatsDLine
+	}
+
+	fields := strings.Split(rest, "|")
+	if len(fields) < 2 {
+		return errStatsDLine
+	}
+
+	rate := 1.0
+	var labels metric.Labels
+	for _, f := range fields[2:] {
+		switch {
+		case strings.HasPrefix(f, "@"):
+			r, err := strconv.ParseFloat(f[1:], 64)
+			if err != nil || r <= 0 || r > 1 {
+				return fmt.Errorf("%w: sample rate %q", errStatsDLine, f)
+			}
+			rate = r
+		case strings.HasPrefix(f, "#"):
+			labels = parseStatsDTags(f[1:])
+		}
+	}
+
+	raw := fields[0]
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return fmt.Errorf("%w: value %q", errStatsDLine, raw)
+	}
+
+	switch fields[1] {
+	case "c":
+		c.pending.add(withLabels(counter(name, int64(math.Round(value/rate))), labels))
+	case "g":
+		m := withLabels(gauge(name, value), labels)
+		key := m.Key()
+		if strings.HasPrefix(raw, "+") || strings.HasPrefix(raw, "-") {
+			*m.Value += c.gauges[key]
+		}
+		c.gauges[key] = *m.Value
+		c.pending.add(m)
+	case "ms", "h":
+		m := withLabels(observation(statsdBuckets, value, uint64(math.Round(1/rate))), labels)
+		m.ID = name
+		c.pending.add(m)
+	default:
+		return fmt.Errorf("%w: type %q", errStatsDLine, fields[1])
+	}
+
+	return nil
+}
+
+// parseStatsDTags parses DogStatsD tags in form key:value,key2:value2
+func parseStatsDTags(s string) metric.Labels {
+	labels := make(metric.Labels)
+	for _, tag := range strings.Split(s, ",") {
+		k, v, _ := strings.Cut(tag, ":")
+		if k = strings.TrimSpace(k); k != "" {
+			labels[k] = strings.TrimSpace(v)
+		}
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+
+	return labels
+}
+
+// observation returns histogram holding n observations of v
+func observation(buckets []float64, v float64, n uint64) metric.Metric {
+	counts := make([]uint64, len(buckets)+1)
+	i, _ := slices.BinarySearch(buckets, v)
+	counts[i] = n
+
+	sum := v * float64(n)
+	return metric.Metric{MType: metric.Histogram, Buckets: buckets, Counts: counts, Sum: &sum, Count: &n}
+}
+
+// Collect returns metrics received since previous poll
+func (c *StatsD) Collect(_ context.Context) ([]metric.Metric, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := append(c.pending.drain(),
+		counter("StatsDPackets", c.packets),
+		counter("StatsDBadLines", c.bad),
+	)
+	c.packets, c.bad = 0, 0
+
+	return res, nil
+}
@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStatsD(t *testing.T) *StatsD {
+	t.Helper()
+
+	c, err := NewStatsD(time.Second, "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { c.conn.Close() })
+
+	return c
+}
+
+func collectStatsD(t *testing.T, c *StatsD) map[string]metric.Metric {
+	t.Helper()
+
+	list, err := c.Collect(context.Background())
+	assert.NoError(t, err)
+
+	res := make(map[string]metric.Metric, len(list))
+	for _, m := range list {
+		assert.NoError(t, m.Validate())
+		res[m.Key()] = m
+	}
+
+	return res
+}
+
+func TestStatsD_handle(t *testing.T) {
+	c := newTestStatsD(t)
+
+	c.handle([]byte("requests:1|c\nrequests:2|c|@0.5\nrequests:1|c|#route:/api\n" +
+		"queue:10|g\nqueue:-3|g\nqueue:+1|g\n" +
+		"latency:20|ms\nlatency:300|ms|@0.5\n" +
+		"broken\nusers:1|s\nrequests:x|c\n"))
+
+	got := collectStatsD(t, c)
+	assert.Equal(t, int64(5), *got["requests"].Delta)
+	assert.Equal(t, int64(1), *got[`requests{route="/api"}`].Delta)
+	assert.Equal(t, 8.0, *got["queue"].Value)
+
+	latency := got["latency"]
+	assert.Equal(t, metric.Histogram, latency.MType)
+	assert.Equal(t, uint64(3), *latency.Count)
+	assert.Equal(t, 620.0, *latency.Sum)
+	assert.Equal(t, uint64(1), latency.Counts[3])
+	assert.Equal(t, uint64(2), latency.Counts[7])
+
+	assert.Equal(t, int64(1), *got["StatsDPackets"].Delta)
+	assert.Equal(t, int64(3), *got["StatsDBadLines"].Delta)
+
+	// принятое отдается один раз, gauge помнит значение для относительных изменений
+	c.handle([]byte("queue:+2|g"))
+	got = collectStatsD(t, c)
+	assert.NotContains(t, got, "requests")
+	assert.Equal(t, 10.0, *got["queue"].Value)
+}
+
+func TestStatsD_Listen(t *testing.T) {
+	c := newTestStatsD(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Listen(ctx) }()
+
+	conn, err := net.Dial("udp", c.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("requests:3|c"))
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.packets == 1
+	}, time.Second, 10*time.Millisecond)
+
+	got := collectStatsD(t, c)
+	assert.Equal(t, int64(3), *got["requests"].Delta)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
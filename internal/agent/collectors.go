@@ -0,0 +1,178 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/agent/collector"
+)
+
+type collectorFactory func(interval time.Duration) (collector.Collector, error)
+
+// collectorFactories - известные агенту коллекторы по именам
+func collectorFactories(cfg *Config) map[string]collectorFactory {
+	return map[string]collectorFactory{
+		collector.RuntimeName: func(interval time.Duration) (collector.Collector, error) {
+			mode := cfg.RuntimeMode
+			if mode == "" {
+				mode = collector.RuntimeModeBoth
+			}
+			return collector.NewRuntime(interval, mode)
+		},
+		collector.MemoryName: func(interval time.Duration) (collector.Collector, error) {
+			return collector.NewMemory(interval), nil
+		},
+		collector.DiskName: func(interval time.Duration) (collector.Collector, error) {
+			mounts, err := collector.NewFilter(splitList(cfg.DiskMountInclude), splitList(cfg.DiskMountExclude))
+			if err != nil {
+				return nil, err
+			}
+			devices, err := collector.NewFilter(splitList(cfg.DiskDeviceInclude), splitList(cfg.DiskDeviceExclude))
+			if err != nil {
+				return nil, err
+			}
+			return collector.NewDisk(interval, mounts, devices), nil
+		},
+		collector.NetName: func(interval time.Duration) (collector.Collector, error) {
+			interfaces, err := collector.NewFilter(splitList(cfg.NetAllow), splitList(cfg.NetDeny))
+			if err != nil {
+				return nil, err
+			}
+			return collector.NewNet(interval, interfaces), nil
+		},
+		collector.ProcessName: func(interval time.Duration) (collector.Collector, error) {
+			if len(cfg.Processes) == 0 {
+				return nil, errors.New("no process matches")
+			}
+
+			matches := make([]collector.ProcessMatch, 0, len(cfg.Processes))
+			for _, v := range cfg.Processes {
+				m, err := collector.ParseProcessMatch(v)
+				if err != nil {
+					return nil, err
+				}
+				matches = append(matches, m)
+			}
+			return collector.NewProcess(interval, matches), nil
+		},
+		collector.CgroupName: func(interval time.Duration) (collector.Collector, error) {
+			root := cfg.CgroupPath
+			if root == "" {
+				root = collector.DefaultCgroupPath
+			}
+			return collector.NewCgroup(interval, root), nil
+		},
+		collector.ExecName: func(interval time.Duration) (collector.Collector, error) {
+			if len(cfg.Scripts) == 0 {
+				return nil, errors.New("no scripts")
+			}
+
+			names := make(map[string]struct{}, len(cfg.Scripts))
+			scripts := make([]collector.Script, 0, len(cfg.Scripts))
+			for _, v := range cfg.Scripts {
+				sc, err := collector.ParseScript(v)
+				if err != nil {
+					return nil, err
+				}
+				if _, ok := names[sc.Name]; ok {
+					return nil, fmt.Errorf("duplicate script %s", sc.Name)
+				}
+				names[sc.Name] = struct{}{}
+				scripts = append(scripts, sc)
+			}
+			return collector.NewExec(interval, scripts), nil
+		},
+		collector.ProbeName: func(interval time.Duration) (collector.Collector, error) {
+			if len(cfg.Probes) == 0 {
+				return nil, errors.New("no probe targets")
+			}
+
+			targets := make([]collector.ProbeTarget, 0, len(cfg.Probes))
+			for _, v := range cfg.Probes {
+				t, err := collector.ParseProbeTarget(v)
+				if err != nil {
+					return nil, err
+				}
+				targets = append(targets, t)
+			}
+			return collector.NewProbe(interval, targets, newProbeClient()), nil
+		},
+		collector.LogTailName: func(interval time.Duration) (collector.Collector, error) {
+			if len(cfg.LogRules) == 0 {
+				return nil, errors.New("no log rules")
+			}
+
+			rules := make([]collector.LogRule, 0, len(cfg.LogRules))
+			for _, v := range cfg.LogRules {
+				r, err := collector.ParseLogRule(v)
+				if err != nil {
+					return nil, err
+				}
+				rules = append(rules, r)
+			}
+			return collector.NewLogTail(interval, rules), nil
+		},
+		collector.StatsDName: func(interval time.Duration) (collector.Collector, error) {
+			address := cfg.StatsDAddress
+			if address == "" {
+				address = collector.DefaultStatsDAddress
+			}
+			c, err := collector.NewStatsD(interval, address)
+			if err != nil {
+				return nil, err
+			}
+			return c, nil
+		},
+		collector.PushName: func(interval time.Duration) (collector.Collector, error) {
+			address := cfg.PushAddress
+			if address == "" {
+				address = collector.DefaultPushAddress
+			}
+			c, err := collector.NewPush(interval, address)
+			if err != nil {
+				return nil, err
+			}
+			return c, nil
+		},
+	}
+}
+
+// newProbeClient returns client opening new connection for every check,
+// so that DNS, connect and TLS phases are measured each time
+func newProbeClient() HTTPClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = true
+
+	return &http.Client{Transport: transport}
+}
+
+// newRegistry creates collectors enabled in config
+func newRegistry(cfg *Config) (*collector.Registry, error) {
+	enabled, err := cfg.EnabledCollectors()
+	if err != nil {
+		return nil, err
+	}
+
+	factories := collectorFactories(cfg)
+	registry := collector.NewRegistry()
+
+	for name, interval := range enabled {
+		factory, ok := factories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown collector %s", name)
+		}
+
+		c, err := factory(interval)
+		if err != nil {
+			return nil, fmt.Errorf("collector %s: %w", name, err)
+		}
+
+		if err := registry.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return registry, nil
+}
@@ -4,11 +4,16 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"net"
 	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/caarlos0/env/v11"
+	"github.com/nbvehbq/go-metrics-harvester/internal/agent/collector"
 )
 
 type Protocol string
@@ -16,6 +21,8 @@ type Protocol string
 const (
 	HTTPProtocol Protocol = "http"
 	GRPCProtocol Protocol = "grpc"
+	// AutoProtocol - gRPC с переходом на HTTP, если gRPC недоступен
+	AutoProtocol Protocol = "auto"
 )
 
 const (
@@ -25,6 +32,13 @@ const (
 	defaultLogLevel       = "info"
 	defaultRateLimit      = 1024
 	defaultProtocol       = HTTPProtocol
+	defaultCollectors     = collector.RuntimeName + "," + collector.MemoryName
+	defaultRuntimeMode    = collector.RuntimeModeBoth
+	defaultSpoolMaxBytes  = 64 << 20
+	defaultSpoolMaxAge    = 24 * 60 * 60
+	defaultFanoutMode     = FanoutAll
+	defaultProtocolProbe  = 60
+	defaultMaxBatchBytes  = 1 << 20
 )
 
 // Config is an agent configuration
@@ -38,6 +52,60 @@ type Config struct {
 	CryptoKey      string `env:"CRYPTO_KEY"`
 	ConfigFile     string `env:"CONFIG"`
 	Protocol       string `env:"PROTOCOL"`
+	GRPCStream     bool   `env:"GRPC_STREAM"`
+
+	// для протокола auto: адрес gRPC, по умолчанию порт Address + 1,
+	// и период в секундах, с которым агент пробует вернуться на gRPC
+	GRPCAddress   string `env:"GRPC_ADDRESS"`
+	ProtocolProbe int64  `env:"PROTOCOL_PROBE"`
+
+	Collectors         string `env:"COLLECTORS"`          // включенные коллекторы через запятую
+	CollectorIntervals string `env:"COLLECTOR_INTERVALS"` // интервалы опроса коллекторов, например memory=10s,runtime=2s
+
+	// шаблоны точек монтирования и устройств коллектора disk через запятую
+	DiskMountInclude  string `env:"DISK_MOUNT_INCLUDE"`
+	DiskMountExclude  string `env:"DISK_MOUNT_EXCLUDE"`
+	DiskDeviceInclude string `env:"DISK_DEVICE_INCLUDE"`
+	DiskDeviceExclude string `env:"DISK_DEVICE_EXCLUDE"`
+
+	// шаблоны сетевых интерфейсов коллектора net через запятую
+	NetAllow string `env:"NET_ALLOW"`
+	NetDeny  string `env:"NET_DENY"`
+
+	// правила коллектора process в виде name=kind:pattern, kind - name, cmdline или pidfile
+	Processes []string `env:"PROCESSES" envSeparator:";"`
+
+	CgroupPath string `env:"CGROUP_PATH"` // корень cgroup v2 контейнера
+
+	// правила коллектора exec в виде name[:interval[:timeout]]=command args
+	Scripts []string `env:"SCRIPTS" envSeparator:";"`
+
+	// адреса коллектора probe в виде name=url [regexp]
+	Probes []string `env:"PROBES" envSeparator:";"`
+
+	// правила коллектора logtail в виде name[:kind[:buckets]]=path regexp, kind - gauge или histogram
+	LogRules []string `env:"LOG_RULES" envSeparator:";"`
+
+	StatsDAddress string `env:"STATSD_ADDRESS"` // UDP адрес коллектора statsd
+	PushAddress   string `env:"PUSH_ADDRESS"`   // HTTP адрес коллектора push
+
+	// каталог неотправленных пакетов, пустой - пакеты не сохраняются
+	SpoolDir      string `env:"SPOOL_DIR"`
+	SpoolMaxBytes int64  `env:"SPOOL_MAX_BYTES"`
+	SpoolMaxAge   int64  `env:"SPOOL_MAX_AGE"` // секунды
+
+	// серверы в виде URL http://host:port?key=...&crypto_key=...&spool_dir=...&name=...
+	// или grpc://host:port?stream=true, если заданы - Address не используется
+	Destinations []string `env:"DESTINATIONS" envSeparator:";"`
+	FanoutMode   string   `env:"FANOUT_MODE"` // all, any или failover
+
+	// RuntimeMode - набор метрик коллектора runtime: memstats, metrics или both
+	RuntimeMode string `env:"RUNTIME_MODE"`
+
+	// ограничения одного запроса к серверу, больший пакет делится на части, 0 - без ограничения;
+	// размер считается по JSON (HTTP) или protobuf (gRPC) до шифрования и сжатия
+	MaxBatchMetrics int `env:"MAX_BATCH_METRICS"`
+	MaxBatchBytes   int `env:"MAX_BATCH_BYTES"`
 }
 
 type CfgFile struct {
@@ -46,6 +114,44 @@ type CfgFile struct {
 	PollInterval   string `json:"poll_interval"`
 	CryptoKey      string `json:"crypto_key"`
 	Protocol       string `json:"protocol"`
+	GRPCStream     bool   `json:"grpc_stream"`
+	GRPCAddress    string `json:"grpc_address"`
+	ProtocolProbe  string `json:"protocol_probe"`
+	// Collectors - включенные коллекторы и их интервалы опроса, пустой интервал - poll_interval
+	Collectors map[string]string `json:"collectors"`
+
+	DiskMountInclude  []string `json:"disk_mount_include"`
+	DiskMountExclude  []string `json:"disk_mount_exclude"`
+	DiskDeviceInclude []string `json:"disk_device_include"`
+	DiskDeviceExclude []string `json:"disk_device_exclude"`
+
+	NetAllow []string `json:"net_allow"`
+	NetDeny  []string `json:"net_deny"`
+
+	Processes []string `json:"processes"`
+
+	CgroupPath string `json:"cgroup_path"`
+
+	RuntimeMode string `json:"runtime_mode"`
+
+	Scripts []string `json:"scripts"`
+
+	Probes []string `json:"probes"`
+
+	LogRules []string `json:"log_rules"`
+
+	StatsDAddress string `json:"statsd_address"`
+	PushAddress   string `json:"push_address"`
+
+	SpoolDir      string `json:"spool_dir"`
+	SpoolMaxBytes int64  `json:"spool_max_bytes"`
+	SpoolMaxAge   string `json:"spool_max_age"`
+
+	Destinations []string `json:"destinations"`
+	FanoutMode   string   `json:"fanout_mode"`
+
+	MaxBatchMetrics int `json:"max_batch_metrics"`
+	MaxBatchBytes   int `json:"max_batch_bytes"`
 }
 
 // NewConfig returns a new config
@@ -55,6 +161,13 @@ func NewConfig() (*Config, error) {
 		ReportInterval: defaultReportInterval,
 		PollInterval:   defaultPollInterval,
 		LogLevel:       defaultLogLevel,
+		Collectors:     defaultCollectors,
+		RuntimeMode:    defaultRuntimeMode,
+		SpoolMaxBytes:  defaultSpoolMaxBytes,
+		SpoolMaxAge:    defaultSpoolMaxAge,
+		FanoutMode:     defaultFanoutMode,
+		ProtocolProbe:  defaultProtocolProbe,
+		MaxBatchBytes:  defaultMaxBatchBytes,
 	}
 
 	flag.StringVar(&cfg.Address, "a", defaultAddress, "server address eg http://localhost:8080")
@@ -65,6 +178,47 @@ func NewConfig() (*Config, error) {
 	flag.StringVar(&cfg.CryptoKey, "crypto-key", "", "public key")
 	flag.StringVar(&cfg.ConfigFile, "c", "", "json file holding configuration")
 	flag.StringVar(&cfg.Protocol, "protocol", string(defaultProtocol), "protocol to comunicate with server")
+	flag.BoolVar(&cfg.GRPCStream, "grpc-stream", false, "send updates over long-lived grpc stream")
+	flag.StringVar(&cfg.GRPCAddress, "grpc-address", "", "grpc server address for auto protocol, default port of address + 1")
+	flag.Int64Var(&cfg.ProtocolProbe, "protocol-probe", defaultProtocolProbe, "auto protocol: seconds between attempts to switch back to grpc")
+	flag.StringVar(&cfg.Collectors, "collectors", defaultCollectors, "comma separated list of enabled collectors")
+	flag.StringVar(&cfg.CollectorIntervals, "collector-intervals", "", "collector poll intervals eg memory=10s,runtime=2s")
+	flag.StringVar(&cfg.DiskMountInclude, "disk-mount-include", "", "mountpoint patterns to collect")
+	flag.StringVar(&cfg.DiskMountExclude, "disk-mount-exclude", "", "mountpoint patterns to skip")
+	flag.StringVar(&cfg.DiskDeviceInclude, "disk-device-include", "", "device patterns to collect")
+	flag.StringVar(&cfg.DiskDeviceExclude, "disk-device-exclude", "", "device patterns to skip")
+	flag.StringVar(&cfg.NetAllow, "net-allow", "", "network interface patterns to collect")
+	flag.StringVar(&cfg.NetDeny, "net-deny", "", "network interface patterns to skip")
+	flag.Func("process", "process match name=kind:pattern, may be repeated", func(v string) error {
+		cfg.Processes = append(cfg.Processes, v)
+		return nil
+	})
+	flag.StringVar(&cfg.CgroupPath, "cgroup-path", "", "cgroup v2 directory, default "+collector.DefaultCgroupPath)
+	flag.StringVar(&cfg.RuntimeMode, "runtime-mode", defaultRuntimeMode, "runtime collector metrics: memstats, metrics or both")
+	flag.Func("script", "script name[:interval[:timeout]]=command args, may be repeated", func(v string) error {
+		cfg.Scripts = append(cfg.Scripts, v)
+		return nil
+	})
+	flag.Func("probe", "probe target name=url [regexp], may be repeated", func(v string) error {
+		cfg.Probes = append(cfg.Probes, v)
+		return nil
+	})
+	flag.Func("log-rule", "log rule name[:kind[:buckets]]=path regexp, may be repeated", func(v string) error {
+		cfg.LogRules = append(cfg.LogRules, v)
+		return nil
+	})
+	flag.StringVar(&cfg.StatsDAddress, "statsd-address", "", "statsd UDP address, default "+collector.DefaultStatsDAddress)
+	flag.StringVar(&cfg.PushAddress, "push-address", "", "push HTTP address, default "+collector.DefaultPushAddress)
+	flag.StringVar(&cfg.SpoolDir, "spool-dir", "", "directory to keep unsent batches")
+	flag.Int64Var(&cfg.SpoolMaxBytes, "spool-max-bytes", defaultSpoolMaxBytes, "spool size limit, the oldest batches are dropped")
+	flag.Int64Var(&cfg.SpoolMaxAge, "spool-max-age", defaultSpoolMaxAge, "spooled batch lifetime in seconds")
+	flag.Func("destination", "server URL eg grpc://host:3200?key=secret&spool_dir=/var/spool/agent, may be repeated", func(v string) error {
+		cfg.Destinations = append(cfg.Destinations, v)
+		return nil
+	})
+	flag.StringVar(&cfg.FanoutMode, "fanout-mode", defaultFanoutMode, "destinations policy: all, any or failover")
+	flag.IntVar(&cfg.MaxBatchMetrics, "max-batch-metrics", 0, "metrics per request limit, larger batches are split")
+	flag.IntVar(&cfg.MaxBatchBytes, "max-batch-bytes", defaultMaxBatchBytes, "request payload size limit, larger batches are split")
 	flag.Parse()
 
 	if err := env.Parse(cfg); err != nil {
@@ -96,6 +250,85 @@ func NewConfig() (*Config, error) {
 		cfg.ReportInterval = int64(ri.Seconds())
 		cfg.PollInterval = int64(pi.Seconds())
 		cfg.CryptoKey = fileCfg.CryptoKey
+		if fileCfg.GRPCStream {
+			cfg.GRPCStream = true
+		}
+		if fileCfg.GRPCAddress != "" {
+			cfg.GRPCAddress = fileCfg.GRPCAddress
+		}
+		if fileCfg.ProtocolProbe != "" {
+			probe, err := time.ParseDuration(fileCfg.ProtocolProbe)
+			if err != nil {
+				return nil, err
+			}
+			cfg.ProtocolProbe = int64(probe.Seconds())
+		}
+		if len(fileCfg.Collectors) > 0 {
+			cfg.Collectors, cfg.CollectorIntervals = joinCollectors(fileCfg.Collectors)
+		}
+		setList(&cfg.DiskMountInclude, fileCfg.DiskMountInclude)
+		setList(&cfg.DiskMountExclude, fileCfg.DiskMountExclude)
+		setList(&cfg.DiskDeviceInclude, fileCfg.DiskDeviceInclude)
+		setList(&cfg.DiskDeviceExclude, fileCfg.DiskDeviceExclude)
+		setList(&cfg.NetAllow, fileCfg.NetAllow)
+		setList(&cfg.NetDeny, fileCfg.NetDeny)
+		if len(fileCfg.Processes) > 0 {
+			cfg.Processes = fileCfg.Processes
+		}
+		if fileCfg.CgroupPath != "" {
+			cfg.CgroupPath = fileCfg.CgroupPath
+		}
+		if len(fileCfg.Scripts) > 0 {
+			cfg.Scripts = fileCfg.Scripts
+		}
+		if len(fileCfg.Probes) > 0 {
+			cfg.Probes = fileCfg.Probes
+		}
+		if len(fileCfg.LogRules) > 0 {
+			cfg.LogRules = fileCfg.LogRules
+		}
+		if fileCfg.StatsDAddress != "" {
+			cfg.StatsDAddress = fileCfg.StatsDAddress
+		}
+		if fileCfg.PushAddress != "" {
+			cfg.PushAddress = fileCfg.PushAddress
+		}
+		if fileCfg.SpoolDir != "" {
+			cfg.SpoolDir = fileCfg.SpoolDir
+		}
+		if fileCfg.SpoolMaxBytes > 0 {
+			cfg.SpoolMaxBytes = fileCfg.SpoolMaxBytes
+		}
+		if fileCfg.SpoolMaxAge != "" {
+			age, err := time.ParseDuration(fileCfg.SpoolMaxAge)
+			if err != nil {
+				return nil, err
+			}
+			cfg.SpoolMaxAge = int64(age.Seconds())
+		}
+		if len(fileCfg.Destinations) > 0 {
+			cfg.Destinations = fileCfg.Destinations
+		}
+		if fileCfg.FanoutMode != "" {
+			cfg.FanoutMode = fileCfg.FanoutMode
+		}
+		if fileCfg.RuntimeMode != "" {
+			cfg.RuntimeMode = fileCfg.RuntimeMode
+		}
+		if fileCfg.MaxBatchMetrics > 0 {
+			cfg.MaxBatchMetrics = fileCfg.MaxBatchMetrics
+		}
+		if fileCfg.MaxBatchBytes > 0 {
+			cfg.MaxBatchBytes = fileCfg.MaxBatchBytes
+		}
+	}
+
+	if _, err := cfg.EnabledCollectors(); err != nil {
+		return nil, err
+	}
+
+	if _, err := cfg.DestinationConfigs(); err != nil {
+		return nil, err
 	}
 
 	u, err := url.Parse(cfg.Address)
@@ -103,13 +336,213 @@ func NewConfig() (*Config, error) {
 		return nil, err
 	}
 
-	if cfg.Protocol != string(HTTPProtocol) && cfg.Protocol != string(GRPCProtocol) {
+	switch Protocol(cfg.Protocol) {
+	case HTTPProtocol, GRPCProtocol, AutoProtocol:
+	default:
 		return nil, fmt.Errorf("unknown protocol %s", cfg.Protocol)
 	}
 
-	if cfg.Protocol == string(HTTPProtocol) && (u.Scheme == "localhost" || u.Scheme == "127.0.0.1") {
+	if cfg.Protocol != string(GRPCProtocol) && (u.Scheme == "localhost" || u.Scheme == "127.0.0.1") {
 		cfg.Address = "http://" + cfg.Address
 	}
 
+	if cfg.MaxBatchMetrics < 0 || cfg.MaxBatchBytes < 0 {
+		return nil, fmt.Errorf("negative batch limit")
+	}
+
+	if cfg.Protocol == string(AutoProtocol) {
+		if _, _, err := cfg.AutoConfigs(); err != nil {
+			return nil, err
+		}
+	}
+
 	return cfg, nil
 }
+
+// EnabledCollectors returns enabled collectors with their poll intervals,
+// collectors without own interval are polled every PollInterval
+func (c *Config) EnabledCollectors() (map[string]time.Duration, error) {
+	intervals := make(map[string]time.Duration)
+	for _, pair := range splitList(c.CollectorIntervals) {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("bad collector interval %s", pair)
+		}
+
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("bad collector interval %s", pair)
+		}
+		intervals[strings.TrimSpace(name)] = d
+	}
+
+	res := make(map[string]time.Duration)
+	for _, name := range splitList(c.Collectors) {
+		d, ok := intervals[name]
+		if !ok {
+			d = time.Second * time.Duration(c.PollInterval)
+		}
+		res[name] = d
+	}
+
+	return res, nil
+}
+
+// DestinationConfig - настройки одного из серверов
+type DestinationConfig struct {
+	Name       string
+	Protocol   Protocol
+	Address    string
+	Key        string
+	CryptoKey  string
+	SpoolDir   string
+	GRPCStream bool
+}
+
+// ParseDestination parses server URL, options are passed as query parameters
+func ParseDestination(s string) (DestinationConfig, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return DestinationConfig{}, fmt.Errorf("bad destination %q: %w", s, err)
+	}
+	if u.Host == "" {
+		return DestinationConfig{}, fmt.Errorf("bad destination %q: no host", s)
+	}
+
+	query := u.Query()
+	d := DestinationConfig{
+		Name:      query.Get("name"),
+		Key:       query.Get("key"),
+		CryptoKey: query.Get("crypto_key"),
+		SpoolDir:  query.Get("spool_dir"),
+	}
+	if d.Name == "" {
+		d.Name = u.Host
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		d.Protocol = HTTPProtocol
+		d.Address = u.Scheme + "://" + u.Host + strings.TrimSuffix(u.Path, "/")
+	case string(GRPCProtocol):
+		d.Protocol = GRPCProtocol
+		d.Address = u.Host
+		if v := query.Get("stream"); v != "" {
+			if d.GRPCStream, err = strconv.ParseBool(v); err != nil {
+				return DestinationConfig{}, fmt.Errorf("bad destination %q: stream %q", s, v)
+			}
+		}
+	default:
+		return DestinationConfig{}, fmt.Errorf("bad destination %q: unknown scheme %q", s, u.Scheme)
+	}
+
+	return d, nil
+}
+
+// DestinationConfigs returns configured servers, names must be unique.
+// Spool is set either for agent or for destinations
+func (c *Config) DestinationConfigs() ([]DestinationConfig, error) {
+	if len(c.Destinations) == 0 {
+		return nil, nil
+	}
+
+	switch c.FanoutMode {
+	case FanoutAll, FanoutAny, FanoutFailover:
+	default:
+		return nil, fmt.Errorf("unknown fanout mode %q", c.FanoutMode)
+	}
+
+	names := make(map[string]struct{}, len(c.Destinations))
+	res := make([]DestinationConfig, 0, len(c.Destinations))
+	for _, v := range c.Destinations {
+		d, err := ParseDestination(v)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := names[d.Name]; ok {
+			return nil, fmt.Errorf("duplicate destination %s", d.Name)
+		}
+		// иначе пакет недоступного сервера попадет в обе очереди
+		if c.SpoolDir != "" && d.SpoolDir != "" {
+			return nil, fmt.Errorf("destination %s: spool_dir can not be used with agent spool dir", d.Name)
+		}
+		names[d.Name] = struct{}{}
+		res = append(res, d)
+	}
+
+	return res, nil
+}
+
+// ForDestination returns copy of config pointing to the destination
+func (c *Config) ForDestination(d DestinationConfig) *Config {
+	res := *c
+	res.Address = d.Address
+	res.Protocol = string(d.Protocol)
+	res.Key = d.Key
+	res.CryptoKey = d.CryptoKey
+	res.GRPCStream = d.GRPCStream
+	res.SpoolDir = d.SpoolDir
+	res.Destinations = nil
+
+	return &res
+}
+
+// AutoConfigs returns configs of gRPC and HTTP transports of auto protocol,
+// gRPC server listens on the next port after HTTP one unless GRPCAddress is set
+func (c *Config) AutoConfigs() (grpcCfg *Config, httpCfg *Config, err error) {
+	address := c.GRPCAddress
+	if address == "" {
+		u, err := url.Parse(c.Address)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		port, err := strconv.Atoi(u.Port())
+		if err != nil {
+			return nil, nil, fmt.Errorf("bad address %s: %w", c.Address, err)
+		}
+		address = net.JoinHostPort(u.Hostname(), strconv.Itoa(port+1))
+	}
+
+	grpcCfg, httpCfg = new(Config), new(Config)
+	*grpcCfg, *httpCfg = *c, *c
+	grpcCfg.Protocol, grpcCfg.Address = string(GRPCProtocol), address
+	httpCfg.Protocol = string(HTTPProtocol)
+
+	return grpcCfg, httpCfg, nil
+}
+
+func splitList(value string) []string {
+	var res []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// setList overrides comma separated option with list from config file if it is set
+func setList(dst *string, list []string) {
+	if len(list) > 0 {
+		*dst = strings.Join(list, ",")
+	}
+}
+
+func joinCollectors(collectors map[string]string) (names string, intervals string) {
+	list := make([]string, 0, len(collectors))
+	for name := range collectors {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+
+	pairs := make([]string, 0, len(list))
+	for _, name := range list {
+		if collectors[name] != "" {
+			pairs = append(pairs, name+"="+collectors[name])
+		}
+	}
+
+	return strings.Join(list, ","), strings.Join(pairs, ",")
+}
@@ -27,6 +27,13 @@ func TestNewConfig(t *testing.T) {
 				Key:            "",
 				RateLimit:      1024,
 				Protocol:       "http",
+				Collectors:     "runtime,memory",
+				RuntimeMode:    "both",
+				SpoolMaxBytes:  64 << 20,
+				SpoolMaxAge:    86400,
+				FanoutMode:     "all",
+				ProtocolProbe:  60,
+				MaxBatchBytes:  1 << 20,
 			},
 		},
 	}
@@ -68,6 +75,63 @@ func Test_ConfigFile(t *testing.T) {
 	assert.Equal(t, int64(pi.Seconds()), cfg.PollInterval)
 }
 
+func TestConfig_EnabledCollectors(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		want    map[string]time.Duration
+		wantErr bool
+	}{
+		{
+			name: "poll interval by default",
+			cfg:  Config{PollInterval: 2, Collectors: "runtime, memory"},
+			want: map[string]time.Duration{"runtime": 2 * time.Second, "memory": 2 * time.Second},
+		},
+		{
+			name: "own interval",
+			cfg:  Config{PollInterval: 2, Collectors: "runtime,memory", CollectorIntervals: "memory=10s"},
+			want: map[string]time.Duration{"runtime": 2 * time.Second, "memory": 10 * time.Second},
+		},
+		{
+			name: "disabled",
+			cfg:  Config{PollInterval: 2, Collectors: ""},
+			want: map[string]time.Duration{},
+		},
+		{
+			name:    "bad interval",
+			cfg:     Config{PollInterval: 2, Collectors: "memory", CollectorIntervals: "memory=often"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cfg.EnabledCollectors()
+			assert.Equal(t, tt.wantErr, err != nil)
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_ConfigFileCollectors(t *testing.T) {
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	file, err := createConfigFile(&CfgFile{
+		Address:        "http://localhost:9080",
+		ReportInterval: "3s",
+		PollInterval:   "4s",
+		Collectors:     map[string]string{"runtime": "", "memory": "30s"},
+	})
+	assert.NoError(t, err)
+
+	t.Setenv("CONFIG", file)
+
+	cfg, err := NewConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "memory,runtime", cfg.Collectors)
+	assert.Equal(t, "memory=30s", cfg.CollectorIntervals)
+}
+
 func createConfigFile(cfg *CfgFile) (string, error) {
 	buf, err := json.Marshal(cfg)
 	if err != nil {
@@ -86,3 +150,78 @@ func createConfigFile(cfg *CfgFile) (string, error) {
 
 	return file.Name(), nil
 }
+
+func TestParseDestination(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    DestinationConfig
+		wantErr bool
+	}{
+		{
+			value: "http://localhost:8080/?key=secret&crypto_key=/etc/agent/public.pem&spool_dir=/var/spool/main",
+			want: DestinationConfig{Name: "localhost:8080", Protocol: HTTPProtocol, Address: "http://localhost:8080",
+				Key: "secret", CryptoKey: "/etc/agent/public.pem", SpoolDir: "/var/spool/main"},
+		},
+		{
+			value: "grpc://metrics:3200?name=backup&stream=true",
+			want:  DestinationConfig{Name: "backup", Protocol: GRPCProtocol, Address: "metrics:3200", GRPCStream: true},
+		},
+		{value: "grpc://metrics:3200?stream=often", wantErr: true},
+		{value: "ftp://metrics:21", wantErr: true},
+		{value: "localhost:8080", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseDestination(tt.value)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestConfig_DestinationConfigs(t *testing.T) {
+	cfg := Config{FanoutMode: FanoutAll, Destinations: []string{"http://localhost:8080", "grpc://localhost:3200"}}
+	list, err := cfg.DestinationConfigs()
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	dcfg := cfg.ForDestination(list[1])
+	assert.Equal(t, "grpc", dcfg.Protocol)
+	assert.Equal(t, "localhost:3200", dcfg.Address)
+	assert.Empty(t, dcfg.Destinations)
+
+	cfg.Destinations = append(cfg.Destinations, "http://localhost:8080/")
+	_, err = cfg.DestinationConfigs()
+	assert.Error(t, err)
+
+	cfg = Config{FanoutMode: "some", Destinations: []string{"http://localhost:8080"}}
+	_, err = cfg.DestinationConfigs()
+	assert.Error(t, err)
+
+	// пакет не должен откладываться дважды
+	cfg = Config{FanoutMode: FanoutAll, SpoolDir: "/var/spool/agent",
+		Destinations: []string{"http://localhost:8080?spool_dir=/var/spool/backup"}}
+	_, err = cfg.DestinationConfigs()
+	assert.Error(t, err)
+}
+
+func TestConfig_AutoConfigs(t *testing.T) {
+	cfg := Config{Protocol: "auto", Address: "http://localhost:8080", Key: "secret"}
+
+	grpcCfg, httpCfg, err := cfg.AutoConfigs()
+	assert.NoError(t, err)
+	assert.Equal(t, "grpc", grpcCfg.Protocol)
+	assert.Equal(t, "localhost:8081", grpcCfg.Address)
+	assert.Equal(t, "secret", grpcCfg.Key)
+	assert.Equal(t, "http", httpCfg.Protocol)
+	assert.Equal(t, "http://localhost:8080", httpCfg.Address)
+
+	cfg.GRPCAddress = "metrics:3200"
+	grpcCfg, _, err = cfg.AutoConfigs()
+	assert.NoError(t, err)
+	assert.Equal(t, "metrics:3200", grpcCfg.Address)
+
+	cfg = Config{Protocol: "auto", Address: "http://localhost"}
+	_, _, err = cfg.AutoConfigs()
+	assert.Error(t, err)
+}
@@ -0,0 +1,183 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/agent/collector"
+	"github.com/nbvehbq/go-metrics-harvester/internal/logger"
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const TransportName = "transport"
+
+// probeTimeout - сколько ждать ответа на пробу основного транспорта
+const probeTimeout = 2 * time.Second
+
+// Prober - транспорт, доступность которого проверяется дешевым запросом
+type Prober interface {
+	Probe(ctx context.Context) error
+}
+
+// Transport - клиент сервера по одному из протоколов
+type Transport struct {
+	Protocol  Protocol
+	Publisher Publisher
+}
+
+// Fallback - Publisher протокола auto: отправляет через основной транспорт,
+// при ошибке переключается на запасной и время от времени пробует вернуться
+type Fallback struct {
+	primary  Transport
+	fallback Transport
+	probe    time.Duration
+	interval time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	degraded  bool      // отправка идет через запасной транспорт
+	nextProbe time.Time // когда снова попробовать основной
+	switches  int64
+}
+
+// NewFallback creates publisher preferring primary transport,
+// primary is probed every probe interval while fallback is active
+func NewFallback(primary, fallback Transport, probe, interval time.Duration) *Fallback {
+	return &Fallback{primary: primary, fallback: fallback, probe: probe, interval: interval, now: time.Now}
+}
+
+// Publish sends batch via active transport, the batch failed on primary is sent via fallback
+// with the same batch id. Batch rejected by primary as invalid is not resent
+func (f *Fallback) Publish(ctx context.Context, m []metric.Metric) error {
+	var err error
+	if f.tryPrimary(ctx) {
+		err = f.primary.Publisher.Publish(ctx, m)
+		if permanent(err) {
+			// сервер ответил и отклонил пакет, запасной транспорт отклонит его так же
+			f.primaryResult(nil)
+			return errors.Wrapf(err, "primary %s", f.primary.Protocol)
+		}
+		f.primaryResult(err)
+		if err == nil {
+			return nil
+		}
+		logger.Log.Warn("publish, falling back",
+			zap.String("protocol", string(f.fallback.Protocol)), zap.Error(err))
+	}
+
+	// по запасному протоколу уходят только недоставленные части пакета
+	batch := metric.Chunk{BatchID: metric.BatchID(ctx), Metrics: m}
+	if err := metric.Resend(ctx, batch, err, f.fallback.Publisher.Publish); err != nil {
+		return errors.Wrapf(err, "fallback %s", f.fallback.Protocol)
+	}
+
+	return nil
+}
+
+// tryPrimary reports whether batch should go via primary transport.
+// While fallback is active primary implementing Prober is probed first,
+// so the batch does not wait for retries of unavailable server
+func (f *Fallback) tryPrimary(ctx context.Context) bool {
+	f.mu.Lock()
+	degraded, due := f.degraded, !f.now().Before(f.nextProbe)
+	f.mu.Unlock()
+
+	if !degraded {
+		return true
+	}
+	if !due {
+		return false
+	}
+
+	p, ok := f.primary.Publisher.(Prober)
+	if !ok {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	if err := p.Probe(ctx); err != nil {
+		f.primaryResult(err)
+		logger.Log.Debug("publish, primary transport is still down",
+			zap.String("protocol", string(f.primary.Protocol)), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func (f *Fallback) primaryResult(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err == nil {
+		if f.degraded {
+			f.degraded = false
+			f.switches++
+			logger.Log.Info("publish, primary transport is back", zap.String("protocol", string(f.primary.Protocol)))
+		}
+		return
+	}
+
+	if !f.degraded {
+		f.degraded = true
+		f.switches++
+	}
+	f.nextProbe = f.now().Add(f.probe)
+}
+
+// Active returns protocol used for publishing now
+func (f *Fallback) Active() Protocol {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.degraded {
+		return f.fallback.Protocol
+	}
+	return f.primary.Protocol
+}
+
+// Collectors returns collector reporting the active transport
+func (f *Fallback) Collectors() []collector.Collector {
+	return []collector.Collector{f}
+}
+
+func (f *Fallback) Name() string {
+	return TransportName
+}
+
+func (f *Fallback) Interval() time.Duration {
+	return f.interval
+}
+
+// Collect returns 1 for the active transport and 0 for the other one
+func (f *Fallback) Collect(_ context.Context) ([]metric.Metric, error) {
+	active := f.Active()
+
+	f.mu.Lock()
+	switches := f.switches
+	f.switches = 0
+	f.mu.Unlock()
+
+	res := make([]metric.Metric, 0, 3)
+	for _, t := range []Transport{f.primary, f.fallback} {
+		var v float64
+		if t.Protocol == active {
+			v = 1
+		}
+		res = append(res, metric.Metric{ID: "Transport", MType: metric.Gauge, Value: &v,
+			Labels: metric.Labels{"protocol": string(t.Protocol)}})
+	}
+	res = append(res, metric.Metric{ID: "TransportSwitches", MType: metric.Counter, Delta: &switches})
+
+	return res, nil
+}
+
+// Close closes both transports
+func (f *Fallback) Close() error {
+	return closePublishers(f.primary.Publisher, f.fallback.Publisher)
+}
@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/nbvehbq/go-metrics-harvester/internal/agent/mocks"
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/nbvehbq/go-metrics-harvester/pkg/retry"
+	"github.com/stretchr/testify/assert"
+)
+
+func transportValues(t *testing.T, f *Fallback) map[string]float64 {
+	t.Helper()
+
+	list, err := f.Collect(context.Background())
+	assert.NoError(t, err)
+
+	res := make(map[string]float64, len(list))
+	for _, m := range list {
+		if m.MType == metric.Counter {
+			res[m.Key()] = float64(*m.Delta)
+			continue
+		}
+		res[m.Key()] = *m.Value
+	}
+
+	return res
+}
+
+func TestFallback_Publish(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	grpc := mocks.NewMockPublisher(ctrl)
+	http := mocks.NewMockPublisher(ctrl)
+
+	now := time.Unix(1700000000, 0)
+	f := NewFallback(
+		Transport{Protocol: GRPCProtocol, Publisher: grpc},
+		Transport{Protocol: HTTPProtocol, Publisher: http},
+		time.Minute, time.Second,
+	)
+	f.now = func() time.Time { return now }
+	ctx := metric.WithBatchID(context.Background(), "batch-1")
+
+	grpc.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(nil)
+	assert.NoError(t, f.Publish(ctx, batch("one")))
+	assert.Equal(t, GRPCProtocol, f.Active())
+
+	// пакет, не принятый по gRPC, уходит по HTTP с тем же идентификатором
+	grpc.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(errDown)
+	http.EXPECT().Publish(gomock.Any(), batch("two")).
+		DoAndReturn(func(ctx context.Context, _ []metric.Metric) error {
+			assert.Equal(t, "batch-1", metric.BatchID(ctx))
+			return nil
+		})
+	assert.NoError(t, f.Publish(ctx, batch("two")))
+	assert.Equal(t, HTTPProtocol, f.Active())
+
+	assert.Equal(t, map[string]float64{
+		`Transport{protocol="grpc"}`: 0,
+		`Transport{protocol="http"}`: 1,
+		"TransportSwitches":          1,
+	}, transportValues(t, f))
+
+	// до следующей пробы gRPC не используется
+	now = now.Add(30 * time.Second)
+	http.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(nil)
+	assert.NoError(t, f.Publish(ctx, batch("three")))
+
+	now = now.Add(30 * time.Second)
+	grpc.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(errDown)
+	http.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(errDown)
+	assert.ErrorIs(t, f.Publish(ctx, batch("four")), errDown)
+	assert.Equal(t, HTTPProtocol, f.Active())
+
+	now = now.Add(time.Minute)
+	grpc.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(nil)
+	assert.NoError(t, f.Publish(ctx, batch("five")))
+	assert.Equal(t, GRPCProtocol, f.Active())
+
+	assert.Equal(t, map[string]float64{
+		`Transport{protocol="grpc"}`: 1,
+		`Transport{protocol="http"}`: 0,
+		"TransportSwitches":          1,
+	}, transportValues(t, f))
+}
+
+// probingPublisher - транспорт с дешевой проверкой доступности
+type probingPublisher struct {
+	*mocks.MockPublisher
+	*mocks.MockProber
+}
+
+func TestFallback_Probe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	grpc := mocks.NewMockPublisher(ctrl)
+	prober := mocks.NewMockProber(ctrl)
+	http := mocks.NewMockPublisher(ctrl)
+
+	now := time.Unix(1700000000, 0)
+	f := NewFallback(
+		Transport{Protocol: GRPCProtocol, Publisher: probingPublisher{grpc, prober}},
+		Transport{Protocol: HTTPProtocol, Publisher: http},
+		time.Minute, time.Second,
+	)
+	f.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	grpc.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(errDown)
+	http.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(nil)
+	assert.NoError(t, f.Publish(ctx, batch("one")))
+	assert.Equal(t, HTTPProtocol, f.Active())
+
+	// пакет не отправляется через недоступный основной транспорт, только проба
+	now = now.Add(time.Minute)
+	prober.EXPECT().Probe(gomock.Any()).
+		DoAndReturn(func(ctx context.Context) error {
+			_, ok := ctx.Deadline()
+			assert.True(t, ok)
+			return errDown
+		})
+	http.EXPECT().Publish(gomock.Any(), batch("two")).Return(nil)
+	assert.NoError(t, f.Publish(ctx, batch("two")))
+	assert.Equal(t, HTTPProtocol, f.Active())
+
+	// до следующей пробы основной транспорт не проверяется
+	http.EXPECT().Publish(gomock.Any(), batch("three")).Return(nil)
+	assert.NoError(t, f.Publish(ctx, batch("three")))
+
+	now = now.Add(time.Minute)
+	prober.EXPECT().Probe(gomock.Any()).Return(nil)
+	grpc.EXPECT().Publish(gomock.Any(), batch("four")).Return(nil)
+	assert.NoError(t, f.Publish(ctx, batch("four")))
+	assert.Equal(t, GRPCProtocol, f.Active())
+}
+
+func TestFallback_PublishRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	grpc := mocks.NewMockPublisher(ctrl)
+	http := mocks.NewMockPublisher(ctrl)
+
+	f := NewFallback(
+		Transport{Protocol: GRPCProtocol, Publisher: grpc},
+		Transport{Protocol: HTTPProtocol, Publisher: http},
+		time.Minute, time.Second,
+	)
+	ctx := context.Background()
+
+	// отклоненный пакет не уходит по HTTP, gRPC остается основным
+	grpc.EXPECT().Publish(gomock.Any(), batch("one")).Return(retry.Permanent(errDown))
+	err := f.Publish(ctx, batch("one"))
+	assert.ErrorIs(t, err, errDown)
+	var pe *retry.PermanentError
+	assert.ErrorAs(t, err, &pe)
+	assert.Equal(t, GRPCProtocol, f.Active())
+
+	grpc.EXPECT().Publish(gomock.Any(), batch("two")).Return(nil)
+	assert.NoError(t, f.Publish(ctx, batch("two")))
+	assert.Equal(t, float64(0), transportValues(t, f)["TransportSwitches"])
+}
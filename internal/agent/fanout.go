@@ -0,0 +1,273 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/agent/collector"
+	"github.com/nbvehbq/go-metrics-harvester/internal/logger"
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"go.uber.org/zap"
+)
+
+// Режимы отправки на несколько серверов
+const (
+	FanoutAll      = "all"      // пакет должны принять все серверы
+	FanoutAny      = "any"      // достаточно одного сервера
+	FanoutFailover = "failover" // серверы пробуются по порядку, до первого принявшего
+)
+
+// Destination - сервер, на который отправляются пакеты. Spool - необязательная очередь
+// неотправленных пакетов этого сервера
+type Destination struct {
+	Name      string
+	Publisher Publisher
+	Spool     *Spool
+}
+
+// fanoutBatches - сколько недоставленных пакетов помнит Fanout
+const fanoutBatches = 1024
+
+// Fanout - Publisher, который отправляет пакет на несколько серверов
+type Fanout struct {
+	mode         string
+	destinations []Destination
+
+	// accepted - серверы, принявшие пакет, который еще не приняли остальные;
+	// повторная отправка пакета с тем же идентификатором их пропускает
+	mu       sync.Mutex
+	accepted map[string][]bool
+	order    []string
+}
+
+// NewFanout creates composite publisher, destinations are ordered by priority
+func NewFanout(mode string, destinations []Destination) (*Fanout, error) {
+	switch mode {
+	case FanoutAll, FanoutAny, FanoutFailover:
+	default:
+		return nil, fmt.Errorf("unknown fanout mode %q", mode)
+	}
+
+	if len(destinations) == 0 {
+		return nil, errors.New("no destinations")
+	}
+
+	return &Fanout{mode: mode, destinations: destinations, accepted: make(map[string][]bool)}, nil
+}
+
+// Publish sends batch according to the mode, batch spooled by destination counts as delivered to it
+func (f *Fanout) Publish(ctx context.Context, m []metric.Metric) error {
+	if f.mode == FanoutFailover {
+		return f.failover(ctx, m)
+	}
+
+	id := metric.BatchID(ctx)
+	accepted := f.acceptedBy(id)
+
+	errs := make([]error, len(f.destinations))
+
+	var wg sync.WaitGroup
+	for i, d := range f.destinations {
+		if accepted[i] {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = f.deliver(ctx, d, m, true)
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+
+	if failed == 0 || (f.mode == FanoutAny && failed < len(f.destinations)) {
+		for _, err := range errs {
+			if err != nil {
+				logger.Log.Warn("publish", zap.Error(err))
+			}
+		}
+		f.forget(id)
+		return nil
+	}
+	f.remember(id, errs)
+
+	return batchError{errors.Join(errs...)}
+}
+
+// acceptedBy returns destinations which accepted batch before
+func (f *Fanout) acceptedBy(id string) []bool {
+	res := make([]bool, len(f.destinations))
+	if id == "" {
+		return res
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	copy(res, f.accepted[id])
+
+	return res
+}
+
+// remember marks destinations which accepted batch, the oldest batches are forgotten
+func (f *Fanout) remember(id string, errs []error) {
+	if id == "" {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	accepted, ok := f.accepted[id]
+	if !ok {
+		accepted = make([]bool, len(f.destinations))
+		f.order = append(f.order, id)
+	}
+	for i, err := range errs {
+		if err == nil {
+			accepted[i] = true
+		}
+	}
+	f.accepted[id] = accepted
+
+	for len(f.order) > fanoutBatches {
+		delete(f.accepted, f.order[0])
+		f.order = f.order[1:]
+	}
+}
+
+func (f *Fanout) forget(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.accepted[id]; !ok {
+		return
+	}
+	delete(f.accepted, id)
+	f.order = slices.DeleteFunc(f.order, func(v string) bool { return v == id })
+}
+
+// batchError hides partial delivery of chunks: in all and any modes the batch is
+// delivered to some destinations only and must be sent again as a whole,
+// destinations which accepted it are skipped then
+type batchError struct {
+	err error
+}
+
+func (e batchError) Error() string {
+	return e.err.Error()
+}
+
+func (e batchError) Is(target error) bool {
+	return errors.Is(e.err, target)
+}
+
+// failover tries destinations in order, the next destination gets chunks of batch
+// not delivered by previous ones, if all of them fail the rest is spooled
+// by the first destination having a spool
+func (f *Fanout) failover(ctx context.Context, m []metric.Metric) error {
+	batch := metric.Chunk{BatchID: metric.BatchID(ctx), Metrics: m}
+
+	var err error
+	errs := make([]error, 0, len(f.destinations))
+	for _, d := range f.destinations {
+		err = metric.Resend(ctx, batch, err, func(ctx context.Context, m []metric.Metric) error {
+			return f.deliver(ctx, d, m, false)
+		})
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	// последняя ошибка первой: в ней учтены части, доставленные всеми серверами
+	slices.Reverse(errs)
+
+	for _, d := range f.destinations {
+		if d.Spool == nil {
+			continue
+		}
+		if err := d.Spool.PushChunks(metric.Undelivered(batch, err)); err != nil {
+			errs = append(errs, fmt.Errorf("destination %s: spool: %w", d.Name, err))
+			break
+		}
+		logger.Log.Warn("publish, batch spooled", zap.String("destination", d.Name), zap.Error(errors.Join(errs...)))
+		return nil
+	}
+
+	return errors.Join(errs...)
+}
+
+// deliver sends spooled batches of destination and then the batch itself,
+// with spool set undelivered chunks of the batch are spooled
+func (f *Fanout) deliver(ctx context.Context, d Destination, m []metric.Metric, spool bool) error {
+	batch := metric.Chunk{BatchID: metric.BatchID(ctx), Metrics: m}
+	chunks := []metric.Chunk{batch}
+
+	var err error
+	if d.Spool != nil {
+		if err = d.Spool.Replay(ctx, d.Publisher.Publish); err != nil {
+			// ошибка относится к пакету из очереди, а не к текущему
+			err = fmt.Errorf("spool replay: %v", err)
+		}
+	}
+	if err == nil {
+		err = d.Publisher.Publish(ctx, m)
+		chunks = metric.Undelivered(batch, err)
+	}
+	if err == nil {
+		return nil
+	}
+
+	if spool && d.Spool != nil {
+		if spoolErr := d.Spool.PushChunks(chunks); spoolErr == nil {
+			logger.Log.Warn("publish, batch spooled", zap.String("destination", d.Name), zap.Error(err))
+			return nil
+		}
+	}
+
+	return fmt.Errorf("destination %s: %w", d.Name, err)
+}
+
+// Collectors returns spools of destinations to expose their metrics
+func (f *Fanout) Collectors() []collector.Collector {
+	var res []collector.Collector
+	for _, d := range f.destinations {
+		if d.Spool != nil {
+			res = append(res, d.Spool)
+		}
+	}
+
+	return res
+}
+
+// Close closes publishers of destinations
+func (f *Fanout) Close() error {
+	list := make([]Publisher, 0, len(f.destinations))
+	for _, d := range f.destinations {
+		list = append(list, d.Publisher)
+	}
+
+	return closePublishers(list...)
+}
+
+// closePublishers closes publishers holding connections
+func closePublishers(list ...Publisher) error {
+	var errs []error
+	for _, p := range list {
+		if c, ok := p.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+
+	return errors.Join(errs...)
+}
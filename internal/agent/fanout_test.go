@@ -0,0 +1,170 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/nbvehbq/go-metrics-harvester/internal/agent/mocks"
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+var errDown = errors.New("server is down")
+
+func TestNewFanout(t *testing.T) {
+	_, err := NewFanout("some", []Destination{{Name: "one"}})
+	assert.Error(t, err)
+
+	_, err = NewFanout(FanoutAll, nil)
+	assert.Error(t, err)
+}
+
+func TestFanout_Publish(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		results []error // результат отправки на каждый сервер, nil - сервер не вызывается
+		calls   []int
+		wantErr bool
+	}{
+		{name: "all succeed", mode: FanoutAll, results: []error{nil, nil}, calls: []int{1, 1}},
+		{name: "all, one fails", mode: FanoutAll, results: []error{nil, errDown}, calls: []int{1, 1}, wantErr: true},
+		{name: "any, one fails", mode: FanoutAny, results: []error{errDown, nil}, calls: []int{1, 1}},
+		{name: "any, all fail", mode: FanoutAny, results: []error{errDown, errDown}, calls: []int{1, 1}, wantErr: true},
+		{name: "failover, primary is up", mode: FanoutFailover, results: []error{nil, nil}, calls: []int{1, 0}},
+		{name: "failover, primary is down", mode: FanoutFailover, results: []error{errDown, nil}, calls: []int{1, 1}},
+		{name: "failover, all down", mode: FanoutFailover, results: []error{errDown, errDown}, calls: []int{1, 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			destinations := make([]Destination, 0, len(tt.results))
+			for i, res := range tt.results {
+				p := mocks.NewMockPublisher(ctrl)
+				p.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(res).Times(tt.calls[i])
+				destinations = append(destinations, Destination{Name: string(rune('a' + i)), Publisher: p})
+			}
+
+			f, err := NewFanout(tt.mode, destinations)
+			assert.NoError(t, err)
+
+			err = f.Publish(context.Background(), batch("PollCount"))
+			assert.Equal(t, tt.wantErr, err != nil)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, errDown)
+			}
+		})
+	}
+}
+
+func TestFanout_Resend(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	primary := mocks.NewMockPublisher(ctrl)
+	backup := mocks.NewMockPublisher(ctrl)
+
+	f, err := NewFanout(FanoutAll, []Destination{
+		{Name: "primary", Publisher: primary},
+		{Name: "backup", Publisher: backup},
+	})
+	assert.NoError(t, err)
+
+	ctx := metric.WithBatchID(context.Background(), "batch")
+	primary.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(nil)
+	backup.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(errDown)
+	assert.ErrorIs(t, f.Publish(ctx, batch("one")), errDown)
+
+	// принявший пакет сервер не получает его повторно
+	backup.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(nil)
+	assert.NoError(t, f.Publish(ctx, batch("one")))
+	assert.Empty(t, f.accepted)
+
+	primary.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(nil)
+	backup.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(nil)
+	assert.NoError(t, f.Publish(ctx, batch("one")))
+}
+
+func TestFanout_Spool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	primary := mocks.NewMockPublisher(ctrl)
+	backup := mocks.NewMockPublisher(ctrl)
+
+	spool, err := NewDestinationSpool("backup", t.TempDir(), 0, 0, time.Second)
+	assert.NoError(t, err)
+
+	f, err := NewFanout(FanoutAll, []Destination{
+		{Name: "primary", Publisher: primary},
+		{Name: "backup", Publisher: backup, Spool: spool},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, f.Collectors(), 1)
+	assert.Equal(t, "spool.backup", f.Collectors()[0].Name())
+
+	// недоступный сервер с очередью не мешает остальным
+	primary.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(nil)
+	backup.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(errDown)
+	assert.NoError(t, f.Publish(context.Background(), batch("one")))
+	assert.Equal(t, 1, spool.Len())
+
+	primary.EXPECT().Publish(gomock.Any(), batch("two")).Return(nil)
+	gomock.InOrder(
+		backup.EXPECT().Publish(gomock.Any(), batch("one")).Return(nil),
+		backup.EXPECT().Publish(gomock.Any(), batch("two")).Return(nil),
+	)
+	assert.NoError(t, f.Publish(context.Background(), batch("two")))
+	assert.Equal(t, 0, spool.Len())
+}
+
+func TestFanout_FailoverSpool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	primary := mocks.NewMockPublisher(ctrl)
+	backup := mocks.NewMockPublisher(ctrl)
+
+	spool, err := NewDestinationSpool("primary", t.TempDir(), 0, 0, time.Second)
+	assert.NoError(t, err)
+
+	f, err := NewFanout(FanoutFailover, []Destination{
+		{Name: "primary", Publisher: primary, Spool: spool},
+		{Name: "backup", Publisher: backup},
+	})
+	assert.NoError(t, err)
+
+	// пакет откладывается, только если недоступны все серверы
+	primary.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(errDown)
+	backup.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(nil)
+	assert.NoError(t, f.Publish(context.Background(), batch("one")))
+	assert.Equal(t, 0, spool.Len())
+
+	primary.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(errDown)
+	backup.EXPECT().Publish(gomock.Any(), gomock.Any()).Return(errDown)
+	assert.NoError(t, f.Publish(context.Background(), batch("two")))
+	assert.Equal(t, 1, spool.Len())
+
+	assert.Equal(t, [][]string{{"two"}}, spoolIDs(t, spool))
+
+	// следующий сервер получает только недоставленные части пакета
+	ctx := metric.WithBatchID(context.Background(), "b")
+	primary.EXPECT().Publish(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, m []metric.Metric) error {
+			chunks := metric.SplitBatch("b", m, 1, 0, nil)
+			return &metric.ChunkError{Chunks: chunks, Errs: []error{nil, errDown, errDown}}
+		})
+	backup.EXPECT().Publish(gomock.Any(), batch("four")).
+		DoAndReturn(func(ctx context.Context, _ []metric.Metric) error {
+			assert.Equal(t, "b-1", metric.BatchID(ctx))
+			return nil
+		})
+	backup.EXPECT().Publish(gomock.Any(), batch("five")).Return(errDown)
+	assert.NoError(t, f.Publish(ctx, batch("three", "four", "five")))
+	assert.Equal(t, [][]string{{"five"}}, spoolIDs(t, spool))
+}
@@ -0,0 +1,296 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/logger"
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/nbvehbq/go-metrics-harvester/pkg/retry"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	SpoolName = "spool"
+
+	spoolExt = ".json"
+)
+
+// spoolEntry - неотправленный пакет на диске, идентификатор пакета хранится в имени файла
+type spoolEntry struct {
+	seq      uint64
+	batchID  string
+	path     string
+	size     int64
+	modified time.Time
+}
+
+// Spool - очередь неотправленных пакетов в каталоге, по файлу на пакет.
+// Старые пакеты вытесняются при превышении размера и удаляются по возрасту
+type Spool struct {
+	// destination - сервер, для которого очередь, если серверов несколько
+	destination string
+
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+	interval time.Duration
+	now      func() time.Time
+
+	// replay - отправка очереди, идет без mu, чтобы не блокировать Push
+	replay  sync.Mutex
+	mu      sync.Mutex
+	entries []spoolEntry
+	bytes   int64
+	seq     uint64
+	dropped int64
+}
+
+// NewSpool opens spool directory, batches left by previous run are kept
+func NewSpool(dir string, maxBytes int64, maxAge, interval time.Duration) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, errors.Wrap(err, "spool dir")
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "spool dir")
+	}
+
+	s := &Spool{dir: dir, maxBytes: maxBytes, maxAge: maxAge, interval: interval, now: time.Now}
+	for _, f := range files {
+		name, batchID, _ := strings.Cut(strings.TrimSuffix(f.Name(), spoolExt), "-")
+		seq, err := strconv.ParseUint(name, 10, 64)
+		if f.IsDir() || !strings.HasSuffix(f.Name(), spoolExt) || err != nil {
+			continue
+		}
+
+		info, err := f.Info()
+		if err != nil {
+			return nil, errors.Wrap(err, "spool entry")
+		}
+
+		s.entries = append(s.entries, spoolEntry{
+			seq:      seq,
+			batchID:  batchID,
+			path:     filepath.Join(dir, f.Name()),
+			size:     info.Size(),
+			modified: info.ModTime(),
+		})
+		s.bytes += info.Size()
+		s.seq = max(s.seq, seq)
+	}
+	sort.Slice(s.entries, func(i, j int) bool { return s.entries[i].seq < s.entries[j].seq })
+
+	return s, nil
+}
+
+// NewDestinationSpool opens spool of one of fan-out destinations,
+// its metrics are labeled by destination name
+func NewDestinationSpool(name, dir string, maxBytes int64, maxAge, interval time.Duration) (*Spool, error) {
+	s, err := NewSpool(dir, maxBytes, maxAge, interval)
+	if err != nil {
+		return nil, err
+	}
+	s.destination = name
+
+	return s, nil
+}
+
+// Len returns number of spooled batches
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.entries)
+}
+
+// Push persists batch with its id, the oldest batches are dropped to fit into size limit
+func (s *Spool) Push(batchID string, batch []metric.Metric) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf, err := json.Marshal(batch)
+	if err != nil {
+		return errors.Wrap(err, "marshal")
+	}
+
+	s.seq++
+	name := fmt.Sprintf("%020d", s.seq)
+	if batchID != "" {
+		name += "-" + batchID
+	}
+	e := spoolEntry{
+		seq:      s.seq,
+		batchID:  batchID,
+		path:     filepath.Join(s.dir, name+spoolExt),
+		size:     int64(len(buf)),
+		modified: s.now(),
+	}
+
+	// через временный файл, чтобы после сбоя не остался обрезанный пакет
+	tmp := e.path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0o600); err != nil {
+		return errors.Wrap(err, "spool write")
+	}
+	if err := os.Rename(tmp, e.path); err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "spool write")
+	}
+
+	s.entries = append(s.entries, e)
+	s.bytes += e.size
+
+	for s.maxBytes > 0 && s.bytes > s.maxBytes && len(s.entries) > 1 {
+		s.drop()
+	}
+
+	return nil
+}
+
+// PushChunks spools every chunk with its batch id
+func (s *Spool) PushChunks(chunks []metric.Chunk) error {
+	for _, c := range chunks {
+		if err := s.Push(c.BatchID, c.Metrics); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Replay publishes spooled batches from the oldest one with their ids, it stops on the first failure.
+// Batches older than max age or rejected by server are dropped. Batches pushed during replay are sent by the next one
+func (s *Spool) Replay(ctx context.Context, publish func(ctx context.Context, m []metric.Metric) error) error {
+	s.replay.Lock()
+	defer s.replay.Unlock()
+
+	s.mu.Lock()
+	entries := slices.Clone(s.entries)
+	s.mu.Unlock()
+
+	for _, e := range entries {
+		if s.maxAge > 0 && s.now().Sub(e.modified) > s.maxAge {
+			s.discard(e, true)
+			continue
+		}
+
+		buf, err := os.ReadFile(e.path)
+		if errors.Is(err, os.ErrNotExist) {
+			// пакет уже вытеснен более новыми
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, "spool read")
+		}
+
+		var batch []metric.Metric
+		if err := json.Unmarshal(buf, &batch); err != nil {
+			// испорченный пакет не должен останавливать очередь
+			s.discard(e, true)
+			continue
+		}
+
+		if err := publish(metric.WithBatchID(ctx, e.batchID), batch); err != nil {
+			if permanent(err) {
+				// повтор даст тот же результат, пакет не должен задерживать очередь
+				logger.Log.Warn("spool, batch rejected", zap.String("batch", e.batchID), zap.Error(err))
+				s.discard(e, true)
+				continue
+			}
+			return err
+		}
+		s.discard(e, false)
+	}
+
+	return nil
+}
+
+// permanent reports whether server rejected batch and sending it again does not help,
+// partially delivered batch is rejected when every failed chunk is rejected
+func permanent(err error) bool {
+	var ce *metric.ChunkError
+	if errors.As(err, &ce) {
+		for _, err := range ce.Errs {
+			if err != nil && !permanent(err) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var pe *retry.PermanentError
+	return errors.As(err, &pe)
+}
+
+// discard removes batch unless it was already removed, lost batch is counted as dropped
+func (s *Spool) discard(e spoolEntry, lost bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.entries, func(v spoolEntry) bool { return v.seq == e.seq })
+	if i < 0 {
+		return
+	}
+
+	if lost {
+		s.dropped++
+	}
+	os.Remove(e.path)
+	s.entries = slices.Delete(s.entries, i, i+1)
+	s.bytes -= e.size
+}
+
+// drop removes the oldest batch counting it as lost
+func (s *Spool) drop() {
+	s.dropped++
+	s.remove()
+}
+
+func (s *Spool) remove() {
+	e := s.entries[0]
+	os.Remove(e.path)
+	s.entries = s.entries[1:]
+	s.bytes -= e.size
+}
+
+func (s *Spool) Name() string {
+	if s.destination != "" {
+		return SpoolName + "." + s.destination
+	}
+	return SpoolName
+}
+
+func (s *Spool) Interval() time.Duration {
+	return s.interval
+}
+
+// Collect returns spool depth and batches dropped since previous poll
+func (s *Spool) Collect(_ context.Context) ([]metric.Metric, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batches, size, dropped := float64(len(s.entries)), float64(s.bytes), s.dropped
+	s.dropped = 0
+
+	var labels metric.Labels
+	if s.destination != "" {
+		labels = metric.Labels{"destination": s.destination}
+	}
+
+	return []metric.Metric{
+		{ID: "SpoolBatches", MType: metric.Gauge, Value: &batches, Labels: labels},
+		{ID: "SpoolBytes", MType: metric.Gauge, Value: &size, Labels: labels},
+		{ID: "SpoolDropped", MType: metric.Counter, Delta: &dropped, Labels: labels},
+	}, nil
+}
@@ -0,0 +1,242 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/nbvehbq/go-metrics-harvester/internal/agent/mocks"
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/nbvehbq/go-metrics-harvester/pkg/retry"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+func batch(ids ...string) []metric.Metric {
+	res := make([]metric.Metric, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, metric.Metric{ID: id, MType: metric.Counter, Delta: ptr[int64](1)})
+	}
+
+	return res
+}
+
+func spoolIDs(t *testing.T, s *Spool) [][]string {
+	t.Helper()
+
+	var res [][]string
+	err := s.Replay(context.Background(), func(_ context.Context, m []metric.Metric) error {
+		var ids []string
+		for _, v := range m {
+			ids = append(ids, v.ID)
+		}
+		res = append(res, ids)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	return res
+}
+
+func TestSpool_Replay(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSpool(dir, 0, 0, time.Second)
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Push("", batch("one")))
+	assert.NoError(t, s.Push("", batch("two", "three")))
+
+	// неудачная отправка оставляет пакеты в очереди
+	errDown := errors.New("server is down")
+	err = s.Replay(context.Background(), func(context.Context, []metric.Metric) error { return errDown })
+	assert.ErrorIs(t, err, errDown)
+	assert.Equal(t, 2, s.Len())
+
+	// пакеты переживают перезапуск агента вместе с идентификатором
+	s, err = NewSpool(dir, 0, 0, time.Second)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Push("batch-4", batch("four")))
+
+	s, err = NewSpool(dir, 0, 0, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "batch-4", s.entries[2].batchID)
+
+	assert.Equal(t, [][]string{{"one"}, {"two", "three"}, {"four"}}, spoolIDs(t, s))
+	assert.Equal(t, 0, s.Len())
+
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestSpool_ReplayUnlocked(t *testing.T) {
+	s, err := NewSpool(t.TempDir(), 0, 0, time.Second)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Push("", batch("one")))
+
+	// очередь доступна во время отправки, новый пакет остается до следующей отправки
+	err = s.Replay(context.Background(), func(context.Context, []metric.Metric) error {
+		assert.Equal(t, 1, s.Len())
+		return s.Push("", batch("two"))
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"two"}}, spoolIDs(t, s))
+}
+
+func TestSpool_ReplayRejected(t *testing.T) {
+	s, err := NewSpool(t.TempDir(), 0, 0, time.Second)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Push("", batch("bad")))
+	assert.NoError(t, s.Push("", batch("one")))
+
+	// отклоненный сервером пакет отбрасывается и не задерживает остальные
+	var sent []string
+	err = s.Replay(context.Background(), func(_ context.Context, m []metric.Metric) error {
+		if m[0].ID == "bad" {
+			return retry.Permanent(errors.New("bad request"))
+		}
+		sent = append(sent, m[0].ID)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"one"}, sent)
+	assert.Equal(t, 0, s.Len())
+
+	list, err := s.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), *list[2].Delta)
+}
+
+func TestSpool_Limits(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	// в 150 байт помещаются три пакета
+	s, err := NewSpool(t.TempDir(), 150, time.Hour, time.Second)
+	assert.NoError(t, err)
+	s.now = func() time.Time { return now }
+
+	for _, id := range []string{"one", "two", "three", "four"} {
+		assert.NoError(t, s.Push("", batch(id)))
+	}
+	assert.Equal(t, 3, s.Len())
+
+	now = now.Add(2 * time.Hour)
+	assert.NoError(t, s.Push("", batch("five")))
+	assert.NoError(t, s.Push("", batch("six")))
+
+	// испорченный пакет пропускается, устаревший удаляется
+	assert.NoError(t, os.WriteFile(s.entries[1].path, []byte("{"), 0o600))
+	assert.Equal(t, [][]string{{"six"}}, spoolIDs(t, s))
+
+	list, err := s.Collect(context.Background())
+	assert.NoError(t, err)
+	got := make(map[string]metric.Metric, len(list))
+	for _, m := range list {
+		got[m.ID] = m
+	}
+	assert.Equal(t, 0.0, *got["SpoolBatches"].Value)
+	assert.Equal(t, 0.0, *got["SpoolBytes"].Value)
+	assert.Equal(t, int64(5), *got["SpoolDropped"].Delta)
+}
+
+func Test_publishSpooled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mocks.NewMockPublisher(ctrl)
+
+	s, err := NewSpool(filepath.Join(t.TempDir(), "spool"), 0, 0, time.Second)
+	assert.NoError(t, err)
+
+	a := &Agent{cfg: &Config{}, runner: &errgroup.Group{}, client: client, spool: s}
+	m := metric.NewMetrics()
+
+	var batchID string
+	storeMetrics(m, batch("PollCount"))
+	client.EXPECT().Publish(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, _ []metric.Metric) error {
+			batchID = metric.BatchID(ctx)
+			return errors.New("server is down")
+		})
+	assert.Error(t, a.publishMetrics(context.Background(), m))
+	assert.NotEmpty(t, batchID)
+	assert.Equal(t, 1, s.Len())
+	assert.NotContains(t, m.Metrics, "PollCount")
+
+	storeMetrics(m, batch("PollCount"))
+	// отложенный пакет отправляется первым и с прежним идентификатором
+	gomock.InOrder(
+		client.EXPECT().Publish(gomock.Any(), batch("PollCount")).
+			DoAndReturn(func(ctx context.Context, _ []metric.Metric) error {
+				assert.Equal(t, batchID, metric.BatchID(ctx))
+				return nil
+			}),
+		client.EXPECT().Publish(gomock.Any(), batch("PollCount")).
+			DoAndReturn(func(ctx context.Context, _ []metric.Metric) error {
+				assert.NotEqual(t, batchID, metric.BatchID(ctx))
+				return nil
+			}),
+	)
+	assert.NoError(t, a.publishMetrics(context.Background(), m))
+	assert.Equal(t, 0, s.Len())
+	assert.Empty(t, m.Metrics)
+}
+
+func Test_publishChunks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mocks.NewMockPublisher(ctrl)
+
+	// не доставляются метрики two и four, независимо от порядка в пакете
+	var failedID string
+	partial := func(_ context.Context, m []metric.Metric) error {
+		chunks := metric.SplitBatch("b", m, 1, 0, nil)
+		errs := make([]error, len(chunks))
+		for i, c := range chunks {
+			if c.Metrics[0].ID == "two" || c.Metrics[0].ID == "four" {
+				errs[i], failedID = errDown, c.BatchID
+			}
+		}
+		return &metric.ChunkError{Chunks: chunks, Errs: errs}
+	}
+
+	// доставленная часть пакета не отправляется повторно
+	a := &Agent{cfg: &Config{}, runner: &errgroup.Group{}, client: client}
+	m := metric.NewMetrics()
+	storeMetrics(m, batch("one"))
+	storeMetrics(m, batch("two"))
+	client.EXPECT().Publish(gomock.Any(), gomock.Any()).DoAndReturn(partial)
+	assert.ErrorIs(t, a.publishMetrics(context.Background(), m), errDown)
+	assert.Len(t, m.Metrics, 1)
+
+	// недоставленная часть отправляется повторно со своим идентификатором, без новых значений
+	storeMetrics(m, batch("three"))
+	client.EXPECT().Publish(gomock.Any(), batch("two")).
+		DoAndReturn(func(ctx context.Context, _ []metric.Metric) error {
+			assert.Equal(t, failedID, metric.BatchID(ctx))
+			return errDown
+		})
+	assert.ErrorIs(t, a.publishMetrics(context.Background(), m), errDown)
+	assert.Len(t, m.Metrics, 2)
+
+	// в очередь попадает только недоставленная часть
+	s, err := NewSpool(filepath.Join(t.TempDir(), "spool"), 0, 0, time.Second)
+	assert.NoError(t, err)
+	a.spool = s
+	client.EXPECT().Publish(gomock.Any(), batch("two")).Return(errDown)
+	assert.Error(t, a.publishMetrics(context.Background(), m))
+	assert.Equal(t, 1, s.Len())
+	assert.Len(t, m.Metrics, 1)
+
+	storeMetrics(m, batch("four"))
+	gomock.InOrder(
+		client.EXPECT().Publish(gomock.Any(), batch("two")).Return(nil),
+		client.EXPECT().Publish(gomock.Any(), gomock.Any()).DoAndReturn(partial),
+	)
+	assert.Error(t, a.publishMetrics(context.Background(), m))
+	assert.Equal(t, 1, s.Len())
+	assert.Empty(t, m.Metrics)
+}
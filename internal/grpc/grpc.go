@@ -36,11 +36,15 @@ func NewGrpc(ctx context.Context, runner *errgroup.Group, metric srv.MetricServi
 	server := grpc.NewServer(
 		grpc.ChainUnaryInterceptor(
 			ilog.UnaryServerInterceptor(InterceptorLogger(logger.Log), opts...),
-			hash.UnaryServerInterceptor(cfg.Key),
-			subnet.UnaryServerInterceptor(cfg.TrustedSubnet),
+			hash.UnaryServerInterceptor(cfg.Key, metrics.AdminMethods...),
+			subnet.UnaryServerInterceptor(cfg.TrustedSubnet, metrics.AdminMethods...),
+		),
+		grpc.ChainStreamInterceptor(
+			ilog.StreamServerInterceptor(InterceptorLogger(logger.Log), opts...),
+			subnet.StreamServerInterceptor(cfg.TrustedSubnet),
 		),
 	)
-	metrics.Register(server, metric)
+	metrics.Register(server, metric, cfg.Key)
 
 	return &Grpc{server: server, runner: runner, cfg: cfg, service: metric}, nil
 }
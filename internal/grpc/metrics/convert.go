@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	metricsv1 "github.com/nbvehbq/go-metrics-harvester/pkg/contract/gen/metrics"
+)
+
+func toProto(m metric.Metric) *metricsv1.Metric {
+	return &metricsv1.Metric{
+		Id:      m.ID,
+		MType:   m.MType,
+		Delta:   m.Delta,
+		Value:   m.Value,
+		Buckets: m.Buckets,
+		Counts:  m.Counts,
+		Sum:     m.Sum,
+		Count:   m.Count,
+		Labels:  m.Labels,
+	}
+}
+
+func fromProto(m *metricsv1.Metric) metric.Metric {
+	return metric.Metric{
+		ID:      m.Id,
+		MType:   m.MType,
+		Delta:   m.Delta,
+		Value:   m.Value,
+		Buckets: m.Buckets,
+		Counts:  m.Counts,
+		Sum:     m.Sum,
+		Count:   m.Count,
+		Labels:  m.Labels,
+	}
+}
@@ -1,6 +1,9 @@
 package metrics
 
 import (
+	"errors"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
 	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -37,3 +40,76 @@ func argumentError(err error) error {
 
 	return st.Err()
 }
+
+func notFoundError(err error) error {
+	st := status.New(codes.NotFound, "not found")
+	ei := errdetails.ErrorInfo{
+		Reason: err.Error(),
+		Domain: Domain,
+	}
+
+	st, derr := st.WithDetails(&ei)
+	if derr != nil {
+		return derr
+	}
+
+	return st.Err()
+}
+
+func unimplementedError(err error) error {
+	st := status.New(codes.Unimplemented, "not supported")
+	ei := errdetails.ErrorInfo{
+		Reason: err.Error(),
+		Domain: Domain,
+	}
+
+	st, derr := st.WithDetails(&ei)
+	if derr != nil {
+		return derr
+	}
+
+	return st.Err()
+}
+
+func abortedError(err error) error {
+	st := status.New(codes.Aborted, "aborted")
+	ei := errdetails.ErrorInfo{
+		Reason: err.Error(),
+		Domain: Domain,
+	}
+
+	st, derr := st.WithDetails(&ei)
+	if derr != nil {
+		return derr
+	}
+
+	return st.Err()
+}
+
+// updateCode maps error of applying batch to status code,
+// INVALID_ARGUMENT batch is rejected by any retry
+func updateCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, metric.ErrMetricNotFound), errors.Is(err, metric.ErrMetricBadType),
+		errors.Is(err, metric.ErrMetricBadValue), errors.Is(err, errWrongSignature):
+		return codes.InvalidArgument
+	case errors.Is(err, metric.ErrBatchInProgress):
+		return codes.Aborted
+	}
+
+	return codes.Internal
+}
+
+// seriesError maps error of reading or changing single series to status,
+// storage failures are internal
+func seriesError(err error) error {
+	switch {
+	case errors.Is(err, metric.ErrMetricNotFound):
+		return notFoundError(err)
+	case errors.Is(err, metric.ErrMetricBadType), errors.Is(err, metric.ErrBadAggregate),
+		errors.Is(err, metric.ErrBadStep):
+		return argumentError(err)
+	}
+
+	return internalError(err)
+}
@@ -2,25 +2,27 @@ package metrics
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/nbvehbq/go-metrics-harvester/internal/storage"
 	metricsv1 "github.com/nbvehbq/go-metrics-harvester/pkg/contract/gen/metrics"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-func (s *serverAPI) List(ctx context.Context, _ *metricsv1.ListRequest) (*metricsv1.ListResponse, error) {
-	list, err := s.service.List(ctx)
+const defaultHistoryRange = time.Hour
+
+func (s *serverAPI) List(ctx context.Context, in *metricsv1.ListRequest) (*metricsv1.ListResponse, error) {
+	list, err := s.service.List(ctx, in.Labels)
 	if err != nil {
 		return nil, internalError(err)
 	}
 
 	res := make([]*metricsv1.Metric, 0, len(list))
 	for _, v := range list {
-		res = append(res, &metricsv1.Metric{
-			Id:    v.ID,
-			MType: v.MType,
-			Delta: v.Delta,
-			Value: v.Value,
-		})
+		res = append(res, toProto(v))
 	}
 
 	return &metricsv1.ListResponse{Metric: res}, nil
@@ -29,14 +31,15 @@ func (s *serverAPI) List(ctx context.Context, _ *metricsv1.ListRequest) (*metric
 func (s *serverAPI) Update(ctx context.Context, in *metricsv1.UpdateRequest) (*metricsv1.UpdateResponse, error) {
 	m := make([]metric.Metric, 0, len(in.Metric))
 	for _, v := range in.Metric {
-		m = append(m, metric.Metric{
-			ID:    v.Id,
-			MType: v.MType,
-			Delta: v.Delta,
-			Value: v.Value,
-		})
+		m = append(m, fromProto(v))
 	}
-	if err := s.service.Update(ctx, m); err != nil {
+	if err := s.service.Update(metric.WithBatchID(ctx, in.BatchId), m); err != nil {
+		switch updateCode(err) {
+		case codes.InvalidArgument:
+			return nil, argumentError(err)
+		case codes.Aborted:
+			return nil, abortedError(err)
+		}
 		return nil, internalError(err)
 	}
 
@@ -44,17 +47,84 @@ func (s *serverAPI) Update(ctx context.Context, in *metricsv1.UpdateRequest) (*m
 }
 
 func (s *serverAPI) Value(ctx context.Context, in *metricsv1.ValueRequest) (*metricsv1.ValueResponse, error) {
-	value, err := s.service.Get(ctx, in.Id, in.Type)
+	value, err := s.service.Get(ctx, in.Id, in.Type, in.Labels)
+	if err != nil {
+		return nil, seriesError(err)
+	}
+
+	return &metricsv1.ValueResponse{Metric: toProto(*value)}, nil
+}
+
+func (s *serverAPI) History(ctx context.Context, in *metricsv1.HistoryRequest) (*metricsv1.HistoryResponse, error) {
+	to := time.Now()
+	if in.To != nil {
+		to = in.To.AsTime()
+	}
+
+	from := to.Add(-defaultHistoryRange)
+	if in.From != nil {
+		from = in.From.AsTime()
+	}
+
+	var (
+		samples []metric.Sample
+		err     error
+	)
+
+	if in.Step == nil {
+		samples, err = s.service.History(ctx, in.Id, in.Type, in.Labels, from, to)
+	} else {
+		agg := in.Aggregate
+		if agg == "" {
+			agg = metric.AggLast
+		}
+		samples, err = s.service.Range(ctx, in.Id, in.Type, in.Labels, from, to, in.Step.AsDuration(), agg)
+	}
+
+	if err != nil {
+		if errors.Is(err, storage.ErrNotSupported) {
+			return nil, unimplementedError(err)
+		}
+		return nil, seriesError(err)
+	}
+
+	res := make([]*metricsv1.Sample, 0, len(samples))
+	for _, v := range samples {
+		res = append(res, &metricsv1.Sample{
+			Ts:    timestamppb.New(v.Timestamp),
+			Delta: v.Delta,
+			Value: v.Value,
+		})
+	}
+
+	return &metricsv1.HistoryResponse{Sample: res}, nil
+}
+
+// Delete removes single series by id or all series by prefix when id is empty
+func (s *serverAPI) Delete(ctx context.Context, in *metricsv1.DeleteRequest) (*metricsv1.DeleteResponse, error) {
+	if in.Id == "" {
+		n, err := s.service.DeletePrefix(ctx, in.Prefix)
+		if err != nil {
+			if errors.Is(err, metric.ErrEmptyPrefix) {
+				return nil, argumentError(err)
+			}
+			return nil, internalError(err)
+		}
+		return &metricsv1.DeleteResponse{Deleted: n}, nil
+	}
+
+	if err := s.service.Delete(ctx, in.Id, in.Type, in.Labels); err != nil {
+		return nil, seriesError(err)
+	}
+
+	return &metricsv1.DeleteResponse{Deleted: 1}, nil
+}
+
+func (s *serverAPI) Reset(ctx context.Context, in *metricsv1.ResetRequest) (*metricsv1.ResetResponse, error) {
+	value, err := s.service.Reset(ctx, in.Id, in.Type, in.Labels)
 	if err != nil {
-		return nil, argumentError(err)
+		return nil, seriesError(err)
 	}
 
-	return &metricsv1.ValueResponse{
-		Metric: &metricsv1.Metric{
-			Id:    value.ID,
-			MType: value.MType,
-			Delta: value.Delta,
-			Value: value.Value,
-		},
-	}, nil
+	return &metricsv1.ResetResponse{Metric: toProto(*value)}, nil
 }
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric/mocks"
+	metricsv1 "github.com/nbvehbq/go-metrics-harvester/pkg/contract/gen/metrics"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerAPI_SeriesErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "not found", err: metric.ErrMetricNotFound, code: codes.NotFound},
+		{name: "bad type", err: metric.ErrMetricBadType, code: codes.InvalidArgument},
+		{name: "storage", err: errors.New("connection refused"), code: codes.Internal},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	service := mocks.NewMockMetricService(ctrl)
+	client := newTestClient(t, service, "")
+	ctx := context.Background()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service.EXPECT().Get(gomock.Any(), "cpu", metric.Gauge, gomock.Any()).Return(nil, tt.err)
+			_, err := client.Value(ctx, &metricsv1.ValueRequest{Id: "cpu", Type: metric.Gauge})
+			assert.Equal(t, tt.code, status.Code(err))
+
+			service.EXPECT().Delete(gomock.Any(), "cpu", metric.Gauge, gomock.Any()).Return(tt.err)
+			_, err = client.Delete(ctx, &metricsv1.DeleteRequest{Id: "cpu", Type: metric.Gauge})
+			assert.Equal(t, tt.code, status.Code(err))
+
+			service.EXPECT().Reset(gomock.Any(), "cpu", metric.Gauge, gomock.Any()).Return(nil, tt.err)
+			_, err = client.Reset(ctx, &metricsv1.ResetRequest{Id: "cpu", Type: metric.Gauge})
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
@@ -6,11 +6,19 @@ import (
 	"google.golang.org/grpc"
 )
 
+// AdminMethods - методы, изменяющие метрики в обход агентов,
+// требуют подписи и адреса из доверенной подсети
+var AdminMethods = []string{
+	"/metrics.MetricService/Delete",
+	"/metrics.MetricService/Reset",
+}
+
 type serverAPI struct {
 	metricsv1.UnimplementedMetricServiceServer
 	service metric.MetricService
+	key     string
 }
 
-func Register(server *grpc.Server, srv metric.MetricService) {
-	metricsv1.RegisterMetricServiceServer(server, &serverAPI{service: srv})
+func Register(server *grpc.Server, srv metric.MetricService, key string) {
+	metricsv1.RegisterMetricServiceServer(server, &serverAPI{service: srv, key: key})
 }
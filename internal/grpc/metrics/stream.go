@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"context"
+	"io"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/hash"
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	metricsv1 "github.com/nbvehbq/go-metrics-harvester/pkg/contract/gen/metrics"
+	"github.com/pkg/errors"
+)
+
+var errWrongSignature = errors.New("wrong signature")
+
+// StreamUpdate applies batches from long-lived stream, every batch is acknowledged by its seq
+func (s *serverAPI) StreamUpdate(stream metricsv1.MetricService_StreamUpdateServer) error {
+	ctx := stream.Context()
+
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ack := &metricsv1.StreamUpdateResponse{Seq: in.Seq}
+		if err := s.applyBatch(ctx, in); err != nil {
+			ack.Error = err.Error()
+			ack.Code = uint32(updateCode(err))
+		}
+
+		if err := stream.Send(ack); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *serverAPI) applyBatch(ctx context.Context, in *metricsv1.StreamUpdateRequest) error {
+	batch := in.GetBatch()
+
+	if s.key != "" && in.Hash != "" {
+		sign, err := hash.SignMessage(s.key, batch)
+		if err != nil {
+			return errors.Wrap(err, "marshal batch")
+		}
+		if sign != in.Hash {
+			return errWrongSignature
+		}
+	}
+
+	m := make([]metric.Metric, 0, len(batch.GetMetric()))
+	for _, v := range batch.GetMetric() {
+		m = append(m, fromProto(v))
+	}
+
+	return s.service.Update(metric.WithBatchID(ctx, batch.GetBatchId()), m)
+}
+
+// Watch pushes changes applied to metrics until client goes away
+func (s *serverAPI) Watch(in *metricsv1.WatchRequest, stream metricsv1.MetricService_WatchServer) error {
+	ctx := stream.Context()
+
+	events, err := s.service.Watch(ctx, metric.WatchFilter{Prefix: in.Prefix, MType: in.Type})
+	if err != nil {
+		return argumentError(err)
+	}
+
+	for e := range events {
+		if err := stream.Send(&metricsv1.WatchResponse{Seq: e.Seq, Metric: toProto(e.Metric), Deleted: e.Deleted}); err != nil {
+			return err
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return abortedError(metric.ErrWatchOverflow)
+}
@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/nbvehbq/go-metrics-harvester/internal/hash"
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric/mocks"
+	metricsv1 "github.com/nbvehbq/go-metrics-harvester/pkg/contract/gen/metrics"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestClient serves service over in-memory connection
+func newTestClient(t *testing.T, service metric.MetricService, key string) metricsv1.MetricServiceClient {
+	t.Helper()
+
+	l := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	Register(server, service, key)
+	go server.Serve(l)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return l.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return metricsv1.NewMetricServiceClient(conn)
+}
+
+func TestServerAPI_StreamUpdate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	service := mocks.NewMockMetricService(ctrl)
+
+	client := newTestClient(t, service, "secret")
+	st, err := client.StreamUpdate(context.Background())
+	assert.NoError(t, err)
+
+	delta := int64(1)
+	batch := &metricsv1.UpdateRequest{
+		Metric:  []*metricsv1.Metric{{Id: "PollCount", MType: metric.Counter, Delta: &delta}},
+		BatchId: "b1",
+	}
+	sign, err := hash.SignMessage("secret", batch)
+	assert.NoError(t, err)
+
+	service.EXPECT().Update(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, m []metric.Metric) error {
+			assert.Equal(t, "b1", metric.BatchID(ctx))
+			assert.Equal(t, "PollCount", m[0].ID)
+			return nil
+		})
+	service.EXPECT().Update(gomock.Any(), gomock.Any()).Return(metric.ErrMetricBadValue)
+	service.EXPECT().Update(gomock.Any(), gomock.Any()).Return(metric.ErrBatchInProgress)
+
+	tests := []struct {
+		name string
+		req  *metricsv1.StreamUpdateRequest
+		want *metricsv1.StreamUpdateResponse
+	}{
+		{
+			name: "applied",
+			req:  &metricsv1.StreamUpdateRequest{Seq: 1, Batch: batch, Hash: sign},
+			want: &metricsv1.StreamUpdateResponse{Seq: 1},
+		},
+		{
+			name: "wrong signature",
+			req:  &metricsv1.StreamUpdateRequest{Seq: 2, Batch: batch, Hash: "bad"},
+			want: &metricsv1.StreamUpdateResponse{Seq: 2, Error: errWrongSignature.Error(),
+				Code: uint32(codes.InvalidArgument)},
+		},
+		{
+			name: "bad value",
+			req:  &metricsv1.StreamUpdateRequest{Seq: 3, Batch: batch},
+			want: &metricsv1.StreamUpdateResponse{Seq: 3, Error: metric.ErrMetricBadValue.Error(),
+				Code: uint32(codes.InvalidArgument)},
+		},
+		{
+			name: "batch in progress",
+			req:  &metricsv1.StreamUpdateRequest{Seq: 4, Batch: batch},
+			want: &metricsv1.StreamUpdateResponse{Seq: 4, Error: metric.ErrBatchInProgress.Error(),
+				Code: uint32(codes.Aborted)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, st.Send(tt.req))
+			ack, err := st.Recv()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want.Seq, ack.Seq)
+			assert.Equal(t, tt.want.Error, ack.Error)
+			assert.Equal(t, tt.want.Code, ack.Code)
+		})
+	}
+
+	assert.NoError(t, st.CloseSend())
+}
+
+func TestServerAPI_Watch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	service := mocks.NewMockMetricService(ctrl)
+
+	value := 1.5
+	events := make(chan metric.Event, 2)
+	events <- metric.Event{Seq: 7, Metric: metric.Metric{ID: "cpu", MType: metric.Gauge, Value: &value}}
+	events <- metric.Event{Seq: 8, Metric: metric.Metric{ID: "cpu", MType: metric.Gauge, Value: &value}, Deleted: true}
+	close(events)
+
+	service.EXPECT().Watch(gomock.Any(), metric.WatchFilter{Prefix: "c", MType: metric.Gauge}).
+		Return((<-chan metric.Event)(events), nil)
+
+	client := newTestClient(t, service, "")
+	st, err := client.Watch(context.Background(), &metricsv1.WatchRequest{Prefix: "c", Type: metric.Gauge})
+	assert.NoError(t, err)
+
+	res, err := st.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(7), res.Seq)
+	assert.Equal(t, "cpu", res.Metric.Id)
+	assert.False(t, res.Deleted)
+
+	res, err = st.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(8), res.Seq)
+	assert.True(t, res.Deleted)
+
+	// канал закрыт сервисом - подписчик отстал
+	_, err = st.Recv()
+	assert.Equal(t, codes.Aborted, status.Code(err))
+}
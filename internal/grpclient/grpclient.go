@@ -2,15 +2,20 @@ package grpclient
 
 import (
 	"context"
+	"fmt"
+	"sync"
 
 	"github.com/nbvehbq/go-metrics-harvester/internal/agent"
 	"github.com/nbvehbq/go-metrics-harvester/internal/hash"
 	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
 
 	metricsv1 "github.com/nbvehbq/go-metrics-harvester/pkg/contract/gen/metrics"
@@ -21,6 +26,16 @@ type GRPClient struct {
 	client  metricsv1.MetricServiceClient
 	address string
 	key     string
+	stream  bool
+
+	maxMetrics int
+	maxBytes   int
+
+	mu  sync.Mutex
+	st  metricsv1.MetricService_StreamUpdateClient
+	seq uint64
+	// cancel - поток живет дольше отдельной отправки, поэтому у него собственный контекст
+	cancel context.CancelFunc
 }
 
 func NewGRPClient(cfg *agent.Config) (*GRPClient, error) {
@@ -33,35 +48,90 @@ func NewGRPClient(cfg *agent.Config) (*GRPClient, error) {
 		client:  metricsv1.NewMetricServiceClient(conn),
 		address: cfg.Address,
 		key:     cfg.Key,
+		stream:  cfg.GRPCStream,
+
+		maxMetrics: cfg.MaxBatchMetrics,
+		maxBytes:   cfg.MaxBatchBytes,
 	}, nil
 }
 
+// Probe checks that server serves metric api: metric is found or rejected as unknown,
+// other replies (unimplemented, auth or server errors) mean the server is not usable
+func (h *GRPClient) Probe(ctx context.Context) error {
+	_, err := h.client.Value(ctx, &metricsv1.ValueRequest{Type: metric.Gauge})
+	switch status.Code(err) {
+	case codes.OK, codes.NotFound, codes.InvalidArgument:
+		return nil
+	}
+
+	return errors.Wrap(err, "probe")
+}
+
+// requestOverhead - запас на идентификатор пакета, подпись и заголовок сообщения потока
+const requestOverhead = 256
+
+// Publish sends batch split into messages within configured limits,
+// partially delivered batch returns *metric.ChunkError
 func (h *GRPClient) Publish(ctx context.Context, m []metric.Metric) error {
+	maxBytes := h.maxBytes
+	if maxBytes > requestOverhead {
+		maxBytes -= requestOverhead
+	}
+	chunks := metric.SplitBatch(metric.BatchID(ctx), m, h.maxMetrics, maxBytes, protoSize)
+
+	return metric.PublishChunks(ctx, chunks, h.publish)
+}
+
+func toProto(v metric.Metric) *metricsv1.Metric {
+	return &metricsv1.Metric{
+		Id:      v.ID,
+		MType:   v.MType,
+		Delta:   v.Delta,
+		Value:   v.Value,
+		Buckets: v.Buckets,
+		Counts:  v.Counts,
+		Sum:     v.Sum,
+		Count:   v.Count,
+		Labels:  v.Labels,
+	}
+}
+
+// protoSize returns size of metric as repeated field of UpdateRequest
+func protoSize(v metric.Metric) int {
+	return protowire.SizeTag(1) + protowire.SizeBytes(proto.Size(toProto(v)))
+}
+
+func (h *GRPClient) publish(ctx context.Context, m []metric.Metric) error {
 	list := make([]*metricsv1.Metric, 0, len(m))
 	for _, v := range m {
-		list = append(list, &metricsv1.Metric{
-			Id:    v.ID,
-			MType: v.MType,
-			Delta: v.Delta,
-			Value: v.Value,
-		})
+		list = append(list, toProto(v))
 	}
-	message := metricsv1.UpdateRequest{Metric: list}
+	message := metricsv1.UpdateRequest{Metric: list, BatchId: metric.BatchID(ctx)}
 
-	var sign []byte
+	var sign string
 	if h.key != "" {
-		buf, err := proto.Marshal(&message)
-		if err != nil {
+		var err error
+		if sign, err = hash.SignMessage(h.key, &message); err != nil {
 			return errors.Wrap(err, "marshal message")
 		}
-		sign = hash.Hash([]byte(h.key), buf)
 	}
 
-	err := retry.Do(func() (err error) {
-		if sign != nil {
-			ctx = metadata.AppendToOutgoingContext(ctx, hash.HashHeaderKey, string(sign))
+	if h.stream {
+		if err := h.publishStream(ctx, &message, sign); err != nil {
+			return errors.Wrap(err, "error while publish")
 		}
+		return nil
+	}
+
+	if sign != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, hash.HashHeaderKey, sign)
+	}
+
+	err := retry.Do(func() (err error) {
 		_, err = h.client.Update(ctx, &message, grpc.UseCompressor(gzip.Name))
+		if status.Code(err) == codes.InvalidArgument {
+			return retry.Permanent(errors.Wrap(err, "send request"))
+		}
 		if err != nil {
 			return errors.Wrap(err, "send request")
 		}
@@ -75,3 +145,76 @@ func (h *GRPClient) Publish(ctx context.Context, m []metric.Metric) error {
 
 	return nil
 }
+
+// publishStream sends batch over long-lived stream and waits for its acknowledgement,
+// broken stream is reopened on next attempt
+func (h *GRPClient) publishStream(ctx context.Context, message *metricsv1.UpdateRequest, sign string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return retry.Do(func() error {
+		if err := ctx.Err(); err != nil {
+			return retry.Permanent(err)
+		}
+
+		if h.st == nil {
+			streamCtx, cancel := context.WithCancel(context.Background())
+			st, err := h.client.StreamUpdate(streamCtx, grpc.UseCompressor(gzip.Name))
+			if err != nil {
+				cancel()
+				return errors.Wrap(err, "open stream")
+			}
+			h.st, h.cancel = st, cancel
+		}
+		// отправка прерывается вместе с вызывающим, поток при этом закрывается
+		stop := context.AfterFunc(ctx, h.cancel)
+		defer stop()
+
+		h.seq++
+		req := &metricsv1.StreamUpdateRequest{Seq: h.seq, Batch: message, Hash: sign}
+		if err := h.st.Send(req); err != nil {
+			h.closeStream()
+			return errors.Wrap(err, "send batch")
+		}
+
+		ack, err := h.st.Recv()
+		if err != nil {
+			h.closeStream()
+			return errors.Wrap(err, "receive ack")
+		}
+		if ack.Seq != req.Seq {
+			h.closeStream()
+			return fmt.Errorf("unexpected ack seq %d, want %d", ack.Seq, req.Seq)
+		}
+		if ack.Error != "" {
+			// пакет отклонен сервером, повтор даст тот же результат
+			if codes.Code(ack.Code) == codes.InvalidArgument {
+				return retry.Permanent(errors.New(ack.Error))
+			}
+			return errors.New(ack.Error)
+		}
+
+		return nil
+	})
+}
+
+// closeStream closes and cancels the stream, so its goroutines exit even if server does not answer
+func (h *GRPClient) closeStream() error {
+	err := h.st.CloseSend()
+	h.cancel()
+	h.st, h.cancel = nil, nil
+
+	return err
+}
+
+// Close closes the update stream if any
+func (h *GRPClient) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.st == nil {
+		return nil
+	}
+
+	return h.closeStream()
+}
@@ -0,0 +1,221 @@
+package grpclient
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/hash"
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	metricsv1 "github.com/nbvehbq/go-metrics-harvester/pkg/contract/gen/metrics"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeServer acknowledges stream batches with configured error
+type fakeServer struct {
+	metricsv1.UnimplementedMetricServiceServer
+
+	mu       sync.Mutex
+	streams  int
+	requests []*metricsv1.StreamUpdateRequest
+	updates  int
+
+	dropFirst bool // первый поток закрывается без подтверждения
+	hang      bool // пакеты не подтверждаются, поток ждет отмены клиентом
+	cancelled int
+	ackError  string
+	ackCode   codes.Code
+	valueCode codes.Code // ответ на Value, OK - метрика не найдена
+}
+
+func (f *fakeServer) StreamUpdate(stream metricsv1.MetricService_StreamUpdateServer) error {
+	f.mu.Lock()
+	f.streams++
+	n := f.streams
+	f.mu.Unlock()
+
+	for {
+		in, err := stream.Recv()
+		if err != nil {
+			return nil
+		}
+
+		f.mu.Lock()
+		f.requests = append(f.requests, in)
+		f.mu.Unlock()
+
+		if f.dropFirst && n == 1 {
+			return nil
+		}
+		if f.hang {
+			<-stream.Context().Done()
+			f.mu.Lock()
+			f.cancelled++
+			f.mu.Unlock()
+			return nil
+		}
+
+		ack := &metricsv1.StreamUpdateResponse{Seq: in.Seq, Error: f.ackError, Code: uint32(f.ackCode)}
+		if err := stream.Send(ack); err != nil {
+			return err
+		}
+	}
+}
+
+func (f *fakeServer) Value(context.Context, *metricsv1.ValueRequest) (*metricsv1.ValueResponse, error) {
+	if f.valueCode != codes.OK {
+		return nil, status.Error(f.valueCode, "value")
+	}
+
+	return nil, status.Error(codes.NotFound, "metric not found")
+}
+
+func (f *fakeServer) Update(context.Context, *metricsv1.UpdateRequest) (*metricsv1.UpdateResponse, error) {
+	f.mu.Lock()
+	f.updates++
+	f.mu.Unlock()
+
+	return nil, status.Error(codes.InvalidArgument, "bad request")
+}
+
+func newTestClient(t *testing.T, srv *fakeServer, key string, stream bool) *GRPClient {
+	t.Helper()
+
+	l := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	metricsv1.RegisterMetricServiceServer(server, srv)
+	go server.Serve(l)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return l.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return &GRPClient{client: metricsv1.NewMetricServiceClient(conn), key: key, stream: stream}
+}
+
+func batch() []metric.Metric {
+	delta := int64(1)
+	return []metric.Metric{{ID: "PollCount", MType: metric.Counter, Delta: &delta}}
+}
+
+func TestGRPClient_PublishStream(t *testing.T) {
+	srv := &fakeServer{}
+	c := newTestClient(t, srv, "secret", true)
+	defer c.Close()
+
+	ctx := metric.WithBatchID(context.Background(), "b1")
+	assert.NoError(t, c.Publish(ctx, batch()))
+	assert.NoError(t, c.Publish(ctx, batch()))
+
+	assert.Equal(t, 1, srv.streams)
+	assert.Len(t, srv.requests, 2)
+	for i, req := range srv.requests {
+		assert.Equal(t, uint64(i+1), req.Seq)
+		assert.Equal(t, "b1", req.Batch.BatchId)
+
+		sign, err := hash.SignMessage("secret", req.Batch)
+		assert.NoError(t, err)
+		assert.Equal(t, sign, req.Hash)
+	}
+}
+
+func TestGRPClient_PublishStreamReconnect(t *testing.T) {
+	srv := &fakeServer{dropFirst: true}
+	c := newTestClient(t, srv, "", true)
+	defer c.Close()
+
+	// поток закрыт без подтверждения, пакет уходит повторно в новом потоке
+	assert.NoError(t, c.Publish(context.Background(), batch()))
+	assert.Equal(t, 2, srv.streams)
+	assert.Len(t, srv.requests, 2)
+	assert.Equal(t, uint64(2), srv.requests[1].Seq)
+}
+
+func TestGRPClient_PublishStreamCancel(t *testing.T) {
+	srv := &fakeServer{hang: true}
+	c := newTestClient(t, srv, "", true)
+	defer c.Close()
+
+	// неподтвержденная отправка прерывается с контекстом вызывающего, поток отменяется
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, c.Publish(ctx, batch()))
+	assert.Eventually(t, func() bool {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		return srv.cancelled == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestGRPClient_PublishPermanent(t *testing.T) {
+	srv := &fakeServer{ackError: "bad metric value", ackCode: codes.InvalidArgument}
+	c := newTestClient(t, srv, "", true)
+	defer c.Close()
+
+	assert.Error(t, c.Publish(context.Background(), batch()))
+	assert.Len(t, srv.requests, 1)
+
+	c.stream = false
+	assert.Error(t, c.Publish(context.Background(), batch()))
+	assert.Equal(t, 1, srv.updates)
+}
+
+func TestGRPClient_Probe(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    codes.Code
+		wantErr bool
+	}{
+		{name: "not found", code: codes.OK},
+		{name: "invalid argument", code: codes.InvalidArgument},
+		{name: "unimplemented", code: codes.Unimplemented, wantErr: true},
+		{name: "unauthenticated", code: codes.Unauthenticated, wantErr: true},
+		{name: "permission denied", code: codes.PermissionDenied, wantErr: true},
+		{name: "internal", code: codes.Internal, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestClient(t, &fakeServer{valueCode: tt.code}, "", false)
+			if tt.wantErr {
+				assert.Error(t, h.Probe(context.Background()))
+			} else {
+				assert.NoError(t, h.Probe(context.Background()))
+			}
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	down := &GRPClient{client: metricsv1.NewMetricServiceClient(closedConn(t))}
+	assert.Error(t, down.Probe(ctx))
+}
+
+// closedConn returns connection to listener which is already closed
+func closedConn(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+
+	l := bufconn.Listen(1 << 20)
+	l.Close()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return l.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
@@ -9,6 +9,7 @@ import (
 	"hash"
 	"io"
 	"net/http"
+	"slices"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -27,6 +28,16 @@ func Hash(key, value []byte) []byte {
 	return h.Sum(nil)
 }
 
+// SignMessage returns base64 encoded signature of deterministically marshaled message
+func SignMessage(key string, m proto.Message) (string, error) {
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(Hash([]byte(key), body)), nil
+}
+
 type hashWriter struct {
 	w http.ResponseWriter
 	h hash.Hash
@@ -93,22 +104,79 @@ func WithHash(key string) func(http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-func UnaryServerInterceptor(key string) grpc.UnaryServerInterceptor {
+// SignRequest returns base64 encoded signature of request method, path with query and body,
+// so the signature of one request is not valid for another target
+func SignRequest(key, method, uri string, body []byte) string {
+	msg := make([]byte, 0, len(method)+len(uri)+len(body)+2)
+	msg = append(msg, method...)
+	msg = append(msg, ' ')
+	msg = append(msg, uri...)
+	msg = append(msg, '\n')
+	msg = append(msg, body...)
+
+	return base64.StdEncoding.EncodeToString(Hash([]byte(key), msg))
+}
+
+// WithRequestHash is a middleware that requires the signature of whole request made by SignRequest
+func WithRequestHash(key string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if key == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			sign := r.Header.Get(HashHeaderKey)
+			if sign == "" {
+				http.Error(w, "missing signature", http.StatusBadRequest)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "can't read body", http.StatusBadRequest)
+				return
+			}
+
+			if sign != SignRequest(key, r.Method, r.URL.RequestURI(), body) {
+				http.Error(w, "wrong signature", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewBuffer(body))
+
+			hashWriter := newHashWriter(w, key)
+			defer hashWriter.Close()
+
+			h.ServeHTTP(hashWriter, r)
+		}
+	}
+}
+
+// UnaryServerInterceptor checks signature of request when present,
+// calls of required methods without signature are rejected
+func UnaryServerInterceptor(key string, required ...string) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ any, err error) {
 		if key != "" {
 			var sign string
 			if md, ok := metadata.FromIncomingContext(ctx); ok {
-				values := md.Get(HashHeaderKey)
-				if len(values) > 0 {
+				if values := md.Get(HashHeaderKey); len(values) > 0 {
 					sign = values[0]
-					body, err := proto.Marshal(req.(proto.Message))
-					if err != nil {
-						return nil, status.Errorf(codes.InvalidArgument, "unsupported message type: %T", body)
-					}
-					bodySign := base64.StdEncoding.EncodeToString(Hash([]byte(key), body))
-					if sign != bodySign {
-						return nil, status.Errorf(codes.InvalidArgument, "wrong signature")
-					}
+				}
+			}
+			if sign == "" && slices.Contains(required, info.FullMethod) {
+				return nil, status.Errorf(codes.InvalidArgument, "missing signature")
+			}
+			if sign != "" {
+				msg, ok := req.(proto.Message)
+				if !ok {
+					return nil, status.Errorf(codes.InvalidArgument, "unsupported message type: %T", req)
+				}
+				bodySign, err := SignMessage(key, msg)
+				if err != nil {
+					return nil, status.Errorf(codes.InvalidArgument, "marshal message: %v", err)
+				}
+				if sign != bodySign {
+					return nil, status.Errorf(codes.InvalidArgument, "wrong signature")
 				}
 			}
 		}
@@ -2,10 +2,18 @@ package hash
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 func TestHashMiddleware(t *testing.T) {
@@ -55,3 +63,86 @@ func TestHashMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestSignMessage(t *testing.T) {
+	msg := wrapperspb.String("Test body")
+
+	sign, err := SignMessage(HashHeaderKey, msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	body, _ := proto.Marshal(msg)
+	want := base64.StdEncoding.EncodeToString(Hash([]byte(HashHeaderKey), body))
+	if sign != want {
+		t.Errorf("wrong signature: want %s, got %s", want, sign)
+	}
+}
+
+func TestRequestHashMiddleware(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	sign := SignRequest(HashHeaderKey, "DELETE", "/value/gauge/Alloc", nil)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		sign   string
+		code   int
+	}{
+		{name: "signed", method: "DELETE", target: "/value/gauge/Alloc", sign: sign, code: http.StatusOK},
+		{name: "missing signature", method: "DELETE", target: "/value/gauge/Alloc", code: http.StatusBadRequest},
+		// подпись одного запроса не подходит для другой серии, префикса или метода
+		{name: "other series", method: "DELETE", target: "/value/gauge/HeapAlloc", sign: sign, code: http.StatusBadRequest},
+		{name: "other prefix", method: "DELETE", target: "/value/?prefix=", sign: sign, code: http.StatusBadRequest},
+		{name: "other method", method: "POST", target: "/value/gauge/Alloc", sign: sign, code: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.target, nil)
+			if test.sign != "" {
+				req.Header.Set(HashHeaderKey, test.sign)
+			}
+			rec := httptest.NewRecorder()
+			WithRequestHash(HashHeaderKey)(nextHandler).ServeHTTP(rec, req)
+
+			if rec.Code != test.code {
+				t.Errorf("wrong status code: want %d, got %d", test.code, rec.Code)
+			}
+		})
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	msg := wrapperspb.String("Test body")
+	sign, _ := SignMessage(HashHeaderKey, msg)
+	handler := func(ctx context.Context, req any) (any, error) { return req, nil }
+
+	tests := []struct {
+		name   string
+		method string
+		sign   string
+		code   codes.Code
+	}{
+		{name: "unsigned", method: "/test/Update", code: codes.OK},
+		{name: "unsigned required", method: "/test/Delete", code: codes.InvalidArgument},
+		{name: "signed required", method: "/test/Delete", sign: sign, code: codes.OK},
+		{name: "wrong signature", method: "/test/Update", sign: "wrong", code: codes.InvalidArgument},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.sign != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(HashHeaderKey, test.sign))
+			}
+
+			interceptor := UnaryServerInterceptor(HashHeaderKey, "/test/Delete")
+			_, err := interceptor(ctx, msg, &grpc.UnaryServerInfo{FullMethod: test.method}, handler)
+			if code := status.Code(err); code != test.code {
+				t.Errorf("wrong code: want %s, got %s", test.code, code)
+			}
+		})
+	}
+}
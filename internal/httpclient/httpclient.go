@@ -25,43 +25,100 @@ import (
 
 type HTTPClient struct {
 	client    http.Client
-	publicKey []byte
+	publicKey *rsa.PublicKey
 	address   string
 	key       string
+
+	maxMetrics int
+	maxBytes   int
 }
 
 func NewHTTPClient(cfg *agent.Config) (*HTTPClient, error) {
-	var buf []byte
-	var err error
+	var publicKey *rsa.PublicKey
 	if cfg.CryptoKey != "" {
-		buf, err = os.ReadFile(cfg.CryptoKey)
+		buf, err := os.ReadFile(cfg.CryptoKey)
 		if err != nil {
 			return nil, errors.Wrap(err, "open public key filename")
 		}
+
+		publicKeyBlock, _ := pem.Decode(buf)
+		if publicKeyBlock == nil {
+			return nil, errors.New("decode public key")
+		}
+		key, err := x509.ParsePKIXPublicKey(publicKeyBlock.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse public key")
+		}
+		var ok bool
+		if publicKey, ok = key.(*rsa.PublicKey); !ok {
+			return nil, errors.New("public key is not RSA")
+		}
 	}
 
 	return &HTTPClient{
 		client:    http.Client{},
 		address:   cfg.Address,
 		key:       cfg.Key,
-		publicKey: buf,
+		publicKey: publicKey,
+
+		maxMetrics: cfg.MaxBatchMetrics,
+		maxBytes:   cfg.MaxBatchBytes,
 	}, nil
 }
 
-func (h *HTTPClient) Publish(_ context.Context, m []metric.Metric) error {
+// Publish sends batch split into requests within configured limits,
+// partially delivered batch returns *metric.ChunkError
+func (h *HTTPClient) Publish(ctx context.Context, m []metric.Metric) error {
+	// JSON массив: скобки и запятые между метриками
+	maxBytes := h.maxBytes
+	if h.publicKey != nil && maxBytes > 0 {
+		maxBytes = encryptedBudget(maxBytes, h.publicKey.Size())
+	}
+	if maxBytes > 2 {
+		maxBytes -= 2
+	}
+	chunks := metric.SplitBatch(metric.BatchID(ctx), m, h.maxMetrics, maxBytes, jsonSize)
+
+	return metric.PublishChunks(ctx, chunks, h.publish)
+}
+
+// gzipBlock - на уровне сжатия по умолчанию блок deflate не длиннее 16К токенов,
+// несжимаемые данные уходят такими блоками без сжатия
+const gzipBlock = 1 << 14
+
+// encryptedBudget returns JSON size which fits maxBytes after encryption and gzip.
+// OAEP block of keySize bytes holds keySize-2*hashSize-2 bytes of JSON
+// and encrypted body does not compress
+func encryptedBudget(maxBytes, keySize int) int {
+	// заголовок и окончание gzip, заголовки несжатых блоков deflate
+	maxBytes -= 18 + 5*(maxBytes/gzipBlock+1)
+	blocks := maxBytes / keySize
+	if blocks < 1 {
+		// лимит меньше одного блока, метрики отправляются по одной
+		return 1
+	}
+
+	return blocks * (keySize - 2*sha256.Size - 2)
+}
+
+func jsonSize(m metric.Metric) int {
 	buf, err := json.Marshal(m)
 	if err != nil {
-		return errors.Wrap(err, "marshal")
+		return 0
 	}
 
-	if h.publicKey != nil {
-		publicKeyBlock, _ := pem.Decode(h.publicKey)
-		publicKey, err := x509.ParsePKIXPublicKey(publicKeyBlock.Bytes)
-		if err != nil {
-			return errors.Wrap(err, "parse public key")
-		}
+	return len(buf) + 1
+}
+
+func (h *HTTPClient) publish(ctx context.Context, m []metric.Metric) error {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		// например NaN, пакет не будет отправлен и при повторе
+		return retry.Permanent(errors.Wrap(err, "marshal"))
+	}
 
-		buf, err = crypto.EncryptOAEP(sha256.New(), publicKey.(*rsa.PublicKey), buf, nil)
+	if h.publicKey != nil {
+		buf, err = crypto.EncryptOAEP(sha256.New(), h.publicKey, buf, nil)
 		if err != nil {
 			return errors.Wrap(err, "encrypt body")
 		}
@@ -73,7 +130,8 @@ func (h *HTTPClient) Publish(_ context.Context, m []metric.Metric) error {
 	}
 
 	err = retry.Do(func() (err error) {
-		req, err := http.NewRequest(
+		req, err := http.NewRequestWithContext(
+			ctx,
 			"POST",
 			fmt.Sprintf("%s/updates/", h.address),
 			bytes.NewReader(buf))
@@ -91,6 +149,10 @@ func (h *HTTPClient) Publish(_ context.Context, m []metric.Metric) error {
 		}
 		req.Header.Add("X-Real-IP", addr)
 
+		if id := metric.BatchID(ctx); id != "" {
+			req.Header.Add(metric.BatchIDHeader, id)
+		}
+
 		if h.key != "" {
 			sign := hash.Hash([]byte(h.key), buf)
 			req.Header.Add(hash.HashHeaderKey, base64.StdEncoding.EncodeToString(sign))
@@ -102,6 +164,15 @@ func (h *HTTPClient) Publish(_ context.Context, m []metric.Metric) error {
 		}
 		defer res.Body.Close()
 
+		// пакет не подтвержден, повторная отправка с тем же идентификатором безопасна
+		if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+			err := fmt.Errorf("server responded %s", res.Status)
+			if permanentStatus(res.StatusCode) {
+				return retry.Permanent(err)
+			}
+			return err
+		}
+
 		return
 	})
 
@@ -112,6 +183,12 @@ func (h *HTTPClient) Publish(_ context.Context, m []metric.Metric) error {
 	return nil
 }
 
+// permanentStatus reports whether request is rejected and repeating it immediately does not help
+func permanentStatus(code int) bool {
+	return code >= http.StatusBadRequest && code < http.StatusInternalServerError &&
+		code != http.StatusConflict && code != http.StatusTooManyRequests && code != http.StatusRequestTimeout
+}
+
 func compress(data []byte) ([]byte, error) {
 	var b bytes.Buffer
 	w := gzip.NewWriter(&b)
@@ -0,0 +1,138 @@
+package httpclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/agent"
+	"github.com/nbvehbq/go-metrics-harvester/internal/crypto"
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/nbvehbq/go-metrics-harvester/pkg/retry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPClient_Publish(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "ok", status: http.StatusOK},
+		// отклоненный пакет не подтвержден, агент оставляет его значения неотправленными
+		{name: "bad request", status: http.StatusBadRequest, wantErr: true},
+		{name: "forbidden", status: http.StatusForbidden, wantErr: true},
+		{name: "too large", status: http.StatusRequestEntityTooLarge, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				assert.Equal(t, "batch", r.Header.Get(metric.BatchIDHeader))
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			h, err := NewHTTPClient(&agent.Config{Address: srv.URL})
+			assert.NoError(t, err)
+
+			delta := int64(1)
+			ctx := metric.WithBatchID(context.Background(), "batch")
+			err = h.Publish(ctx, []metric.Metric{{ID: "PollCount", MType: metric.Counter, Delta: &delta}})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			// отклоненный запрос не повторяется
+			assert.Equal(t, int32(1), requests.Load())
+		})
+	}
+}
+
+func TestHTTPClient_PublishNaN(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer srv.Close()
+
+	h, err := NewHTTPClient(&agent.Config{Address: srv.URL})
+	assert.NoError(t, err)
+
+	value := math.NaN()
+	err = h.Publish(context.Background(), []metric.Metric{{ID: "Alloc", MType: metric.Gauge, Value: &value}})
+
+	// пакет не сериализуется и повтор не поможет
+	var permanent *retry.PermanentError
+	assert.ErrorAs(t, err, &permanent)
+	assert.Equal(t, int32(0), requests.Load())
+}
+
+func TestHTTPClient_PublishEncryptedLimit(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	public, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	assert.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "public.pem")
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}), 0o600))
+
+	const maxBytes = 2048
+	var (
+		mu       sync.Mutex
+		received []metric.Metric
+		requests int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		// размер тела на проводе, после шифрования и сжатия
+		assert.LessOrEqual(t, len(body), maxBytes)
+
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		assert.NoError(t, err)
+		encrypted, err := io.ReadAll(zr)
+		assert.NoError(t, err)
+		plain, err := crypto.DecryptOAEP(sha256.New(), private, encrypted, nil)
+		assert.NoError(t, err)
+
+		var list []metric.Metric
+		assert.NoError(t, json.Unmarshal(plain, &list))
+
+		mu.Lock()
+		received = append(received, list...)
+		requests++
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	h, err := NewHTTPClient(&agent.Config{Address: srv.URL, CryptoKey: keyFile, MaxBatchBytes: maxBytes})
+	assert.NoError(t, err)
+
+	list := make([]metric.Metric, 0, 100)
+	for i := range 100 {
+		v := float64(i)
+		list = append(list, metric.Metric{ID: fmt.Sprintf("Gauge%d", i), MType: metric.Gauge, Value: &v})
+	}
+	assert.NoError(t, h.Publish(context.Background(), list))
+
+	assert.Greater(t, requests, 1)
+	assert.Equal(t, list, received)
+}
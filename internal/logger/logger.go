@@ -30,6 +30,11 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode
 }
 
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 // Initialize initializes the logger with given log level
 func Initialize(level string) error {
 	lvl, err := zap.ParseAtomicLevel(level)
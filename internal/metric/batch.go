@@ -0,0 +1,36 @@
+package metric
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// BatchIDHeader - HTTP заголовок с идентификатором пакета обновлений
+const BatchIDHeader = "X-Batch-ID"
+
+type batchIDKey struct{}
+
+// NewBatchID returns random batch identifier
+func NewBatchID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+
+	return hex.EncodeToString(buf)
+}
+
+// WithBatchID returns context carrying batch identifier,
+// повторные доставки пакета с тем же идентификатором игнорируются сервером
+func WithBatchID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+
+	return context.WithValue(ctx, batchIDKey{}, id)
+}
+
+// BatchID returns batch identifier from context or empty string
+func BatchID(ctx context.Context) string {
+	id, _ := ctx.Value(batchIDKey{}).(string)
+	return id
+}
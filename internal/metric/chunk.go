@@ -0,0 +1,191 @@
+package metric
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Chunk - часть пакета, отправляемая отдельным запросом
+type Chunk struct {
+	BatchID string
+	Metrics []Metric
+}
+
+// SplitBatch splits batch into chunks holding no more than maxMetrics metrics
+// and maxBytes bytes as measured by size, zero limit means no limit.
+// Metric larger than maxBytes is sent alone.
+// Chunks of split batch get identifiers <batchID>-<n>, so the same batch
+// is split and deduplicated by server the same way on every retry
+func SplitBatch(batchID string, list []Metric, maxMetrics, maxBytes int, size func(Metric) int) []Chunk {
+	var res []Chunk
+	start, bytes := 0, 0
+	for i, m := range list {
+		n := 0
+		if maxBytes > 0 {
+			n = size(m)
+		}
+
+		full := maxMetrics > 0 && i-start >= maxMetrics
+		if maxBytes > 0 && i > start && bytes+n > maxBytes {
+			full = true
+		}
+		if full {
+			res = append(res, Chunk{Metrics: list[start:i]})
+			start, bytes = i, 0
+		}
+		bytes += n
+	}
+	res = append(res, Chunk{Metrics: list[start:]})
+
+	if len(res) == 1 {
+		res[0].BatchID = batchID
+		return res
+	}
+	if batchID != "" {
+		for i := range res {
+			res[i].BatchID = fmt.Sprintf("%s-%d", batchID, i)
+		}
+	}
+
+	return res
+}
+
+// ChunkError - ошибка отправки части пакета, остальные части доставлены
+type ChunkError struct {
+	Chunks []Chunk
+	Errs   []error // ошибки отправки по частям, nil - часть доставлена
+}
+
+func (e *ChunkError) Error() string {
+	failed := 0
+	var msg []string
+	for i, err := range e.Errs {
+		if err == nil {
+			continue
+		}
+		failed++
+		msg = append(msg, fmt.Sprintf("chunk %d (%d metrics): %v", i, len(e.Chunks[i].Metrics), err))
+	}
+
+	return fmt.Sprintf("%d of %d chunks failed: %s", failed, len(e.Chunks), strings.Join(msg, "; "))
+}
+
+func (e *ChunkError) Unwrap() []error {
+	var res []error
+	for _, err := range e.Errs {
+		if err != nil {
+			res = append(res, err)
+		}
+	}
+
+	return res
+}
+
+// Failed returns chunks which were not delivered
+func (e *ChunkError) Failed() []Chunk {
+	var res []Chunk
+	for i, err := range e.Errs {
+		if err != nil {
+			res = append(res, e.Chunks[i])
+		}
+	}
+
+	return res
+}
+
+// Published returns metrics of delivered chunks
+func (e *ChunkError) Published() []Metric {
+	var res []Metric
+	for i, err := range e.Errs {
+		if err == nil {
+			res = append(res, e.Chunks[i].Metrics...)
+		}
+	}
+
+	return res
+}
+
+// PublishChunks sends every chunk with its batch identifier, failed chunk does not stop the rest.
+// Single chunk returns publish error as is, otherwise the error is *ChunkError
+func PublishChunks(ctx context.Context, chunks []Chunk, publish func(ctx context.Context, m []Metric) error) error {
+	if len(chunks) == 1 {
+		return publish(WithBatchID(ctx, chunks[0].BatchID), chunks[0].Metrics)
+	}
+
+	res := &ChunkError{}
+	failed := false
+	for _, c := range chunks {
+		err := publish(WithBatchID(ctx, c.BatchID), c.Metrics)
+		if err != nil {
+			failed = true
+		}
+
+		// часть, разбитая при отправке еще раз, учитывается по вложенным частям
+		var nested *ChunkError
+		if errors.As(err, &nested) {
+			res.Chunks = append(res.Chunks, nested.Chunks...)
+			res.Errs = append(res.Errs, nested.Errs...)
+			continue
+		}
+		res.Chunks = append(res.Chunks, c)
+		res.Errs = append(res.Errs, err)
+	}
+
+	if !failed {
+		return nil
+	}
+
+	return res
+}
+
+// Undelivered returns chunks of batch which were not delivered according to publish error
+func Undelivered(batch Chunk, err error) []Chunk {
+	if err == nil {
+		return nil
+	}
+
+	var ce *ChunkError
+	if errors.As(err, &ce) {
+		return ce.Failed()
+	}
+
+	return []Chunk{batch}
+}
+
+// Resend sends chunks of batch not delivered according to err with publish,
+// the resulting *ChunkError keeps chunks delivered before
+func Resend(ctx context.Context, batch Chunk, err error, publish func(ctx context.Context, m []Metric) error) error {
+	var prev *ChunkError
+	if !errors.As(err, &prev) {
+		return PublishChunks(ctx, []Chunk{batch}, publish)
+	}
+
+	failed := prev.Failed()
+	err = PublishChunks(ctx, failed, publish)
+	if err == nil {
+		return nil
+	}
+
+	res := &ChunkError{}
+	for i, c := range prev.Chunks {
+		if prev.Errs[i] == nil {
+			res.Chunks = append(res.Chunks, c)
+			res.Errs = append(res.Errs, nil)
+		}
+	}
+
+	var ce *ChunkError
+	if errors.As(err, &ce) {
+		res.Chunks = append(res.Chunks, ce.Chunks...)
+		res.Errs = append(res.Errs, ce.Errs...)
+		return res
+	}
+	for _, c := range failed {
+		res.Chunks = append(res.Chunks, c)
+		res.Errs = append(res.Errs, err)
+	}
+
+	return res
+}
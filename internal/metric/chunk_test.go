@@ -0,0 +1,149 @@
+package metric
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func chunkMetrics(n int) []Metric {
+	res := make([]Metric, n)
+	for i := range res {
+		res[i] = Metric{ID: fmt.Sprintf("m%d", i), MType: Gauge, Value: ptr(float64(i))}
+	}
+
+	return res
+}
+
+func TestSplitBatch(t *testing.T) {
+	list := chunkMetrics(5)
+	size := func(m Metric) int {
+		if m.ID == "m2" {
+			return 50
+		}
+		return 10
+	}
+
+	tests := []struct {
+		name       string
+		batchID    string
+		maxMetrics int
+		maxBytes   int
+		want       [][]string
+		wantIDs    []string
+	}{
+		{
+			name:    "no limits",
+			batchID: "b",
+			want:    [][]string{{"m0", "m1", "m2", "m3", "m4"}},
+			wantIDs: []string{"b"},
+		},
+		{
+			name:       "by metrics",
+			batchID:    "b",
+			maxMetrics: 2,
+			want:       [][]string{{"m0", "m1"}, {"m2", "m3"}, {"m4"}},
+			wantIDs:    []string{"b-0", "b-1", "b-2"},
+		},
+		{
+			name:     "by bytes, large metric alone",
+			batchID:  "b",
+			maxBytes: 30,
+			want:     [][]string{{"m0", "m1"}, {"m2"}, {"m3", "m4"}},
+			wantIDs:  []string{"b-0", "b-1", "b-2"},
+		},
+		{
+			name:       "both limits, no batch id",
+			maxMetrics: 1,
+			maxBytes:   100,
+			want:       [][]string{{"m0"}, {"m1"}, {"m2"}, {"m3"}, {"m4"}},
+			wantIDs:    []string{"", "", "", "", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := SplitBatch(tt.batchID, list, tt.maxMetrics, tt.maxBytes, size)
+
+			var ids []string
+			var got [][]string
+			for _, c := range chunks {
+				ids = append(ids, c.BatchID)
+				var names []string
+				for _, m := range c.Metrics {
+					names = append(names, m.ID)
+				}
+				got = append(got, names)
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantIDs, ids)
+		})
+	}
+}
+
+func TestPublishChunks(t *testing.T) {
+	errDown := errors.New("server is down")
+	chunks := SplitBatch("b", chunkMetrics(6), 2, 0, nil)
+
+	var sent []string
+	publish := func(ctx context.Context, m []Metric) error {
+		sent = append(sent, BatchID(ctx))
+		if BatchID(ctx) == "b-1" {
+			return errDown
+		}
+		return nil
+	}
+
+	err := PublishChunks(context.Background(), chunks, publish)
+	assert.Equal(t, []string{"b-0", "b-1", "b-2"}, sent)
+	assert.ErrorIs(t, err, errDown)
+
+	var ce *ChunkError
+	assert.True(t, errors.As(err, &ce))
+	assert.Equal(t, []Chunk{chunks[1]}, ce.Failed())
+	assert.Equal(t, slices.Concat(chunks[0].Metrics, chunks[2].Metrics), ce.Published())
+	assert.Equal(t, "1 of 3 chunks failed: chunk 1 (2 metrics): server is down", err.Error())
+
+	// недоставленная часть уходит повторно с тем же идентификатором
+	sent = nil
+	publish = func(ctx context.Context, m []Metric) error {
+		sent = append(sent, BatchID(ctx))
+		return errDown
+	}
+	err = Resend(context.Background(), Chunk{BatchID: "b"}, err, publish)
+	assert.Equal(t, []string{"b-1"}, sent)
+	assert.True(t, errors.As(err, &ce))
+	assert.Equal(t, []Chunk{chunks[1]}, ce.Failed())
+	assert.Len(t, ce.Published(), 4)
+
+	sent = nil
+	publish = func(ctx context.Context, m []Metric) error {
+		sent = append(sent, BatchID(ctx))
+		return nil
+	}
+	assert.NoError(t, Resend(context.Background(), Chunk{BatchID: "b"}, err, publish))
+	assert.Equal(t, []string{"b-1"}, sent)
+}
+
+func TestUndelivered(t *testing.T) {
+	batch := Chunk{BatchID: "b", Metrics: chunkMetrics(2)}
+	assert.Nil(t, Undelivered(batch, nil))
+	assert.Equal(t, []Chunk{batch}, Undelivered(batch, errors.New("failed")))
+
+	// части, разбитые повторно, учитываются по вложенным частям
+	nested := &ChunkError{
+		Chunks: []Chunk{{BatchID: "b-0"}, {BatchID: "b-1"}},
+		Errs:   []error{nil, errors.New("failed")},
+	}
+	err := PublishChunks(context.Background(), []Chunk{{BatchID: "a"}, batch}, func(ctx context.Context, m []Metric) error {
+		if BatchID(ctx) == "b" {
+			return fmt.Errorf("wrapped: %w", nested)
+		}
+		return nil
+	})
+	assert.Equal(t, []Chunk{{BatchID: "b-1"}}, Undelivered(batch, err))
+}
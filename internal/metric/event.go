@@ -0,0 +1,39 @@
+package metric
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrWatchOverflow - подписчик не успевает читать события и отключен
+var ErrWatchOverflow = errors.New("watcher is too slow")
+
+// Event - примененное изменение метрики, Seq возрастает монотонно.
+// Deleted - серия удалена, Metric содержит последнее состояние
+type Event struct {
+	Seq     uint64 `json:"seq"`
+	Metric  Metric `json:"metric"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// WatchFilter - фильтр подписки по имени, префиксу имени и типу, пустые поля не фильтруют.
+// After - продолжить с события, следующего за указанным, если оно еще в журнале
+type WatchFilter struct {
+	ID     string
+	Prefix string
+	MType  string
+	After  uint64
+}
+
+// Match - проверяет, что метрика подходит под фильтр
+func (f WatchFilter) Match(m Metric) bool {
+	if f.MType != "" && f.MType != m.MType {
+		return false
+	}
+
+	if f.ID != "" && f.ID != m.ID {
+		return false
+	}
+
+	return strings.HasPrefix(m.ID, f.Prefix)
+}
@@ -2,26 +2,46 @@ package metric
 
 import (
 	"context"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 const (
-	Gauge   = "gauge"
-	Counter = "counter"
+	Gauge     = "gauge"
+	Counter   = "counter"
+	Histogram = "histogram"
 )
 
 var (
 	ErrMetricNotFound = errors.New("not found")
 	ErrMetricBadType  = errors.New("bad metric type")
+	ErrMetricBadValue = errors.New("bad metric value")
+	ErrEmptyPrefix    = errors.New("empty prefix")
+	// ErrBatchInProgress - пакет с тем же идентификатором еще применяется
+	ErrBatchInProgress = errors.New("batch is in progress")
 )
 
 type MetricService interface {
-	List(ctx context.Context) ([]Metric, error)
-	Get(ctx context.Context, ID, MType string) (*Metric, error)
+	List(ctx context.Context, filter Labels) ([]Metric, error)
+	Get(ctx context.Context, ID, MType string, labels Labels) (*Metric, error)
 	Update(ctx context.Context, m []Metric) error
 	Set(ctx context.Context, m Metric) error
+	History(ctx context.Context, ID, MType string, labels Labels, from, to time.Time) ([]Sample, error)
+	Range(ctx context.Context, ID, MType string, labels Labels, from, to time.Time, step time.Duration, agg string) ([]Sample, error)
+	Watch(ctx context.Context, filter WatchFilter) (<-chan Event, error)
+	Delete(ctx context.Context, ID, MType string, labels Labels) error
+	DeletePrefix(ctx context.Context, prefix string) (int64, error)
+	Reset(ctx context.Context, ID, MType string, labels Labels) (*Metric, error)
 
 	SaveToFile(ctx context.Context, path string) error
 	Ping(context.Context) error
@@ -39,19 +59,211 @@ func validateGauge(value string) bool {
 	return err == nil
 }
 
+// validateHistogram - гистограмму нельзя передать одним значением в URL
+func validateHistogram(_ string) bool {
+	return false
+}
+
 var (
 	AllowedMetricType = map[string]Validator{
-		Gauge:   validateGauge,
-		Counter: validateCounter,
+		Gauge:     validateGauge,
+		Counter:   validateCounter,
+		Histogram: validateHistogram,
 	}
 )
 
+// Labels - набор меток серии (host, env, service ...)
+type Labels map[string]string
+
+// Match - проверяет, что набор содержит все метки filter
+func (l Labels) Match(filter Labels) bool {
+	for k, v := range filter {
+		if l[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Value - implementation of driver.Valuer interface,
+// JSON передается строкой: []byte драйвер кодирует как bytea
+func (l Labels) Value() (driver.Value, error) {
+	if l == nil {
+		return "{}", nil
+	}
+
+	buf, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(buf), nil
+}
+
+// Scan - implementation of sql.Scanner interface
+func (l *Labels) Scan(src any) error {
+	var buf []byte
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		buf = v
+	case string:
+		buf = []byte(v)
+	default:
+		return fmt.Errorf("unsupported labels type %T", src)
+	}
+
+	var res Labels
+	if err := json.Unmarshal(buf, &res); err != nil {
+		return err
+	}
+	if len(res) == 0 {
+		res = nil
+	}
+	*l = res
+
+	return nil
+}
+
+// SeriesKey - ключ серии: имя метрики и отсортированные метки, например
+// CPUutilization1{env="prod",host="db1"}. Без меток ключ совпадает с именем.
+func SeriesKey(ID string, labels Labels) string {
+	if len(labels) == 0 {
+		return ID
+	}
+
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, k := range names {
+		pairs[i] = k + "=" + strconv.Quote(labels[k])
+	}
+
+	return ID + "{" + strings.Join(pairs, ",") + "}"
+}
+
 // Metric - структура для хранения метрик
 type Metric struct {
-	ID    string   `json:"id" db:"id"`                 // имя метрики
-	MType string   `json:"type" db:"mtype"`            // параметр, принимающий значение gauge или counter
-	Delta *int64   `json:"delta,omitempty" db:"delta"` // значение метрики в случае передачи counter
-	Value *float64 `json:"value,omitempty" db:"value"` // значение метрики в случае передачи gauge
+	ID      string    `json:"id" db:"id"`                   // имя метрики
+	MType   string    `json:"type" db:"mtype"`              // параметр, принимающий значение gauge, counter или histogram
+	Labels  Labels    `json:"labels,omitempty" db:"labels"` // метки, вместе с именем определяют серию
+	Delta   *int64    `json:"delta,omitempty" db:"delta"`   // значение метрики в случае передачи counter
+	Value   *float64  `json:"value,omitempty" db:"value"`   // значение метрики в случае передачи gauge
+	Buckets []float64 `json:"buckets,omitempty" db:"-"`     // верхние границы корзин histogram по возрастанию
+	Counts  []uint64  `json:"counts,omitempty" db:"-"`      // число наблюдений в каждой корзине, последняя корзина +Inf
+	Sum     *float64  `json:"sum,omitempty" db:"-"`         // сумма наблюдений histogram
+	Count   *uint64   `json:"count,omitempty" db:"-"`       // число наблюдений histogram
+}
+
+// Key - ключ серии метрики
+func (m Metric) Key() string {
+	return SeriesKey(m.ID, m.Labels)
+}
+
+// Validate - проверяет имя, тип и согласованность значения метрики
+func (m Metric) Validate() error {
+	//check metric name
+	if m.ID == "" {
+		return ErrMetricNotFound
+	}
+
+	// check metric type
+	if _, ok := AllowedMetricType[m.MType]; !ok {
+		return ErrMetricBadType
+	}
+
+	switch {
+	case m.MType == Gauge && m.Value == nil,
+		m.MType == Counter && m.Delta == nil,
+		m.MType == Histogram && !validHistogram(m):
+		return ErrMetricBadValue
+	}
+
+	return nil
+}
+
+func validHistogram(m Metric) bool {
+	if len(m.Buckets) == 0 || len(m.Counts) != len(m.Buckets)+1 {
+		return false
+	}
+
+	if m.Sum == nil || m.Count == nil || math.IsNaN(*m.Sum) {
+		return false
+	}
+
+	for i, b := range m.Buckets {
+		if math.IsNaN(b) || math.IsInf(b, 0) {
+			return false
+		}
+		if i > 0 && b <= m.Buckets[i-1] {
+			return false
+		}
+	}
+
+	var total uint64
+	for _, c := range m.Counts {
+		total += c
+	}
+
+	return total == *m.Count
+}
+
+// Clone returns deep copy of metric
+func (m Metric) Clone() Metric {
+	res := m
+	res.Delta = clonePtr(m.Delta)
+	res.Value = clonePtr(m.Value)
+	res.Sum = clonePtr(m.Sum)
+	res.Count = clonePtr(m.Count)
+	res.Buckets = slices.Clone(m.Buckets)
+	res.Counts = slices.Clone(m.Counts)
+	if m.Labels != nil {
+		res.Labels = maps.Clone(m.Labels)
+	}
+
+	return res
+}
+
+func clonePtr[T any](v *T) *T {
+	if v == nil {
+		return nil
+	}
+	res := *v
+
+	return &res
+}
+
+// MergeHistogram - добавляет наблюдения src к dst.
+// Если границы корзин отличаются, dst заменяется значением src.
+func MergeHistogram(dst *Metric, src Metric) {
+	sum, count := *src.Sum, *src.Count
+
+	if !slices.Equal(dst.Buckets, src.Buckets) || len(dst.Counts) != len(src.Counts) ||
+		dst.Sum == nil || dst.Count == nil {
+		dst.Buckets = slices.Clone(src.Buckets)
+		dst.Counts = slices.Clone(src.Counts)
+		dst.Sum = &sum
+		dst.Count = &count
+		return
+	}
+
+	counts := make([]uint64, len(dst.Counts))
+	for i := range counts {
+		counts[i] = dst.Counts[i] + src.Counts[i]
+	}
+	sum += *dst.Sum
+	count += *dst.Count
+
+	dst.Counts = counts
+	dst.Sum = &sum
+	dst.Count = &count
 }
 
 // Metrics - хранилище метрик
@@ -0,0 +1,32 @@
+package metric
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetric_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Metric
+		want error
+	}{
+		{name: "gauge", m: Metric{ID: "a", MType: Gauge, Value: ptr(1.0)}},
+		{name: "counter", m: Metric{ID: "a", MType: Counter, Delta: ptr[int64](1)}},
+		{name: "histogram", m: Metric{ID: "a", MType: Histogram, Buckets: []float64{1},
+			Counts: []uint64{1, 0}, Sum: ptr(0.5), Count: ptr[uint64](1)}},
+		{name: "no id", m: Metric{MType: Gauge, Value: ptr(1.0)}, want: ErrMetricNotFound},
+		{name: "bad type", m: Metric{ID: "a", MType: "summary"}, want: ErrMetricBadType},
+		{name: "gauge without value", m: Metric{ID: "a", MType: Gauge}, want: ErrMetricBadValue},
+		{name: "counter without delta", m: Metric{ID: "a", MType: Counter}, want: ErrMetricBadValue},
+		{name: "histogram without sum", m: Metric{ID: "a", MType: Histogram, Buckets: []float64{1},
+			Counts: []uint64{1, 0}, Count: ptr[uint64](1)}, want: ErrMetricBadValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.m.Validate())
+		})
+	}
+}
@@ -7,6 +7,7 @@ package mocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	metric "github.com/nbvehbq/go-metrics-harvester/internal/metric"
@@ -35,34 +36,78 @@ func (m *MockMetricService) EXPECT() *MockMetricServiceMockRecorder {
 	return m.recorder
 }
 
+// Delete mocks base method.
+func (m *MockMetricService) Delete(arg0 context.Context, arg1, arg2 string, arg3 metric.Labels) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockMetricServiceMockRecorder) Delete(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockMetricService)(nil).Delete), arg0, arg1, arg2, arg3)
+}
+
+// DeletePrefix mocks base method.
+func (m *MockMetricService) DeletePrefix(arg0 context.Context, arg1 string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeletePrefix", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeletePrefix indicates an expected call of DeletePrefix.
+func (mr *MockMetricServiceMockRecorder) DeletePrefix(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePrefix", reflect.TypeOf((*MockMetricService)(nil).DeletePrefix), arg0, arg1)
+}
+
 // Get mocks base method.
-func (m *MockMetricService) Get(arg0 context.Context, arg1, arg2 string) (*metric.Metric, error) {
+func (m *MockMetricService) Get(arg0 context.Context, arg1, arg2 string, arg3 metric.Labels) (*metric.Metric, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Get", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "Get", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(*metric.Metric)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Get indicates an expected call of Get.
-func (mr *MockMetricServiceMockRecorder) Get(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockMetricServiceMockRecorder) Get(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockMetricService)(nil).Get), arg0, arg1, arg2, arg3)
+}
+
+// History mocks base method.
+func (m *MockMetricService) History(arg0 context.Context, arg1, arg2 string, arg3 metric.Labels, arg4, arg5 time.Time) ([]metric.Sample, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "History", arg0, arg1, arg2, arg3, arg4, arg5)
+	ret0, _ := ret[0].([]metric.Sample)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// History indicates an expected call of History.
+func (mr *MockMetricServiceMockRecorder) History(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockMetricService)(nil).Get), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "History", reflect.TypeOf((*MockMetricService)(nil).History), arg0, arg1, arg2, arg3, arg4, arg5)
 }
 
 // List mocks base method.
-func (m *MockMetricService) List(arg0 context.Context) ([]metric.Metric, error) {
+func (m *MockMetricService) List(arg0 context.Context, arg1 metric.Labels) ([]metric.Metric, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "List", arg0)
+	ret := m.ctrl.Call(m, "List", arg0, arg1)
 	ret0, _ := ret[0].([]metric.Metric)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // List indicates an expected call of List.
-func (mr *MockMetricServiceMockRecorder) List(arg0 interface{}) *gomock.Call {
+func (mr *MockMetricServiceMockRecorder) List(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockMetricService)(nil).List), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockMetricService)(nil).List), arg0, arg1)
 }
 
 // Ping mocks base method.
@@ -79,6 +124,36 @@ func (mr *MockMetricServiceMockRecorder) Ping(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockMetricService)(nil).Ping), arg0)
 }
 
+// Range mocks base method.
+func (m *MockMetricService) Range(arg0 context.Context, arg1, arg2 string, arg3 metric.Labels, arg4, arg5 time.Time, arg6 time.Duration, arg7 string) ([]metric.Sample, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Range", arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7)
+	ret0, _ := ret[0].([]metric.Sample)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Range indicates an expected call of Range.
+func (mr *MockMetricServiceMockRecorder) Range(arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Range", reflect.TypeOf((*MockMetricService)(nil).Range), arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7)
+}
+
+// Reset mocks base method.
+func (m *MockMetricService) Reset(arg0 context.Context, arg1, arg2 string, arg3 metric.Labels) (*metric.Metric, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reset", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(*metric.Metric)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reset indicates an expected call of Reset.
+func (mr *MockMetricServiceMockRecorder) Reset(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reset", reflect.TypeOf((*MockMetricService)(nil).Reset), arg0, arg1, arg2, arg3)
+}
+
 // SaveToFile mocks base method.
 func (m *MockMetricService) SaveToFile(arg0 context.Context, arg1 string) error {
 	m.ctrl.T.Helper()
@@ -120,3 +195,18 @@ func (mr *MockMetricServiceMockRecorder) Update(arg0, arg1 interface{}) *gomock.
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockMetricService)(nil).Update), arg0, arg1)
 }
+
+// Watch mocks base method.
+func (m *MockMetricService) Watch(arg0 context.Context, arg1 metric.WatchFilter) (<-chan metric.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Watch", arg0, arg1)
+	ret0, _ := ret[0].(<-chan metric.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Watch indicates an expected call of Watch.
+func (mr *MockMetricServiceMockRecorder) Watch(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Watch", reflect.TypeOf((*MockMetricService)(nil).Watch), arg0, arg1)
+}
@@ -0,0 +1,136 @@
+package metric
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+const (
+	AggMin  = "min"
+	AggMax  = "max"
+	AggAvg  = "avg"
+	AggSum  = "sum"
+	AggLast = "last"
+)
+
+var (
+	ErrBadAggregate = errors.New("bad aggregate")
+	ErrBadStep      = errors.New("bad step")
+)
+
+// AllowedAggregate - функции агрегации истории по шагу
+var AllowedAggregate = map[string]func(a, b float64, n int) float64{
+	AggMin:  func(a, b float64, _ int) float64 { return min(a, b) },
+	AggMax:  func(a, b float64, _ int) float64 { return max(a, b) },
+	AggAvg:  func(a, b float64, n int) float64 { return a + (b-a)/float64(n) },
+	AggSum:  func(a, b float64, _ int) float64 { return a + b },
+	AggLast: func(_, b float64, _ int) float64 { return b },
+}
+
+// Sample - значение серии в момент времени.
+// Для counter Delta хранит накопленное значение, для histogram
+// Value хранит сумму, а Delta число наблюдений.
+type Sample struct {
+	Timestamp time.Time `json:"ts" db:"ts"`
+	Delta     *int64    `json:"delta,omitempty" db:"delta"`
+	Value     *float64  `json:"value,omitempty" db:"value"`
+}
+
+// NewSample - снимок значения метрики на момент ts
+func NewSample(m Metric, ts time.Time) Sample {
+	s := Sample{Timestamp: ts}
+
+	switch m.MType {
+	case Gauge:
+		if m.Value != nil {
+			val := *m.Value
+			s.Value = &val
+		}
+	case Counter:
+		if m.Delta != nil {
+			delta := *m.Delta
+			s.Delta = &delta
+		}
+	case Histogram:
+		if m.Sum != nil && m.Count != nil {
+			sum, count := *m.Sum, int64(*m.Count)
+			s.Value, s.Delta = &sum, &count
+		}
+	}
+
+	return s
+}
+
+// StepStart - начало шага, которому принадлежит ts. Шаги выровнены по unix epoch.
+func StepStart(ts time.Time, step time.Duration) time.Time {
+	epoch := time.Unix(0, 0)
+	return epoch.Add(ts.Sub(epoch) / step * step)
+}
+
+// Aggregate - сворачивает упорядоченные по времени samples в шаги длиной step
+func Aggregate(samples []Sample, step time.Duration, agg string) ([]Sample, error) {
+	fn, ok := AllowedAggregate[agg]
+	if !ok {
+		return nil, ErrBadAggregate
+	}
+
+	if step <= 0 {
+		return nil, ErrBadStep
+	}
+
+	type acc struct {
+		value, delta float64
+		nv, nd       int
+	}
+
+	var (
+		res  []Sample
+		cur  acc
+		last time.Time
+	)
+
+	flush := func() {
+		if len(res) == 0 {
+			return
+		}
+		s := &res[len(res)-1]
+		if cur.nv > 0 {
+			v := cur.value
+			s.Value = &v
+		}
+		if cur.nd > 0 {
+			d := int64(math.Round(cur.delta))
+			s.Delta = &d
+		}
+	}
+
+	for _, s := range samples {
+		start := StepStart(s.Timestamp, step)
+		if len(res) == 0 || !start.Equal(last) {
+			flush()
+			res = append(res, Sample{Timestamp: start})
+			cur, last = acc{}, start
+		}
+
+		if s.Value != nil {
+			cur.nv++
+			if cur.nv == 1 {
+				cur.value = *s.Value
+			} else {
+				cur.value = fn(cur.value, *s.Value, cur.nv)
+			}
+		}
+		if s.Delta != nil {
+			cur.nd++
+			if cur.nd == 1 {
+				cur.delta = float64(*s.Delta)
+			} else {
+				cur.delta = fn(cur.delta, float64(*s.Delta), cur.nd)
+			}
+		}
+	}
+	flush()
+
+	return res, nil
+}
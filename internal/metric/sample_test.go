@@ -0,0 +1,57 @@
+package metric
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func TestAggregate(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	samples := []Sample{
+		{Timestamp: base, Value: ptr(1.0), Delta: ptr[int64](10)},
+		{Timestamp: base.Add(10 * time.Second), Value: ptr(3.0), Delta: ptr[int64](20)},
+		{Timestamp: base.Add(70 * time.Second), Value: ptr(5.0), Delta: ptr[int64](30)},
+	}
+
+	tests := []struct {
+		agg   string
+		value []float64
+		delta []int64
+	}{
+		{agg: AggMin, value: []float64{1, 5}, delta: []int64{10, 30}},
+		{agg: AggMax, value: []float64{3, 5}, delta: []int64{20, 30}},
+		{agg: AggAvg, value: []float64{2, 5}, delta: []int64{15, 30}},
+		{agg: AggSum, value: []float64{4, 5}, delta: []int64{30, 30}},
+		{agg: AggLast, value: []float64{3, 5}, delta: []int64{20, 30}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.agg, func(t *testing.T) {
+			res, err := Aggregate(samples, time.Minute, tt.agg)
+			assert.NoError(t, err)
+			assert.Len(t, res, 2)
+
+			for i, s := range res {
+				assert.Equal(t, StepStart(samples[i*2].Timestamp, time.Minute), s.Timestamp)
+				assert.Equal(t, tt.value[i], *s.Value)
+				assert.Equal(t, tt.delta[i], *s.Delta)
+			}
+		})
+	}
+
+	_, err := Aggregate(samples, time.Minute, "median")
+	assert.Equal(t, ErrBadAggregate, err)
+
+	_, err = Aggregate(samples, 0, AggLast)
+	assert.Equal(t, ErrBadStep, err)
+}
+
+func TestStepStart(t *testing.T) {
+	ts := time.Unix(1700000065, 0)
+	assert.Equal(t, time.Unix(1700000040, 0), StepStart(ts, time.Minute))
+	assert.Equal(t, time.Unix(1700000064, 0), StepStart(ts, 7*time.Second))
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+)
+
+const (
+	// batchWindow - сколько помнится идентификатор примененного пакета
+	batchWindow = 10 * time.Minute
+	// batchLimit - сколько идентификаторов помнится не более
+	batchLimit = 100000
+)
+
+// errBatchApplied - пакет уже применен, повторную доставку можно считать успешной
+var errBatchApplied = errors.New("batch already applied")
+
+type batchState int
+
+const (
+	batchApplying batchState = iota
+	batchApplied
+)
+
+type batchEntry struct {
+	id    string
+	state batchState
+	at    time.Time
+}
+
+// batches - идентификаторы недавно примененных пакетов для отбрасывания повторных доставок.
+// Хранятся в памяти процесса
+type batches struct {
+	mu    sync.Mutex
+	now   func() time.Time
+	byID  map[string]*batchEntry
+	order []*batchEntry // в порядке поступления
+}
+
+func newBatches() *batches {
+	return &batches{now: time.Now, byID: make(map[string]*batchEntry)}
+}
+
+// begin reserves batch id, it fails if the batch is applied or is being applied right now
+func (b *batches) begin(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.expire()
+
+	if e, ok := b.byID[id]; ok {
+		if e.state == batchApplied {
+			return errBatchApplied
+		}
+		return metric.ErrBatchInProgress
+	}
+
+	e := &batchEntry{id: id, state: batchApplying, at: b.now()}
+	b.byID[id] = e
+	b.order = append(b.order, e)
+
+	return nil
+}
+
+// done marks batch as applied, failed batch is forgotten to be accepted again
+func (b *batches) done(id string, applied bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.byID[id]
+	if !ok {
+		return
+	}
+
+	if applied {
+		e.state, e.at = batchApplied, b.now()
+		return
+	}
+	delete(b.byID, id)
+}
+
+func (b *batches) expire() {
+	now := b.now()
+
+	n := 0
+	for _, e := range b.order {
+		if cur, ok := b.byID[e.id]; !ok || cur != e {
+			n++
+			continue
+		}
+		if e.state == batchApplying || (now.Sub(e.at) < batchWindow && len(b.order)-n <= batchLimit) {
+			break
+		}
+		delete(b.byID, e.id)
+		n++
+	}
+	b.order = b.order[n:]
+}
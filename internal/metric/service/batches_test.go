@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/nbvehbq/go-metrics-harvester/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatches(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := newBatches()
+	b.now = func() time.Time { return now }
+
+	assert.NoError(t, b.begin("one"))
+	assert.Equal(t, metric.ErrBatchInProgress, b.begin("one"))
+
+	// неудачный пакет можно доставить снова
+	b.done("one", false)
+	assert.NoError(t, b.begin("one"))
+	b.done("one", true)
+	assert.Equal(t, errBatchApplied, b.begin("one"))
+
+	assert.NoError(t, b.begin("two"))
+	b.done("two", true)
+
+	now = now.Add(batchWindow)
+	assert.NoError(t, b.begin("one"))
+	assert.NoError(t, b.begin("two"))
+	assert.Len(t, b.byID, 2)
+	assert.Len(t, b.order, 2)
+}
+
+func TestService_UpdateBatch(t *testing.T) {
+	s := NewService(memory.NewMemStorage())
+	ctx := metric.WithBatchID(context.Background(), metric.NewBatchID())
+
+	delta := int64(5)
+	batch := []metric.Metric{{ID: "PollCount", MType: metric.Counter, Delta: &delta}}
+
+	assert.NoError(t, s.Update(ctx, batch))
+	assert.NoError(t, s.Update(ctx, batch))
+	assert.NoError(t, s.Update(context.Background(), batch))
+
+	got, err := s.Get(ctx, "PollCount", metric.Counter, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), *got.Delta)
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+)
+
+const (
+	// watchBuffer - сколько событий может накопить подписчик, прежде чем будет отключен
+	watchBuffer = 256
+	// eventBacklog - сколько последних событий хранится для возобновления подписки
+	eventBacklog = 1024
+)
+
+type subscriber struct {
+	filter metric.WatchFilter
+	ch     chan metric.Event
+}
+
+// broker - in-process pub/sub примененных изменений
+type broker struct {
+	mu   sync.Mutex
+	seq  uint64
+	subs map[*subscriber]struct{}
+
+	backlog []metric.Event // кольцевой журнал последних событий
+	next    int
+}
+
+func newBroker() *broker {
+	return &broker{
+		subs:    make(map[*subscriber]struct{}),
+		backlog: make([]metric.Event, 0, eventBacklog),
+	}
+}
+
+// subscribe returns channel of events matching filter, channel is closed when ctx is done
+// or when subscriber falls behind. Events after filter.After are replayed from backlog first
+func (b *broker) subscribe(ctx context.Context, filter metric.WatchFilter) <-chan metric.Event {
+	b.mu.Lock()
+
+	var replay []metric.Event
+	if filter.After > 0 {
+		replay = b.since(filter)
+	}
+
+	sub := &subscriber{filter: filter, ch: make(chan metric.Event, watchBuffer+len(replay))}
+	for _, e := range replay {
+		sub.ch <- e
+	}
+	b.subs[sub] = struct{}{}
+
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.unsubscribe(sub)
+	}()
+
+	return sub.ch
+}
+
+func (b *broker) unsubscribe(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// active reports whether anybody listens
+func (b *broker) active() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subs) > 0
+}
+
+func (b *broker) publish(list ...metric.Metric) {
+	b.send(false, list)
+}
+
+// remove publishes deletion of series
+func (b *broker) remove(list ...metric.Metric) {
+	b.send(true, list)
+}
+
+func (b *broker) send(deleted bool, list []metric.Metric) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, m := range list {
+		b.seq++
+		// подписчики кодируют событие асинхронно, поэтому получают собственную копию
+		e := metric.Event{Seq: b.seq, Metric: m.Clone(), Deleted: deleted}
+		b.remember(e)
+
+		for sub := range b.subs {
+			if !sub.filter.Match(m) {
+				continue
+			}
+
+			select {
+			case sub.ch <- e:
+			default:
+				delete(b.subs, sub)
+				close(sub.ch)
+			}
+		}
+	}
+}
+
+func (b *broker) remember(e metric.Event) {
+	if len(b.backlog) < eventBacklog {
+		b.backlog = append(b.backlog, e)
+		return
+	}
+
+	b.backlog[b.next] = e
+	b.next = (b.next + 1) % eventBacklog
+}
+
+// since returns backlog events after filter.After in publish order
+func (b *broker) since(filter metric.WatchFilter) []metric.Event {
+	var res []metric.Event
+
+	for i := range b.backlog {
+		e := b.backlog[(b.next+i)%len(b.backlog)]
+		if e.Seq > filter.After && filter.Match(e.Metric) {
+			res = append(res, e)
+		}
+	}
+
+	return res
+}
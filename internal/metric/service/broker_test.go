@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/nbvehbq/go-metrics-harvester/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBrokerFilter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := newBroker()
+
+	events := b.subscribe(ctx, metric.WatchFilter{Prefix: "Heap", MType: metric.Gauge})
+	assert.True(t, b.active())
+
+	b.publish(
+		metric.Metric{ID: "HeapAlloc", MType: metric.Gauge},
+		metric.Metric{ID: "PollCount", MType: metric.Counter},
+		metric.Metric{ID: "HeapSys", MType: metric.Gauge},
+	)
+
+	e := <-events
+	assert.Equal(t, uint64(1), e.Seq)
+	assert.Equal(t, "HeapAlloc", e.Metric.ID)
+
+	e = <-events
+	assert.Equal(t, uint64(3), e.Seq)
+	assert.Equal(t, "HeapSys", e.Metric.ID)
+
+	cancel()
+	_, ok := <-events
+	assert.False(t, ok)
+	assert.False(t, b.active())
+}
+
+func TestBrokerOverflow(t *testing.T) {
+	b := newBroker()
+	events := b.subscribe(context.Background(), metric.WatchFilter{})
+
+	for range watchBuffer + 1 {
+		b.publish(metric.Metric{ID: "PollCount", MType: metric.Counter})
+	}
+	assert.False(t, b.active())
+
+	var n int
+	for range events {
+		n++
+	}
+	assert.Equal(t, watchBuffer, n)
+}
+
+func TestBrokerResume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := newBroker()
+
+	for range eventBacklog + 10 {
+		b.publish(metric.Metric{ID: "PollCount", MType: metric.Counter})
+	}
+
+	events := b.subscribe(ctx, metric.WatchFilter{After: eventBacklog + 7})
+	assert.Equal(t, uint64(eventBacklog+8), (<-events).Seq)
+	assert.Equal(t, uint64(eventBacklog+9), (<-events).Seq)
+	assert.Equal(t, uint64(eventBacklog+10), (<-events).Seq)
+
+	events = b.subscribe(ctx, metric.WatchFilter{After: 1})
+	assert.Equal(t, uint64(11), (<-events).Seq)
+}
+
+func TestBrokerCopy(t *testing.T) {
+	b := newBroker()
+	events := b.subscribe(context.Background(), metric.WatchFilter{})
+
+	delta := int64(1)
+	m := metric.Metric{ID: "PollCount", MType: metric.Counter, Delta: &delta, Labels: metric.Labels{"host": "a"}}
+	b.publish(m)
+
+	// событие не зависит от дальнейших изменений хранимой метрики
+	delta = 2
+	m.Labels["host"] = "b"
+
+	e := <-events
+	assert.Equal(t, int64(1), *e.Metric.Delta)
+	assert.Equal(t, "a", e.Metric.Labels["host"])
+}
+
+func TestService_WatchDelete(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewService(memory.NewMemStorage())
+
+	value := 1.5
+	for _, id := range []string{"HeapAlloc", "HeapSys", "Alloc"} {
+		assert.NoError(t, s.Set(ctx, metric.Metric{ID: id, MType: metric.Gauge, Value: &value}))
+	}
+
+	events, err := s.Watch(ctx, metric.WatchFilter{})
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Delete(ctx, "Alloc", metric.Gauge, nil))
+	n, err := s.DeletePrefix(ctx, "Heap")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	var deleted []string
+	for range 3 {
+		e := <-events
+		assert.True(t, e.Deleted)
+		deleted = append(deleted, e.Metric.ID)
+	}
+	assert.Equal(t, "Alloc", deleted[0])
+	assert.ElementsMatch(t, []string{"Alloc", "HeapAlloc", "HeapSys"}, deleted)
+}
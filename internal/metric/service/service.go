@@ -5,6 +5,8 @@ import (
 	"errors"
 	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
 )
@@ -16,53 +18,122 @@ type Repository interface {
 	Persist(context.Context, io.Writer) error
 	Ping(context.Context) error
 	Update(context.Context, []metric.Metric) error
+	History(ctx context.Context, key string, from, to time.Time) ([]metric.Sample, error)
+	Delete(ctx context.Context, key string) error
+	DeletePrefix(ctx context.Context, prefix string) (int64, error)
+	Reset(ctx context.Context, key string) error
+}
+
+// Aggregator - хранилище, которое агрегирует историю по шагам самостоятельно
+type Aggregator interface {
+	Aggregate(ctx context.Context, key string, from, to time.Time, step time.Duration, agg string) ([]metric.Sample, error)
 }
 
 type Service struct {
 	storage Repository
+	broker  *broker
+	batches *batches
 }
 
 func NewService(storage Repository) *Service {
-	return &Service{storage: storage}
+	return &Service{storage: storage, broker: newBroker(), batches: newBatches()}
 }
 
-func (s *Service) List(ctx context.Context) ([]metric.Metric, error) {
-	return s.storage.List(ctx)
+func (s *Service) List(ctx context.Context, filter metric.Labels) ([]metric.Metric, error) {
+	list, err := s.storage.List(ctx)
+	if err != nil || len(filter) == 0 {
+		return list, err
+	}
+
+	res := make([]metric.Metric, 0, len(list))
+	for _, m := range list {
+		if m.Labels.Match(filter) {
+			res = append(res, m)
+		}
+	}
+
+	return res, nil
 }
 
-func (s *Service) Get(ctx context.Context, ID, MType string) (*metric.Metric, error) {
+func (s *Service) Get(ctx context.Context, ID, MType string, labels metric.Labels) (*metric.Metric, error) {
 	_, ok := metric.AllowedMetricType[MType]
 	if !ok {
-		return nil, errors.New("type not alowed")
+		return nil, metric.ErrMetricBadType
 	}
 
-	value, ok := s.storage.Get(ctx, ID)
+	value, ok := s.storage.Get(ctx, metric.SeriesKey(ID, labels))
 	if !ok {
-		return nil, errors.New("not found")
+		return nil, metric.ErrMetricNotFound
 	}
 
 	if value.MType != MType {
-		return nil, errors.New("not found")
+		return nil, metric.ErrMetricNotFound
 	}
 
 	return &value, nil
 }
 
+func (s *Service) History(ctx context.Context, ID, MType string, labels metric.Labels, from, to time.Time) ([]metric.Sample, error) {
+	if _, err := s.Get(ctx, ID, MType, labels); err != nil {
+		return nil, err
+	}
+
+	return s.storage.History(ctx, metric.SeriesKey(ID, labels), from, to)
+}
+
+func (s *Service) Range(ctx context.Context, ID, MType string, labels metric.Labels, from, to time.Time, step time.Duration, agg string) ([]metric.Sample, error) {
+	if _, ok := metric.AllowedAggregate[agg]; !ok {
+		return nil, metric.ErrBadAggregate
+	}
+
+	if step <= 0 {
+		return nil, metric.ErrBadStep
+	}
+
+	if aggregator, ok := s.storage.(Aggregator); ok {
+		if _, err := s.Get(ctx, ID, MType, labels); err != nil {
+			return nil, err
+		}
+		return aggregator.Aggregate(ctx, metric.SeriesKey(ID, labels), from, to, step, agg)
+	}
+
+	samples, err := s.History(ctx, ID, MType, labels, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return metric.Aggregate(samples, step, agg)
+}
+
 func (s *Service) Update(ctx context.Context, me []metric.Metric) error {
 	for _, m := range me {
-		//check metric name
-		if m.ID == "" {
-			return metric.ErrMetricNotFound
+		if err := m.Validate(); err != nil {
+			return err
 		}
+	}
 
-		// check metric type
-		_, ok := metric.AllowedMetricType[m.MType]
-		if !ok {
-			return metric.ErrMetricBadType
+	// пакет с идентификатором применяется один раз, повторные доставки игнорируются
+	id := metric.BatchID(ctx)
+	if id != "" {
+		switch err := s.batches.begin(id); {
+		case errors.Is(err, errBatchApplied):
+			return nil
+		case err != nil:
+			return err
 		}
 	}
 
-	return s.storage.Update(ctx, me)
+	err := s.storage.Update(ctx, me)
+	if id != "" {
+		s.batches.done(id, err == nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.notify(ctx, me...)
+
+	return nil
 }
 
 func (s *Service) Ping(ctx context.Context) error {
@@ -70,18 +141,121 @@ func (s *Service) Ping(ctx context.Context) error {
 }
 
 func (s *Service) Set(ctx context.Context, m metric.Metric) error {
-	//check metric name
-	if m.ID == "" {
-		return metric.ErrMetricNotFound
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	if err := s.storage.Set(ctx, m); err != nil {
+		return err
+	}
+
+	s.notify(ctx, m)
+
+	return nil
+}
+
+// Delete removes the series and its history
+func (s *Service) Delete(ctx context.Context, ID, MType string, labels metric.Labels) error {
+	value, err := s.Get(ctx, ID, MType, labels)
+	if err != nil {
+		return err
+	}
+
+	if err := s.storage.Delete(ctx, value.Key()); err != nil {
+		return err
+	}
+
+	s.broker.remove(*value)
+
+	return nil
+}
+
+// DeletePrefix removes all series which names start with prefix
+func (s *Service) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	if prefix == "" {
+		return 0, metric.ErrEmptyPrefix
+	}
+
+	// удаленные серии нужны только подписчикам
+	var deleted []metric.Metric
+	if s.broker.active() {
+		list, err := s.storage.List(ctx)
+		if err != nil {
+			return 0, err
+		}
+		for _, m := range list {
+			if strings.HasPrefix(m.ID, prefix) {
+				deleted = append(deleted, m)
+			}
+		}
+	}
+
+	n, err := s.storage.DeletePrefix(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	s.broker.remove(deleted...)
+
+	return n, nil
+}
+
+// Reset zeroes counter or histogram observations, gauges can not be reset
+func (s *Service) Reset(ctx context.Context, ID, MType string, labels metric.Labels) (*metric.Metric, error) {
+	if MType != metric.Counter && MType != metric.Histogram {
+		return nil, metric.ErrMetricBadType
+	}
+
+	if _, err := s.Get(ctx, ID, MType, labels); err != nil {
+		return nil, err
 	}
 
-	// check metric type
-	_, ok := metric.AllowedMetricType[m.MType]
+	key := metric.SeriesKey(ID, labels)
+	if err := s.storage.Reset(ctx, key); err != nil {
+		return nil, err
+	}
+
+	value, ok := s.storage.Get(ctx, key)
 	if !ok {
-		return metric.ErrMetricBadType
+		return nil, metric.ErrMetricNotFound
+	}
+	s.broker.publish(value)
+
+	return &value, nil
+}
+
+// Watch subscribes to changes applied through Set, Update, Reset and deletions
+func (s *Service) Watch(ctx context.Context, filter metric.WatchFilter) (<-chan metric.Event, error) {
+	if filter.MType != "" {
+		if _, ok := metric.AllowedMetricType[filter.MType]; !ok {
+			return nil, metric.ErrMetricBadType
+		}
+	}
+
+	return s.broker.subscribe(ctx, filter), nil
+}
+
+// notify publishes stored state of changed series, so counters are sent as totals
+func (s *Service) notify(ctx context.Context, me ...metric.Metric) {
+	if !s.broker.active() {
+		return
+	}
+
+	seen := make(map[string]struct{}, len(me))
+	list := make([]metric.Metric, 0, len(me))
+	for _, m := range me {
+		key := m.Key()
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		if value, ok := s.storage.Get(ctx, key); ok {
+			list = append(list, value)
+		}
 	}
 
-	return s.storage.Set(ctx, m)
+	s.broker.publish(list...)
 }
 
 func (s *Service) SaveToFile(ctx context.Context, path string) error {
@@ -20,13 +20,14 @@ func TestNewConfig(t *testing.T) {
 		{
 			name: "default config",
 			want: &Config{
-				Address:         "localhost:8080",
-				LogLevel:        "info",
-				StoreInterval:   300,
-				FileStoragePath: "/tmp",
-				Restore:         true,
-				DatabaseDSN:     "",
-				Key:             "",
+				Address:          "localhost:8080",
+				LogLevel:         "info",
+				StoreInterval:    300,
+				FileStoragePath:  "/tmp",
+				Restore:          true,
+				DatabaseDSN:      "",
+				Key:              "",
+				HistoryRetention: 604800,
 			},
 			wantErr: false,
 		},
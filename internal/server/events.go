@@ -0,0 +1,32 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+)
+
+const (
+	eventStreamContentType = "text/event-stream"
+	lastEventIDHeader      = "Last-Event-ID"
+	deletedEventType       = "deleted"
+)
+
+// writeEvent writes metric change as server-sent event, seq is used as event id.
+// Deletion is sent as event of type deleted with the last state of series
+func writeEvent(w io.Writer, e metric.Event) error {
+	data, err := json.Marshal(e.Metric)
+	if err != nil {
+		return err
+	}
+
+	if e.Deleted {
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Seq, deletedEventType, data)
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.Seq, data)
+	return err
+}
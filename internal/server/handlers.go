@@ -4,16 +4,26 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/nbvehbq/go-metrics-harvester/internal/logger"
 	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+	"github.com/nbvehbq/go-metrics-harvester/internal/storage"
 	"go.uber.org/zap"
 )
 
+const (
+	defaultHistoryRange = time.Hour
+	eventsKeepAlive     = 15 * time.Second
+)
+
 func (s *Server) pingDBHandler(res http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
 
@@ -27,7 +37,7 @@ func (s *Server) pingDBHandler(res http.ResponseWriter, req *http.Request) {
 }
 
 func (s *Server) listMetricHandler(res http.ResponseWriter, req *http.Request) {
-	html := `
+	page := `
 <!DOCTYPE html>
 <html lang="en">
 <head>
@@ -43,7 +53,7 @@ func (s *Server) listMetricHandler(res http.ResponseWriter, req *http.Request) {
 	`
 
 	ctx := req.Context()
-	list, err := s.service.List(ctx)
+	list, err := s.service.List(ctx, queryLabels(req.URL.Query()))
 	if err != nil {
 		http.Error(res, "", http.StatusInternalServerError)
 		return
@@ -51,18 +61,27 @@ func (s *Server) listMetricHandler(res http.ResponseWriter, req *http.Request) {
 
 	li := make([]string, len(list))
 	for i, v := range list {
-		var value string
-		switch v.MType {
-		case metric.Gauge:
-			value = strconv.FormatFloat(*v.Value, 'f', -1, 64)
-		case metric.Counter:
-			value = fmt.Sprintf("%d", *v.Delta)
-		}
-		li[i] = fmt.Sprintf("<li>%s: %s</li>", v.ID, value)
+		li[i] = fmt.Sprintf("<li>%s: %s</li>", html.EscapeString(v.Key()), formatValue(v))
 	}
 
 	res.Header().Set("Content-Type", "text/html; charset=utf-8")
-	fmt.Fprintf(res, html, strings.Join(li, "\n"))
+	fmt.Fprintf(res, page, strings.Join(li, "\n"))
+}
+
+func (s *Server) prometheusHandler(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	list, err := s.service.List(ctx, queryLabels(req.URL.Query()))
+	if err != nil {
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", prometheusContentType)
+	res.WriteHeader(http.StatusOK)
+
+	if err := writePrometheus(res, list); err != nil {
+		logger.Log.Error("write prometheus", zap.Error(err))
+	}
 }
 
 func (s *Server) getMetricHandlerJSON(res http.ResponseWriter, req *http.Request) {
@@ -80,7 +99,7 @@ func (s *Server) getMetricHandlerJSON(res http.ResponseWriter, req *http.Request
 		return
 	}
 
-	value, err := s.service.Get(ctx, m.ID, m.MType)
+	value, err := s.service.Get(ctx, m.ID, m.MType, m.Labels)
 	if err != nil {
 		JSONError(res, "not found", http.StatusNotFound)
 		return
@@ -108,14 +127,14 @@ func (s *Server) updateHandlerJSON(res http.ResponseWriter, req *http.Request) {
 		switch {
 		case errors.Is(err, metric.ErrMetricNotFound):
 			JSONError(res, err.Error(), http.StatusNotFound)
-		case errors.Is(err, metric.ErrMetricBadType):
+		case errors.Is(err, metric.ErrMetricBadType), errors.Is(err, metric.ErrMetricBadValue):
 			JSONError(res, err.Error(), http.StatusBadRequest)
 		default:
 			JSONError(res, err.Error(), http.StatusInternalServerError)
 		}
 		return
 	}
-	updated, _ := s.service.Get(ctx, m.ID, m.MType)
+	updated, _ := s.service.Get(ctx, m.ID, m.MType, m.Labels)
 
 	if s.storeInterval == 0 {
 		go s.service.SaveToFile(ctx, s.fileStoragePath)
@@ -141,21 +160,198 @@ func (s *Server) getMetricHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	m, err := s.service.Get(ctx, mname, mtype)
+	m, err := s.service.Get(ctx, mname, mtype, queryLabels(req.URL.Query()))
 	if err != nil {
 		http.Error(res, "not found", http.StatusNotFound)
 		return
 	}
 
-	switch m.MType {
-	case metric.Counter:
-		res.Write([]byte(fmt.Sprintf("%d", *m.Delta)))
-	case metric.Gauge:
-		res.Write([]byte(strconv.FormatFloat(*m.Value, 'f', -1, 64)))
+	res.Write([]byte(formatValue(*m)))
+
+	res.Header().Set("Content-Type", "text/plain")
+	res.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) historyHandler(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	mtype := chi.URLParam(req, "type")
+	mname := chi.URLParam(req, "name")
+	query := req.URL.Query()
+
+	to, err := parseTime(query.Get("to"), time.Now())
+	if err != nil {
+		JSONError(res, "bad request (to)", http.StatusBadRequest)
+		return
+	}
+
+	from, err := parseTime(query.Get("from"), to.Add(-defaultHistoryRange))
+	if err != nil {
+		JSONError(res, "bad request (from)", http.StatusBadRequest)
+		return
+	}
+
+	var samples []metric.Sample
+	labels := queryLabels(query, "from", "to", "step", "agg")
+
+	if query.Get("step") == "" {
+		samples, err = s.service.History(ctx, mname, mtype, labels, from, to)
+	} else {
+		step, errStep := parseStep(query.Get("step"))
+		if errStep != nil {
+			JSONError(res, "bad request (step)", http.StatusBadRequest)
+			return
+		}
+
+		agg := query.Get("agg")
+		if agg == "" {
+			agg = metric.AggLast
+		}
+
+		samples, err = s.service.Range(ctx, mname, mtype, labels, from, to, step, agg)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, metric.ErrMetricNotFound), errors.Is(err, metric.ErrMetricBadType):
+			JSONError(res, "not found", http.StatusNotFound)
+		case errors.Is(err, metric.ErrBadAggregate), errors.Is(err, metric.ErrBadStep):
+			JSONError(res, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, storage.ErrNotSupported):
+			JSONError(res, err.Error(), http.StatusNotImplemented)
+		default:
+			JSONError(res, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if samples == nil {
+		samples = []metric.Sample{}
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(res).Encode(samples); err != nil {
+		logger.Log.Error("encode history", zap.Error(err))
+	}
+}
+
+func (s *Server) eventsHandler(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	query := req.URL.Query()
+
+	filter := metric.WatchFilter{ID: query.Get("id"), MType: query.Get("type")}
+	if last := req.Header.Get(lastEventIDHeader); last != "" {
+		seq, err := strconv.ParseUint(last, 10, 64)
+		if err != nil {
+			http.Error(res, "bad request (last event id)", http.StatusBadRequest)
+			return
+		}
+		filter.After = seq
+	}
+
+	events, err := s.service.Watch(ctx, filter)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rc := http.NewResponseController(res)
+
+	res.Header().Set("Content-Type", eventStreamContentType)
+	res.Header().Set("Cache-Control", "no-cache")
+	res.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		logger.Log.Error("events flush", zap.Error(err))
+		return
+	}
+
+	for {
+		select {
+		case e, ok := <-events:
+			// канал закрыт: клиент ушел или не успевает читать,
+			// во втором случае он переподключится с Last-Event-ID
+			if !ok {
+				return
+			}
+			if err := writeEvent(res, e); err != nil {
+				return
+			}
+		case <-time.After(eventsKeepAlive):
+			if _, err := fmt.Fprint(res, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) deleteHandler(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	mtype := chi.URLParam(req, "type")
+	mname := chi.URLParam(req, "name")
+
+	err := s.service.Delete(ctx, mname, mtype, queryLabels(req.URL.Query()))
+	switch {
+	case errors.Is(err, metric.ErrMetricBadType):
+		http.Error(res, "bad request (type)", http.StatusBadRequest)
+		return
+	case errors.Is(err, metric.ErrMetricNotFound):
+		http.Error(res, "not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "text/plain")
+	res.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) deletePrefixHandler(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	n, err := s.service.DeletePrefix(ctx, req.URL.Query().Get("prefix"))
+	if errors.Is(err, metric.ErrEmptyPrefix) {
+		JSONError(res, "bad request (prefix)", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		JSONError(res, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(struct {
+		Deleted int64 `json:"deleted"`
+	}{Deleted: n})
+}
+
+func (s *Server) resetHandler(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	mtype := chi.URLParam(req, "type")
+	mname := chi.URLParam(req, "name")
+
+	m, err := s.service.Reset(ctx, mname, mtype, queryLabels(req.URL.Query()))
+	switch {
+	case errors.Is(err, metric.ErrMetricBadType):
+		http.Error(res, "bad request (type)", http.StatusBadRequest)
+		return
+	case errors.Is(err, metric.ErrMetricNotFound):
+		http.Error(res, "not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(res, "", http.StatusInternalServerError)
+		return
 	}
 
 	res.Header().Set("Content-Type", "text/plain")
 	res.WriteHeader(http.StatusOK)
+	res.Write([]byte(formatValue(*m)))
 }
 
 func (s *Server) updateHandler(res http.ResponseWriter, req *http.Request) {
@@ -182,7 +378,7 @@ func (s *Server) updateHandler(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, "bad request (value)", http.StatusBadRequest)
 		return
 	}
-	m := metric.Metric{ID: mname, MType: mtype}
+	m := metric.Metric{ID: mname, MType: mtype, Labels: queryLabels(req.URL.Query())}
 	if mtype == metric.Counter {
 		// ошибку не обрабатываем т.к выше вызывали функцию validate
 		delta, _ := strconv.ParseInt(mvalue, 10, 64)
@@ -211,31 +407,108 @@ func (s *Server) updatesHandlerJSON(res http.ResponseWriter, req *http.Request)
 	}
 
 	for _, m := range me {
-		//check metric name
-		if m.ID == "" {
+		switch err := m.Validate(); {
+		case errors.Is(err, metric.ErrMetricNotFound):
 			JSONError(res, "not found", http.StatusNotFound)
 			return
-		}
-
-		// check metric type
-		_, ok := metric.AllowedMetricType[m.MType]
-		if !ok {
+		case errors.Is(err, metric.ErrMetricBadType):
 			JSONError(res, "bad request (type)", http.StatusBadRequest)
 			return
+		case err != nil:
+			JSONError(res, "bad request (value)", http.StatusBadRequest)
+			return
 		}
 	}
 
-	ctx := req.Context()
-	if err := s.service.Update(ctx, me); err != nil {
-		logger.Log.Error("update", zap.Error(err))
+	ctx := metric.WithBatchID(req.Context(), req.Header.Get(metric.BatchIDHeader))
+	switch err := s.service.Update(ctx, me); {
+	case errors.Is(err, metric.ErrBatchInProgress):
+		JSONError(res, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, metric.ErrMetricBadType), errors.Is(err, metric.ErrMetricBadValue):
 		JSONError(res, err.Error(), http.StatusBadRequest)
 		return
+	case err != nil:
+		// ошибка хранилища временная, агент повторит пакет
+		logger.Log.Error("update", zap.Error(err))
+		JSONError(res, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	res.Header().Set("Content-Type", "application/json")
 	res.WriteHeader(http.StatusOK)
 }
 
+// queryLabels returns labels passed as query parameters, eg ?host=db1&env=prod
+func queryLabels(query url.Values, reserved ...string) metric.Labels {
+	var labels metric.Labels
+	for k, v := range query {
+		if len(v) == 0 || slices.Contains(reserved, k) {
+			continue
+		}
+		if labels == nil {
+			labels = make(metric.Labels)
+		}
+		labels[k] = v[0]
+	}
+
+	return labels
+}
+
+// parseTime parses unix seconds or RFC3339 time, empty value gives def
+func parseTime(value string, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseStep parses duration like 30s or number of seconds
+func parseStep(value string) (time.Duration, error) {
+	if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Second * time.Duration(sec), nil
+	}
+
+	return time.ParseDuration(value)
+}
+
+// formatValue returns metric value in human readable form
+func formatValue(m metric.Metric) string {
+	switch m.MType {
+	case metric.Gauge:
+		if m.Value != nil {
+			return strconv.FormatFloat(*m.Value, 'f', -1, 64)
+		}
+	case metric.Counter:
+		if m.Delta != nil {
+			return fmt.Sprintf("%d", *m.Delta)
+		}
+	case metric.Histogram:
+		if m.Count == nil || m.Sum == nil {
+			return ""
+		}
+
+		buckets := make([]string, 0, len(m.Counts))
+		for i, c := range m.Counts {
+			le := "+Inf"
+			if i < len(m.Buckets) {
+				le = strconv.FormatFloat(m.Buckets[i], 'f', -1, 64)
+			}
+			buckets = append(buckets, fmt.Sprintf("%s:%d", le, c))
+		}
+
+		return fmt.Sprintf("count=%d sum=%s buckets=[%s]",
+			*m.Count, strconv.FormatFloat(*m.Sum, 'f', -1, 64), strings.Join(buckets, " "))
+	}
+
+	return ""
+}
+
 // JSONError sends an error message in JSON format
 func JSONError(w http.ResponseWriter, msg string, code int) {
 	res := struct {
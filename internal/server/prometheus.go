@@ -0,0 +1,218 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+)
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// prometheusName converts metric ID to a valid prometheus metric name
+func prometheusName(id string) string {
+	var b strings.Builder
+	b.Grow(len(id))
+
+	for i, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+
+	if b.Len() == 0 {
+		return "_"
+	}
+
+	return b.String()
+}
+
+// prometheusLabels renders label set, extra pairs are appended as is.
+// Labels with the same prometheus name are rendered once, extra pairs win,
+// then the label which original name sorts first
+func prometheusLabels(labels metric.Labels, extra ...string) string {
+	pairs := make([]string, 0, len(labels)+len(extra)/2)
+
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	used := make(map[string]bool, len(labels)+len(extra)/2)
+	for i := 0; i+1 < len(extra); i += 2 {
+		used[extra[i]] = true
+	}
+
+	for _, k := range names {
+		name := strings.ReplaceAll(prometheusName(k), ":", "_")
+		if used[name] {
+			continue
+		}
+		used[name] = true
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, labelValueReplacer.Replace(labels[k])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], extra[i+1]))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// promSeries - серия метрики с именем семейства prometheus
+type promSeries struct {
+	name string
+	m    metric.Metric
+}
+
+// histogramSuffixes - имена серий семейства histogram
+var histogramSuffixes = []string{"_bucket", "_sum", "_count"}
+
+// writePrometheus writes metrics in prometheus text exposition format.
+// Series are grouped into families by prometheus name, a family has the type of its first series
+// in order counter, gauge, histogram: series of other types with the same name, duplicate series
+// and families named as histogram series of another family are skipped
+func writePrometheus(w io.Writer, list []metric.Metric) error {
+	sorted := make([]promSeries, 0, len(list))
+	for _, m := range list {
+		switch m.MType {
+		case metric.Gauge:
+			if m.Value == nil {
+				continue
+			}
+		case metric.Counter:
+			if m.Delta == nil {
+				continue
+			}
+		case metric.Histogram:
+			if m.Sum == nil || m.Count == nil || len(m.Counts) != len(m.Buckets)+1 {
+				continue
+			}
+		default:
+			continue
+		}
+		sorted = append(sorted, promSeries{name: prometheusName(m.ID), m: m})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if a.m.MType != b.m.MType {
+			return a.m.MType < b.m.MType
+		}
+		return a.m.Key() < b.m.Key()
+	})
+
+	types := make(map[string]string)
+	reserved := make(map[string]bool)
+	for _, s := range sorted {
+		if _, ok := types[s.name]; ok {
+			continue
+		}
+		types[s.name] = s.m.MType
+		if s.m.MType == metric.Histogram {
+			for _, suffix := range histogramSuffixes {
+				reserved[s.name+suffix] = true
+			}
+		}
+	}
+
+	var family string
+	seen := make(map[string]bool)
+	for _, s := range sorted {
+		name, m := s.name, s.m
+		if types[name] != m.MType || reserved[name] {
+			continue
+		}
+
+		labels := prometheusLabels(m.Labels)
+		if seen[name+labels] {
+			continue
+		}
+		seen[name+labels] = true
+
+		var samples []string
+		switch m.MType {
+		case metric.Gauge:
+			samples = append(samples, name+labels+" "+formatFloat(*m.Value))
+		case metric.Counter:
+			samples = append(samples, name+labels+" "+strconv.FormatInt(*m.Delta, 10))
+		case metric.Histogram:
+			samples = histogramSamples(name, m)
+		}
+
+		if family != name {
+			family = name
+			_, err := fmt.Fprintf(w, "# HELP %s %s %s\n# TYPE %s %s\n",
+				name, m.MType, helpReplacer.Replace(m.ID), name, m.MType)
+			if err != nil {
+				return err
+			}
+		}
+
+		if _, err := fmt.Fprintln(w, strings.Join(samples, "\n")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// histogramSamples returns cumulative buckets, sum and count samples of histogram
+func histogramSamples(name string, m metric.Metric) []string {
+	samples := make([]string, 0, len(m.Counts)+2)
+
+	// метка le занята границей корзины, пользовательская метка переименовывается
+	userLabels := m.Labels
+	if v, ok := m.Labels["le"]; ok {
+		userLabels = make(metric.Labels, len(m.Labels))
+		for k, v := range m.Labels {
+			userLabels[k] = v
+		}
+		delete(userLabels, "le")
+		userLabels["exported_le"] = v
+	}
+	labels := prometheusLabels(userLabels)
+
+	var cumulative uint64
+	for i, c := range m.Counts {
+		cumulative += c
+
+		le := "+Inf"
+		if i < len(m.Buckets) {
+			le = formatFloat(m.Buckets[i])
+		}
+		samples = append(samples,
+			fmt.Sprintf("%s_bucket%s %d", name, prometheusLabels(userLabels, "le", le), cumulative))
+	}
+
+	return append(samples,
+		name+"_sum"+labels+" "+formatFloat(*m.Sum),
+		name+"_count"+labels+" "+strconv.FormatUint(*m.Count, 10),
+	)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -65,13 +65,27 @@ func NewServer(runner *errgroup.Group, service metric.MetricService, cfg *Config
 		crypto.WithDecrypt(buf),
 	)
 
+	// операции администратора выполняются только с подписью метода, пути и запроса
+	adminMdw := []middleware.Middleware{
+		hash.WithRequestHash(cfg.Key),
+		compress.WithGzip,
+		logger.WithLogging,
+		subnet.WithTructedSubnets(cfg.TrustedSubnet),
+	}
+
 	mux.Get(`/`, middleware.Combine(s.listMetricHandler, mdw...))
+	mux.Get(`/metrics`, middleware.Combine(s.prometheusHandler, mdw...))
 	mux.Get(`/ping`, logger.WithLogging(s.pingDBHandler))
 	mux.Post(`/update/`, middleware.Combine(s.updateHandlerJSON, mdw...))
 	mux.Post(`/updates/`, middleware.Combine(s.updatesHandlerJSON, updatesMdw...))
 	mux.Post(`/value/`, middleware.Combine(s.getMetricHandlerJSON, mdw...))
 	mux.Get(`/value/{type}/{name}`, logger.WithLogging(s.getMetricHandler))
+	mux.Get(`/history/{type}/{name}`, middleware.Combine(s.historyHandler, mdw...))
+	mux.Get(`/events`, logger.WithLogging(s.eventsHandler))
 	mux.Post(`/update/{type}/{name}/{value}`, logger.WithLogging(s.updateHandler))
+	mux.Delete(`/value/`, middleware.Combine(s.deletePrefixHandler, adminMdw...))
+	mux.Delete(`/value/{type}/{name}`, middleware.Combine(s.deleteHandler, adminMdw...))
+	mux.Post(`/reset/{type}/{name}`, middleware.Combine(s.resetHandler, adminMdw...))
 
 	mux.Mount("/debug", chimiddle.Profiler())
 
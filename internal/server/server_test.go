@@ -12,13 +12,18 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/golang/mock/gomock"
+	"github.com/nbvehbq/go-metrics-harvester/internal/hash"
 	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
 	"github.com/nbvehbq/go-metrics-harvester/internal/metric/mocks"
+	"github.com/nbvehbq/go-metrics-harvester/internal/storage"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/sync/errgroup"
 )
@@ -77,7 +82,15 @@ func TestServer_updatesServerJSON(t *testing.T) {
 		},
 		{
 			name: "wrong type",
-			body: []byte(`[{"id":"test","type":"histogram","delta":42}]`),
+			body: []byte(`[{"id":"test","type":"summary","delta":42}]`),
+			want: want{
+				code:        400,
+				contentType: "application/json",
+			},
+		},
+		{
+			name: "malformed histogram",
+			body: []byte(`[{"id":"test","type":"histogram","buckets":[1,0.5],"counts":[1,1,1],"sum":2,"count":3}]`),
 			want: want{
 				code:        400,
 				contentType: "application/json",
@@ -119,6 +132,39 @@ func TestServer_updatesServerJSON(t *testing.T) {
 	}
 }
 
+func TestServer_updatesBatchID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mocks.NewMockMetricService(ctrl)
+
+	gomock.InOrder(
+		m.EXPECT().Update(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, _ []metric.Metric) error {
+				assert.Equal(t, "batch-1", metric.BatchID(ctx))
+				return nil
+			}),
+		m.EXPECT().Update(gomock.Any(), gomock.Any()).Return(metric.ErrBatchInProgress),
+		// недоступность хранилища не отклоняет пакет навсегда
+		m.EXPECT().Update(gomock.Any(), gomock.Any()).Return(errors.New("connection refused")),
+	)
+
+	srv, err := NewServer(&errgroup.Group{}, m, &Config{})
+	assert.NoError(t, err)
+
+	for _, code := range []int{http.StatusOK, http.StatusConflict, http.StatusInternalServerError} {
+		req := httptest.NewRequest(http.MethodPost, "/updates/",
+			bytes.NewBufferString(`[{"id":"PollCount","type":"counter","delta":1}]`))
+		req.Header.Set(metric.BatchIDHeader, "batch-1")
+		w := httptest.NewRecorder()
+
+		srv.updatesHandlerJSON(w, req)
+
+		res := w.Result()
+		res.Body.Close()
+		assert.Equal(t, code, res.StatusCode)
+	}
+}
+
 func TestServer_updateHandlerJSON(t *testing.T) {
 	type want struct {
 		code        int
@@ -229,7 +275,7 @@ func TestServer_updateHandlerJSON(t *testing.T) {
 					Return(errors.New("new error"))
 			}
 
-			m.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).
+			m.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 				Return(&metric.Metric{}, nil).AnyTimes()
 			m.EXPECT().SaveToFile(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 
@@ -306,7 +352,7 @@ func TestServer_getMetricHandlerJSON(t *testing.T) {
 			w := httptest.NewRecorder()
 
 			m.EXPECT().
-				Get(gomock.Any(), test.want.metric.ID, test.want.metric.MType).
+				Get(gomock.Any(), test.want.metric.ID, test.want.metric.MType, gomock.Any()).
 				Return(&test.want.metric, test.want.res)
 
 			runner, _ := errgroup.WithContext(req.Context())
@@ -359,9 +405,9 @@ func TestServer_listMetricHandler(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			if test.storageError {
-				m.EXPECT().List(gomock.Any()).Return([]metric.Metric{}, errors.New("storage error"))
+				m.EXPECT().List(gomock.Any(), gomock.Any()).Return([]metric.Metric{}, errors.New("storage error"))
 			} else {
-				m.EXPECT().List(gomock.Any()).Return([]metric.Metric{}, nil)
+				m.EXPECT().List(gomock.Any(), gomock.Any()).Return([]metric.Metric{}, nil)
 			}
 			req := httptest.NewRequest(http.MethodGet, "/", nil)
 			w := httptest.NewRecorder()
@@ -380,6 +426,424 @@ func TestServer_listMetricHandler(t *testing.T) {
 	}
 }
 
+func TestServer_prometheusHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mocks.NewMockMetricService(ctrl)
+
+	value := 1.5
+	sum, count := 3.5, uint64(4)
+	m.EXPECT().List(gomock.Any(), gomock.Any()).Return([]metric.Metric{
+		{ID: "PollCount", MType: metric.Counter, Delta: intPtr(42)},
+		{ID: "1cpu.load", MType: metric.Gauge, Value: &value},
+		{ID: "latency", MType: metric.Histogram, Buckets: []float64{0.5, 1},
+			Counts: []uint64{1, 2, 1}, Sum: &sum, Count: &count},
+		{ID: "cpu", MType: metric.Gauge, Value: &value, Labels: metric.Labels{"host": "b"}},
+		{ID: "cpu", MType: metric.Gauge, Value: &value, Labels: metric.Labels{"host": "a\"1\""}},
+	}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+
+	runner, _ := errgroup.WithContext(req.Context())
+	srv, err := NewServer(runner, m, &Config{})
+	assert.NoError(t, err)
+	srv.prometheusHandler(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+
+	want := "# HELP PollCount counter PollCount\n" +
+		"# TYPE PollCount counter\n" +
+		"PollCount 42\n" +
+		"# HELP _1cpu_load gauge 1cpu.load\n" +
+		"# TYPE _1cpu_load gauge\n" +
+		"_1cpu_load 1.5\n" +
+		"# HELP cpu gauge cpu\n" +
+		"# TYPE cpu gauge\n" +
+		"cpu{host=\"a\\\"1\\\"\"} 1.5\n" +
+		"cpu{host=\"b\"} 1.5\n" +
+		"# HELP latency histogram latency\n" +
+		"# TYPE latency histogram\n" +
+		"latency_bucket{le=\"0.5\"} 1\n" +
+		"latency_bucket{le=\"1\"} 3\n" +
+		"latency_bucket{le=\"+Inf\"} 4\n" +
+		"latency_sum 3.5\n" +
+		"latency_count 4\n"
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, prometheusContentType, res.Header.Get("Content-Type"))
+	assert.Equal(t, want, w.Body.String())
+}
+
+func TestServer_writePrometheusConflicts(t *testing.T) {
+	one, two := 1.0, 2.0
+	sum, count := 1.0, uint64(1)
+	hist := metric.Metric{ID: "latency", MType: metric.Histogram, Buckets: []float64{1},
+		Counts: []uint64{1, 0}, Sum: &sum, Count: &count}
+
+	tests := []struct {
+		name string
+		list []metric.Metric
+		want string
+	}{
+		{
+			name: "ids with the same name",
+			list: []metric.Metric{
+				{ID: "cpu.load", MType: metric.Gauge, Value: &one},
+				{ID: "cpu_load", MType: metric.Gauge, Value: &two},
+				{ID: "cpu_load", MType: metric.Gauge, Value: &two, Labels: metric.Labels{"core": "1"}},
+				{ID: "cpu-load", MType: metric.Gauge, Value: &two, Labels: metric.Labels{"core": "0"}},
+			},
+			want: "# HELP cpu_load gauge cpu-load\n" +
+				"# TYPE cpu_load gauge\n" +
+				"cpu_load{core=\"0\"} 2\n" +
+				"cpu_load 1\n" +
+				"cpu_load{core=\"1\"} 2\n",
+		},
+		{
+			name: "name with different types",
+			list: []metric.Metric{
+				{ID: "requests", MType: metric.Gauge, Value: &one, Labels: metric.Labels{"code": "200"}},
+				{ID: "requests", MType: metric.Counter, Delta: intPtr(5), Labels: metric.Labels{"code": "500"}},
+				{ID: "requests", MType: metric.Gauge, Value: &two},
+			},
+			want: "# HELP requests counter requests\n" +
+				"# TYPE requests counter\n" +
+				"requests{code=\"500\"} 5\n",
+		},
+		{
+			name: "histogram series names",
+			list: []metric.Metric{
+				{ID: "latency_count", MType: metric.Counter, Delta: intPtr(5)},
+				{ID: "latency.sum", MType: metric.Gauge, Value: &one},
+				hist,
+			},
+			want: "# HELP latency histogram latency\n" +
+				"# TYPE latency histogram\n" +
+				"latency_bucket{le=\"1\"} 1\n" +
+				"latency_bucket{le=\"+Inf\"} 1\n" +
+				"latency_sum 1\n" +
+				"latency_count 1\n",
+		},
+		{
+			name: "histogram with le label",
+			list: []metric.Metric{
+				{ID: "latency", MType: metric.Histogram, Buckets: []float64{1}, Counts: []uint64{1, 0},
+					Sum: &sum, Count: &count, Labels: metric.Labels{"le": "x"}},
+			},
+			want: "# HELP latency histogram latency\n" +
+				"# TYPE latency histogram\n" +
+				"latency_bucket{exported_le=\"x\",le=\"1\"} 1\n" +
+				"latency_bucket{exported_le=\"x\",le=\"+Inf\"} 1\n" +
+				"latency_sum{exported_le=\"x\"} 1\n" +
+				"latency_count{exported_le=\"x\"} 1\n",
+		},
+		{
+			name: "help escaping",
+			list: []metric.Metric{
+				{ID: "disk\\c:\nused", MType: metric.Gauge, Value: &one},
+			},
+			want: "# HELP disk_c:_used gauge disk\\\\c:\\nused\n" +
+				"# TYPE disk_c:_used gauge\n" +
+				"disk_c:_used 1\n",
+		},
+		{
+			name: "label names with the same name",
+			list: []metric.Metric{
+				{ID: "cpu", MType: metric.Gauge, Value: &one, Labels: metric.Labels{"host.name": "a", "host_name": "b"}},
+			},
+			want: "# HELP cpu gauge cpu\n" +
+				"# TYPE cpu gauge\n" +
+				"cpu{host_name=\"a\"} 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			assert.NoError(t, writePrometheus(&b, tt.list))
+			assert.Equal(t, tt.want, b.String())
+		})
+	}
+}
+
+func TestServer_prometheusName(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{id: "HeapAlloc", want: "HeapAlloc"},
+		{id: "CPUutilization1", want: "CPUutilization1"},
+		{id: "disk./var.used", want: "disk__var_used"},
+		{id: "9lives", want: "_9lives"},
+		{id: "", want: "_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			assert.Equal(t, tt.want, prometheusName(tt.id))
+		})
+	}
+}
+
+func TestServer_historyHandler(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		res   error
+		code  int
+	}{
+		{name: "samples", query: "?from=1700000000&to=2023-11-15T00:00:00Z&host=db1", code: 200},
+		{name: "bad from", query: "?from=yesterday", code: 400},
+		{name: "bad step", query: "?step=often", code: 400},
+		{name: "range", query: "?step=1m&agg=max", code: 200},
+		{name: "bad aggregate", query: "?step=60&agg=median", res: metric.ErrBadAggregate, code: 400},
+		{name: "not found", res: metric.ErrMetricNotFound, code: 404},
+		{name: "not supported", res: storage.ErrNotSupported, code: 501},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mocks.NewMockMetricService(ctrl)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/history/counter/PollCount"+tt.query, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("type", metric.Counter)
+			rctx.URLParams.Add("name", "PollCount")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+
+			samples := []metric.Sample{{Timestamp: time.Unix(1700000000, 0), Delta: intPtr(1)}}
+			switch {
+			case strings.Contains(tt.query, "agg="):
+				m.EXPECT().
+					Range(gomock.Any(), "PollCount", metric.Counter, gomock.Any(), gomock.Any(), gomock.Any(),
+						time.Minute, gomock.Any()).
+					Return(samples, tt.res)
+			case tt.code != 400:
+				m.EXPECT().
+					History(gomock.Any(), "PollCount", metric.Counter, gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(samples, tt.res)
+			}
+
+			runner, _ := errgroup.WithContext(req.Context())
+			srv, err := NewServer(runner, m, &Config{})
+			assert.NoError(t, err)
+			srv.historyHandler(w, req)
+
+			res := w.Result()
+			res.Body.Close()
+			assert.Equal(t, tt.code, res.StatusCode)
+			assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+		})
+	}
+}
+
+func TestServer_eventsHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		lastID string
+		filter metric.WatchFilter
+		res    error
+		code   int
+		want   string
+	}{
+		{
+			name:   "stream",
+			query:  "?id=PollCount&type=counter",
+			lastID: "41",
+			filter: metric.WatchFilter{ID: "PollCount", MType: metric.Counter, After: 41},
+			code:   200,
+			want: "id: 42\ndata: {\"id\":\"PollCount\",\"type\":\"counter\",\"delta\":5}\n\n" +
+				"id: 43\nevent: deleted\ndata: {\"id\":\"PollCount\",\"type\":\"counter\",\"delta\":6}\n\n",
+		},
+		{name: "bad last event id", lastID: "last", code: 400},
+		{name: "bad type", query: "?type=summary", filter: metric.WatchFilter{MType: "summary"},
+			res: metric.ErrMetricBadType, code: 400},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mocks.NewMockMetricService(ctrl)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/events"+tt.query, nil)
+			if tt.lastID != "" {
+				req.Header.Set(lastEventIDHeader, tt.lastID)
+			}
+			w := httptest.NewRecorder()
+
+			if tt.code != 400 || tt.res != nil {
+				events := make(chan metric.Event, 2)
+				events <- metric.Event{Seq: 42, Metric: metric.Metric{ID: "PollCount", MType: metric.Counter, Delta: intPtr(5)}}
+				events <- metric.Event{Seq: 43, Metric: metric.Metric{ID: "PollCount", MType: metric.Counter, Delta: intPtr(6)}, Deleted: true}
+				close(events)
+
+				var ch <-chan metric.Event = events
+				if tt.res != nil {
+					ch = nil
+				}
+				m.EXPECT().Watch(gomock.Any(), tt.filter).Return(ch, tt.res)
+			}
+
+			runner, _ := errgroup.WithContext(req.Context())
+			srv, err := NewServer(runner, m, &Config{})
+			assert.NoError(t, err)
+			srv.eventsHandler(w, req)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.code, res.StatusCode)
+			if tt.code == 200 {
+				assert.Equal(t, eventStreamContentType, res.Header.Get("Content-Type"))
+				assert.Equal(t, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestServer_deleteHandler(t *testing.T) {
+	tests := []struct {
+		name  string
+		mtype string
+		res   error
+		code  int
+	}{
+		{name: "deleted", mtype: metric.Counter, code: 200},
+		{name: "not found", mtype: metric.Counter, res: metric.ErrMetricNotFound, code: 404},
+		{name: "bad type", mtype: "summary", res: metric.ErrMetricBadType, code: 400},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mocks.NewMockMetricService(ctrl)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/value/"+tt.mtype+"/PollCount?host=db1", nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("type", tt.mtype)
+			rctx.URLParams.Add("name", "PollCount")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+
+			m.EXPECT().Delete(gomock.Any(), "PollCount", tt.mtype, metric.Labels{"host": "db1"}).Return(tt.res)
+
+			runner, _ := errgroup.WithContext(req.Context())
+			srv, err := NewServer(runner, m, &Config{})
+			assert.NoError(t, err)
+			srv.deleteHandler(w, req)
+
+			res := w.Result()
+			res.Body.Close()
+			assert.Equal(t, tt.code, res.StatusCode)
+		})
+	}
+}
+
+func TestServer_adminSignature(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mocks.NewMockMetricService(ctrl)
+
+	runner, _ := errgroup.WithContext(context.Background())
+	srv, err := NewServer(runner, m, &Config{Key: "secret"})
+	assert.NoError(t, err)
+
+	sign := hash.SignRequest("secret", http.MethodDelete, "/value/counter/PollCount", nil)
+	serve := func(method, target string) int {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set(hash.HashHeaderKey, sign)
+		w := httptest.NewRecorder()
+		srv.srv.Handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// подпись удаления одной серии не подходит для других операций
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodDelete, "/value/counter/HeapAlloc"))
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodDelete, "/value/?prefix=P"))
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/reset/counter/PollCount"))
+
+	m.EXPECT().Delete(gomock.Any(), "PollCount", metric.Counter, gomock.Any()).Return(nil)
+	assert.Equal(t, http.StatusOK, serve(http.MethodDelete, "/value/counter/PollCount"))
+}
+
+func TestServer_deletePrefixHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mocks.NewMockMetricService(ctrl)
+
+	m.EXPECT().DeletePrefix(gomock.Any(), "Heap").Return(int64(3), nil)
+	m.EXPECT().DeletePrefix(gomock.Any(), "").Return(int64(0), metric.ErrEmptyPrefix)
+
+	runner, _ := errgroup.WithContext(context.Background())
+	srv, err := NewServer(runner, m, &Config{})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	srv.deletePrefixHandler(w, httptest.NewRequest(http.MethodDelete, "/value/?prefix=Heap", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"deleted":3}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	srv.deletePrefixHandler(w, httptest.NewRequest(http.MethodDelete, "/value/", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestServer_resetHandler(t *testing.T) {
+	tests := []struct {
+		name  string
+		mtype string
+		value *metric.Metric
+		res   error
+		code  int
+		want  string
+	}{
+		{name: "reset", mtype: metric.Counter, code: 200, want: "0",
+			value: &metric.Metric{ID: "PollCount", MType: metric.Counter, Delta: intPtr(0)}},
+		{name: "gauge", mtype: metric.Gauge, res: metric.ErrMetricBadType, code: 400},
+		{name: "not found", mtype: metric.Counter, res: metric.ErrMetricNotFound, code: 404},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mocks.NewMockMetricService(ctrl)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/reset/"+tt.mtype+"/PollCount", nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("type", tt.mtype)
+			rctx.URLParams.Add("name", "PollCount")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+
+			m.EXPECT().Reset(gomock.Any(), "PollCount", tt.mtype, gomock.Any()).Return(tt.value, tt.res)
+
+			runner, _ := errgroup.WithContext(req.Context())
+			srv, err := NewServer(runner, m, &Config{})
+			assert.NoError(t, err)
+			srv.resetHandler(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if tt.code == 200 {
+				assert.Equal(t, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestServer_queryLabels(t *testing.T) {
+	query := url.Values{"host": {"db1"}, "env": {"prod"}, "from": {"10"}}
+
+	assert.Equal(t, metric.Labels{"host": "db1", "env": "prod"}, queryLabels(query, "from"))
+	assert.Nil(t, queryLabels(url.Values{}))
+}
+
 func TestServer_getMetricHandler(t *testing.T) {
 	type want struct {
 		code        int
@@ -442,7 +906,7 @@ func TestServer_getMetricHandler(t *testing.T) {
 			w := httptest.NewRecorder()
 
 			m.EXPECT().
-				Get(gomock.Any(), test.want.metric.ID, test.want.metric.MType).
+				Get(gomock.Any(), test.want.metric.ID, test.want.metric.MType, gomock.Any()).
 				Return(&test.want.metric, test.want.res)
 
 			runner, _ := errgroup.WithContext(req.Context())
@@ -476,6 +940,15 @@ func TestServer_updateHandler(t *testing.T) {
 	}{
 		{
 			name: "wrong type",
+			arg:  arg{name: "test", mtype: "summary", value: "42"},
+			want: want{
+				code:        400,
+				response:    `{"status":"ok"}`,
+				contentType: "text/plain; charset=utf-8",
+			},
+		},
+		{
+			name: "histogram value",
 			arg:  arg{name: "test", mtype: "histogram", value: "42"},
 			want: want{
 				code:        400,
@@ -0,0 +1,44 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
+)
+
+// ring - кольцевой буфер последних значений серии
+type ring struct {
+	samples []metric.Sample
+	next    int
+	full    bool
+}
+
+func newRing(depth int) *ring {
+	return &ring{samples: make([]metric.Sample, depth)}
+}
+
+func (r *ring) push(s metric.Sample) {
+	r.samples[r.next] = s
+	r.next = (r.next + 1) % len(r.samples)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// rangeOf returns samples in [from, to] ordered by time
+func (r *ring) rangeOf(from, to time.Time) []metric.Sample {
+	ordered := r.samples[:r.next]
+	if r.full {
+		ordered = append(r.samples[r.next:len(r.samples):len(r.samples)], r.samples[:r.next]...)
+	}
+
+	var res []metric.Sample
+	for _, s := range ordered {
+		if s.Timestamp.Before(from) || s.Timestamp.After(to) {
+			continue
+		}
+		res = append(res, s)
+	}
+
+	return res
+}
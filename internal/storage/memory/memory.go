@@ -5,7 +5,9 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
 	"github.com/nbvehbq/go-metrics-harvester/internal/storage"
@@ -15,6 +17,10 @@ import (
 type Storage struct {
 	mu      *sync.RWMutex
 	storage map[string]metric.Metric
+
+	history   map[string]*ring
+	depth     int
+	retention time.Duration
 }
 
 // NewFrom - creates a new memory storage from io.Reader interface
@@ -26,7 +32,7 @@ func NewFrom(src io.Reader) (*Storage, error) {
 
 	s := make(map[string]metric.Metric, len(list))
 	for _, m := range list {
-		s[m.ID] = m
+		s[m.Key()] = m
 	}
 
 	return &Storage{storage: s, mu: &sync.RWMutex{}}, nil
@@ -39,6 +45,54 @@ func NewMemStorage() *Storage {
 	return &Storage{storage: s, mu: &sync.RWMutex{}}
 }
 
+// EnableHistory - keep last depth samples of every series no older than retention.
+// Zero retention means samples are limited by depth only.
+func (s *Storage) EnableHistory(depth int, retention time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.depth = depth
+	s.retention = retention
+	s.history = make(map[string]*ring)
+}
+
+// record - save current value of the series to history, caller must hold the lock
+func (s *Storage) record(key string, ts time.Time) {
+	if s.depth <= 0 {
+		return
+	}
+
+	r, ok := s.history[key]
+	if !ok {
+		r = newRing(s.depth)
+		s.history[key] = r
+	}
+	r.push(metric.NewSample(s.storage[key], ts))
+}
+
+// History - get samples of the series in time range
+func (s *Storage) History(_ context.Context, key string, from, to time.Time) ([]metric.Sample, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.depth <= 0 {
+		return nil, storage.ErrNotSupported
+	}
+
+	r, ok := s.history[key]
+	if !ok {
+		return nil, nil
+	}
+
+	if s.retention > 0 {
+		if oldest := time.Now().Add(-s.retention); from.Before(oldest) {
+			from = oldest
+		}
+	}
+
+	return r.rangeOf(from, to), nil
+}
+
 // Persist - save metrics to io.Writer
 func (s *Storage) Persist(_ context.Context, dest io.Writer) error {
 	s.mu.Lock()
@@ -69,9 +123,16 @@ func (s *Storage) Set(_ context.Context, value metric.Metric) error {
 		return storage.ErrMetricMalformed
 	}
 
-	v, ok := s.storage[value.ID]
+	if value.MType == metric.Histogram && (value.Sum == nil || value.Count == nil) {
+		return storage.ErrMetricMalformed
+	}
+
+	key := value.Key()
+	defer s.record(key, time.Now())
+
+	v, ok := s.storage[key]
 	if !ok {
-		s.storage[value.ID] = value
+		s.storage[key] = value
 		return nil
 	}
 
@@ -80,14 +141,18 @@ func (s *Storage) Set(_ context.Context, value metric.Metric) error {
 		val := *value.Value
 		v.Value = &val
 	case metric.Counter:
-		*v.Delta += *value.Delta
+		// новое значение вместо изменения на месте: прочитанные копии метрики не меняются
+		delta := *v.Delta + *value.Delta
+		v.Delta = &delta
+	case metric.Histogram:
+		metric.MergeHistogram(&v, value)
 	}
 
-	s.storage[value.ID] = v
+	s.storage[key] = v
 	return nil
 }
 
-// Get - get metric
+// Get - get metric by series key
 func (s *Storage) Get(_ context.Context, key string) (metric.Metric, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -118,10 +183,13 @@ func (s *Storage) Update(_ context.Context, m []metric.Metric) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	now := time.Now()
 	for _, value := range m {
-		v, ok := s.storage[value.ID]
+		key := value.Key()
+		v, ok := s.storage[key]
 		if !ok {
-			s.storage[value.ID] = value
+			s.storage[key] = value
+			s.record(key, now)
 			continue
 		}
 
@@ -130,11 +198,76 @@ func (s *Storage) Update(_ context.Context, m []metric.Metric) error {
 			val := *value.Value
 			v.Value = &val
 		case metric.Counter:
-			*v.Delta += *value.Delta
+			delta := *v.Delta + *value.Delta
+			v.Delta = &delta
+		case metric.Histogram:
+			metric.MergeHistogram(&v, value)
 		}
 
-		s.storage[value.ID] = v
+		s.storage[key] = v
+		s.record(key, now)
 	}
 
 	return nil
 }
+
+// Delete - remove series and its history
+func (s *Storage) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.storage[key]; !ok {
+		return metric.ErrMetricNotFound
+	}
+
+	delete(s.storage, key)
+	delete(s.history, key)
+
+	return nil
+}
+
+// DeletePrefix - remove all series which names start with prefix
+func (s *Storage) DeletePrefix(_ context.Context, prefix string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for key, v := range s.storage {
+		if strings.HasPrefix(v.ID, prefix) {
+			delete(s.storage, key)
+			delete(s.history, key)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// Reset - zero counter or histogram observations
+func (s *Storage) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.storage[key]
+	if !ok {
+		return metric.ErrMetricNotFound
+	}
+
+	switch v.MType {
+	case metric.Counter:
+		var zero int64
+		v.Delta = &zero
+	case metric.Histogram:
+		var sum float64
+		var count uint64
+		v.Counts = make([]uint64, len(v.Counts))
+		v.Sum, v.Count = &sum, &count
+	default:
+		return metric.ErrMetricBadType
+	}
+
+	s.storage[key] = v
+	s.record(key, time.Now())
+
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/nbvehbq/go-metrics-harvester/internal/metric"
 	"github.com/nbvehbq/go-metrics-harvester/internal/storage"
@@ -109,6 +110,128 @@ func TestStorageUpdate(t *testing.T) {
 	}
 }
 
+func TestStorageHistogram(t *testing.T) {
+	tests := []struct {
+		name  string
+		value metric.Metric
+		want  metric.Metric
+	}{
+		{
+			name: "merge observations",
+			value: metric.Metric{ID: "h", MType: metric.Histogram, Buckets: []float64{1, 2},
+				Counts: []uint64{1, 0, 1}, Sum: ptr(3.5), Count: ptr[uint64](2)},
+			want: metric.Metric{ID: "h", MType: metric.Histogram, Buckets: []float64{1, 2},
+				Counts: []uint64{2, 1, 1}, Sum: ptr(5.0), Count: ptr[uint64](4)},
+		},
+		{
+			name: "replace on bounds change",
+			value: metric.Metric{ID: "h", MType: metric.Histogram, Buckets: []float64{5},
+				Counts: []uint64{1, 0}, Sum: ptr(1.0), Count: ptr[uint64](1)},
+			want: metric.Metric{ID: "h", MType: metric.Histogram, Buckets: []float64{5},
+				Counts: []uint64{1, 0}, Sum: ptr(1.0), Count: ptr[uint64](1)},
+		},
+	}
+
+	mem, err := NewFrom(strings.NewReader(
+		`[{"id":"h","type":"histogram","buckets":[1,2],"counts":[1,1,0],"sum":1.5,"count":2}]`))
+	assert.NoError(t, err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := mem.Set(context.Background(), tt.value)
+			assert.NoError(t, err)
+
+			res, _ := mem.Get(context.Background(), tt.want.ID)
+			assert.Equal(t, tt.want, res)
+		})
+	}
+}
+
+func TestStorageLabels(t *testing.T) {
+	mem := NewMemStorage()
+	ctx := context.Background()
+
+	one := metric.Metric{ID: "cpu", MType: metric.Gauge, Value: ptr(1.0), Labels: metric.Labels{"host": "one"}}
+	two := metric.Metric{ID: "cpu", MType: metric.Gauge, Value: ptr(2.0), Labels: metric.Labels{"host": "two"}}
+	assert.NoError(t, mem.Update(ctx, []metric.Metric{one, two}))
+
+	list, err := mem.List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	res, ok := mem.Get(ctx, two.Key())
+	assert.True(t, ok)
+	assert.Equal(t, two, res)
+
+	_, ok = mem.Get(ctx, "cpu")
+	assert.False(t, ok)
+}
+
+func TestStorageHistory(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemStorage()
+
+	_, err := mem.History(ctx, "count", time.Time{}, time.Now())
+	assert.Equal(t, storage.ErrNotSupported, err)
+
+	mem.EnableHistory(3, time.Hour)
+
+	from := time.Now()
+	for range 5 {
+		err := mem.Set(ctx, metric.Metric{ID: "count", MType: metric.Counter, Delta: ptr[int64](1)})
+		assert.NoError(t, err)
+	}
+
+	samples, err := mem.History(ctx, "count", from, time.Now())
+	assert.NoError(t, err)
+	assert.Len(t, samples, 3)
+	for i, s := range samples {
+		assert.Equal(t, int64(i+3), *s.Delta)
+	}
+
+	samples, err = mem.History(ctx, "count", time.Now().Add(time.Minute), time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, samples)
+}
+
+func TestStorageDelete(t *testing.T) {
+	ctx := context.Background()
+	mem, err := NewFrom(strings.NewReader(
+		`[{"id":"HeapAlloc","type":"gauge","value":1},{"id":"HeapSys","type":"gauge","value":2},{"id":"PollCount","type":"counter","delta":5}]`))
+	assert.NoError(t, err)
+
+	assert.NoError(t, mem.Delete(ctx, "PollCount"))
+	assert.Equal(t, metric.ErrMetricNotFound, mem.Delete(ctx, "PollCount"))
+
+	n, err := mem.DeletePrefix(ctx, "Heap")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	list, err := mem.List(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestStorageReset(t *testing.T) {
+	ctx := context.Background()
+	mem, err := NewFrom(strings.NewReader(
+		`[{"id":"PollCount","type":"counter","delta":5},{"id":"Alloc","type":"gauge","value":1},` +
+			`{"id":"h","type":"histogram","buckets":[1],"counts":[1,1],"sum":3,"count":2}]`))
+	assert.NoError(t, err)
+
+	assert.NoError(t, mem.Reset(ctx, "PollCount"))
+	res, _ := mem.Get(ctx, "PollCount")
+	assert.Equal(t, int64(0), *res.Delta)
+
+	assert.NoError(t, mem.Reset(ctx, "h"))
+	res, _ = mem.Get(ctx, "h")
+	assert.Equal(t, []uint64{0, 0}, res.Counts)
+	assert.Equal(t, 0.0, *res.Sum)
+	assert.Equal(t, uint64(0), *res.Count)
+
+	assert.Equal(t, metric.ErrMetricBadType, mem.Reset(ctx, "Alloc"))
+	assert.Equal(t, metric.ErrMetricNotFound, mem.Reset(ctx, "unknown"))
+}
+
 func TestStoragePersist(t *testing.T) {
 	str := `[{"id":"one","type":"gauge","value":10.5},{"id":"two","type":"counter","delta":10}]
 `
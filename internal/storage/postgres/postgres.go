@@ -5,7 +5,9 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"io"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	pq "github.com/lib/pq"
@@ -15,18 +17,169 @@ import (
 	"github.com/nbvehbq/go-metrics-harvester/pkg/retry"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
 )
 
 const (
 	insertQuery = `
-	INSERT INTO metric (id, mtype, delta, value)
-	VALUES ($1, $2, $3, $4)
-	ON CONFLICT(id)
-	DO UPDATE SET 
-		delta = EXCLUDED.delta + metric.delta, 
-		value = EXCLUDED.value;`
+	WITH upsert AS (
+		INSERT INTO metric (key, id, mtype, labels, delta, value, buckets, counts, sum, count)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT(key)
+		DO UPDATE SET 
+			delta = EXCLUDED.delta + metric.delta, 
+			value = EXCLUDED.value,
+			buckets = EXCLUDED.buckets,
+			counts = CASE WHEN metric.buckets = EXCLUDED.buckets
+				THEN ARRAY(
+					SELECT a + b
+					FROM unnest(metric.counts, EXCLUDED.counts) WITH ORDINALITY AS t(a, b, n)
+					ORDER BY n)
+				ELSE EXCLUDED.counts END,
+			sum = CASE WHEN metric.buckets = EXCLUDED.buckets
+				THEN metric.sum + EXCLUDED.sum ELSE EXCLUDED.sum END,
+			count = CASE WHEN metric.buckets = EXCLUDED.buckets
+				THEN metric.count + EXCLUDED.count ELSE EXCLUDED.count END
+		RETURNING key, mtype, delta, value, sum, count
+	)
+	INSERT INTO metric_sample (key, ts, delta, value)
+	SELECT
+		key,
+		now(),
+		CASE WHEN mtype = 'histogram' THEN count ELSE delta END,
+		CASE WHEN mtype = 'histogram' THEN sum ELSE value END
+	FROM upsert;`
+
+	historyQuery = `
+	SELECT ts, delta, value
+	FROM metric_sample
+	WHERE key = $1 AND ts >= $2 AND ts <= $3
+	ORDER BY ts;`
+
+	aggregateQuery = `
+	SELECT
+		to_timestamp(floor(extract(epoch FROM ts) / $4) * $4) AS ts,
+		%s AS delta,
+		%s AS value
+	FROM metric_sample
+	WHERE key = $1 AND ts >= $2 AND ts <= $3
+	GROUP BY 1
+	ORDER BY 1;`
+
+	deleteQuery = `
+	WITH removed AS (
+		DELETE FROM metric WHERE %s RETURNING key
+	), samples AS (
+		DELETE FROM metric_sample WHERE key IN (SELECT key FROM removed)
+	)
+	SELECT count(*) FROM removed;`
+
+	resetQuery = `
+	WITH reset AS (
+		UPDATE metric SET
+			delta = CASE WHEN mtype = 'counter' THEN 0 ELSE delta END,
+			counts = CASE WHEN mtype = 'histogram'
+				THEN array_fill(0::BIGINT, ARRAY[cardinality(counts)]) ELSE counts END,
+			sum = CASE WHEN mtype = 'histogram' THEN 0 ELSE sum END,
+			count = CASE WHEN mtype = 'histogram' THEN 0 ELSE count END
+		WHERE key = $1 AND mtype IN ('counter', 'histogram')
+		RETURNING key, mtype, delta, sum, count
+	)
+	INSERT INTO metric_sample (key, ts, delta, value)
+	SELECT
+		key,
+		now(),
+		CASE WHEN mtype = 'histogram' THEN count ELSE delta END,
+		CASE WHEN mtype = 'histogram' THEN sum END
+	FROM reset;`
+
+	pruneInterval = time.Minute
+
+	selectColumns = `id, mtype, labels, delta, value, buckets, counts, sum, count`
 )
 
+// aggregates - выражения агрегации колонок delta и value
+var aggregates = map[string][2]string{
+	metric.AggMin:  {`min(delta)`, `min(value)`},
+	metric.AggMax:  {`max(delta)`, `max(value)`},
+	metric.AggAvg:  {`round(avg(delta))::BIGINT`, `avg(value)`},
+	metric.AggSum:  {`sum(delta)::BIGINT`, `sum(value)`},
+	metric.AggLast: {`(array_agg(delta ORDER BY ts DESC))[1]`, `(array_agg(value ORDER BY ts DESC))[1]`},
+}
+
+// row - представление метрики в таблице metric
+type row struct {
+	ID      string          `db:"id"`
+	MType   string          `db:"mtype"`
+	Labels  metric.Labels   `db:"labels"`
+	Delta   *int64          `db:"delta"`
+	Value   *float64        `db:"value"`
+	Buckets pq.Float64Array `db:"buckets"`
+	Counts  pq.Int64Array   `db:"counts"`
+	Sum     *float64        `db:"sum"`
+	Count   *int64          `db:"count"`
+}
+
+func newRow(m metric.Metric) row {
+	r := row{
+		ID:      m.ID,
+		MType:   m.MType,
+		Labels:  m.Labels,
+		Delta:   m.Delta,
+		Value:   m.Value,
+		Buckets: m.Buckets,
+		Sum:     m.Sum,
+	}
+
+	if m.Counts != nil {
+		r.Counts = make(pq.Int64Array, len(m.Counts))
+		for i, c := range m.Counts {
+			r.Counts[i] = int64(c)
+		}
+	}
+
+	if m.Count != nil {
+		count := int64(*m.Count)
+		r.Count = &count
+	}
+
+	return r
+}
+
+func (r row) args() []any {
+	key := metric.SeriesKey(r.ID, r.Labels)
+	return []any{key, r.ID, r.MType, r.Labels, r.Delta, r.Value, r.Buckets, r.Counts, r.Sum, r.Count}
+}
+
+func (r row) metric() metric.Metric {
+	m := metric.Metric{
+		ID:     r.ID,
+		MType:  r.MType,
+		Labels: r.Labels,
+		Delta:  r.Delta,
+		Value:  r.Value,
+		Sum:    r.Sum,
+	}
+
+	if r.Buckets != nil {
+		m.Buckets = []float64(r.Buckets)
+	}
+
+	if r.Counts != nil {
+		m.Counts = make([]uint64, len(r.Counts))
+		for i, c := range r.Counts {
+			m.Counts[i] = uint64(c)
+		}
+	}
+
+	if r.Count != nil {
+		count := uint64(*r.Count)
+		m.Count = &count
+	}
+
+	return m
+}
+
 // Storage - implementation of Repository interface
 type Storage struct {
 	db *sqlx.DB
@@ -66,52 +219,63 @@ func NewFrom(ctx context.Context, src io.Reader, DSN string) (*Storage, error) {
 		return nil, errors.Wrap(errInit, "init db")
 	}
 
+	if err := restore(ctx, db, src); err != nil {
+		return nil, err
+	}
+
+	return &Storage{db: db}, nil
+}
+
+// restore replaces metrics with the ones read from src
+func restore(ctx context.Context, db *sqlx.DB, src io.Reader) error {
 	if errClear := clearDatabase(ctx, db); errClear != nil {
-		return nil, errors.Wrap(errClear, "clear db")
+		return errors.Wrap(errClear, "clear db")
 	}
 
 	var list []metric.Metric
 	if errDec := json.NewDecoder(src).Decode(&list); errDec != nil {
-		return nil, errDec
+		return errDec
 	}
 
 	tx, err := db.Begin()
 	if err != nil {
-		return nil, errors.Wrap(err, "begin transaction")
+		return errors.Wrap(err, "begin transaction")
 	}
+	defer tx.Rollback()
 
-	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("metric", "id", "mtype", "delta", "value"))
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("metric",
+		"key", "id", "mtype", "labels", "delta", "value", "buckets", "counts", "sum", "count"))
 	if err != nil {
-		return nil, errors.Wrap(err, "prepare")
+		return errors.Wrap(err, "prepare")
 	}
 
 	for _, m := range list {
-		_, err = stmt.ExecContext(ctx, m.ID, m.MType, m.Delta, m.Value)
+		_, err = stmt.ExecContext(ctx, newRow(m).args()...)
 		if err != nil {
-			return nil, errors.Wrap(err, "exec item")
+			return errors.Wrap(err, "exec item")
 		}
 	}
 
 	_, err = stmt.ExecContext(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, "exec all")
+		return errors.Wrap(err, "exec all")
 	}
 
 	err = stmt.Close()
 	if err != nil {
-		return nil, errors.Wrap(err, "close")
+		return errors.Wrap(err, "close")
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		return nil, errors.Wrap(err, "commit")
+		return errors.Wrap(err, "commit")
 	}
 
-	return &Storage{db: db}, nil
+	return nil
 }
 
 func clearDatabase(ctx context.Context, db *sqlx.DB) error {
-	_, err := db.ExecContext(ctx, `truncate table "metric";`)
+	_, err := db.ExecContext(ctx, `truncate table "metric", "metric_sample";`)
 	if err != nil {
 		return err
 	}
@@ -122,13 +286,48 @@ func clearDatabase(ctx context.Context, db *sqlx.DB) error {
 func initDatabaseStructure(ctx context.Context, db *sqlx.DB) error {
 	query := `
 	CREATE TABLE IF NOT EXISTS "metric" (
+	  key TEXT NOT NULL,
 	  id TEXT NOT NULL,
 	  mtype TEXT NOT NULL,
+	  labels JSONB NOT NULL DEFAULT '{}',
 	  delta BIGINT,
 	  value DOUBLE PRECISION,
-
-		CONSTRAINT "id_pkey" PRIMARY KEY ("id")
-	);`
+	  buckets DOUBLE PRECISION[],
+	  counts BIGINT[],
+	  sum DOUBLE PRECISION,
+	  count BIGINT,
+
+		CONSTRAINT "series_pkey" PRIMARY KEY ("key")
+	);
+
+	ALTER TABLE "metric"
+	  ADD COLUMN IF NOT EXISTS key TEXT,
+	  ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}',
+	  ADD COLUMN IF NOT EXISTS buckets DOUBLE PRECISION[],
+	  ADD COLUMN IF NOT EXISTS counts BIGINT[],
+	  ADD COLUMN IF NOT EXISTS sum DOUBLE PRECISION,
+	  ADD COLUMN IF NOT EXISTS count BIGINT;
+
+	CREATE TABLE IF NOT EXISTS "metric_sample" (
+	  key TEXT NOT NULL,
+	  ts TIMESTAMPTZ NOT NULL DEFAULT now(),
+	  delta BIGINT,
+	  value DOUBLE PRECISION
+	);
+
+	CREATE INDEX IF NOT EXISTS "metric_sample_key_ts_idx" ON "metric_sample" (key, ts);
+	CREATE INDEX IF NOT EXISTS "metric_sample_ts_idx" ON "metric_sample" (ts);
+
+	UPDATE "metric" SET key = id WHERE key IS NULL;
+
+	DO $$
+	BEGIN
+	  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'series_pkey') THEN
+	    ALTER TABLE "metric" DROP CONSTRAINT IF EXISTS "id_pkey";
+	    ALTER TABLE "metric" ALTER COLUMN key SET NOT NULL;
+	    ALTER TABLE "metric" ADD CONSTRAINT "series_pkey" PRIMARY KEY ("key");
+	  END IF;
+	END $$;`
 	_, err := db.ExecContext(ctx, query)
 	if err != nil {
 		return err
@@ -147,30 +346,39 @@ func (s *Storage) Set(ctx context.Context, value metric.Metric) error {
 		return storage.ErrMetricMalformed
 	}
 
-	if _, err := s.db.ExecContext(ctx, insertQuery, value.ID, value.MType, value.Delta, value.Value); err != nil {
+	if value.MType == metric.Histogram && (value.Sum == nil || value.Count == nil) {
+		return storage.ErrMetricMalformed
+	}
+
+	if _, err := s.db.ExecContext(ctx, insertQuery, newRow(value).args()...); err != nil {
 		return errors.Wrap(err, "insert metric")
 	}
 
 	return nil
 }
 
-// Get - get metric
+// Get - get metric by series key
 func (s *Storage) Get(ctx context.Context, key string) (metric.Metric, bool) {
-	var res metric.Metric
-	err := s.db.GetContext(ctx, &res, `SELECT id, mtype, delta, value FROM metric WHERE id = $1;`, key)
+	var res row
+	err := s.db.GetContext(ctx, &res, `SELECT `+selectColumns+` FROM metric WHERE key = $1;`, key)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		logger.Log.Error("get metric", zap.Error(err))
 	}
 
-	return res, err == nil
+	return res.metric(), err == nil
 }
 
 // List - get all metrics
 func (s *Storage) List(ctx context.Context) ([]metric.Metric, error) {
-	var res []metric.Metric
-	err := s.db.SelectContext(ctx, &res, `SELECT id, mtype, delta, value FROM metric;`)
+	var rows []row
+	err := s.db.SelectContext(ctx, &rows, `SELECT `+selectColumns+` FROM metric;`)
 	if err != nil {
-		return res, errors.Wrap(err, "select metric")
+		return nil, errors.Wrap(err, "select metric")
+	}
+
+	var res []metric.Metric
+	for _, r := range rows {
+		res = append(res, r.metric())
 	}
 
 	return res, nil
@@ -190,6 +398,105 @@ func (s *Storage) Persist(ctx context.Context, dest io.Writer) error {
 	return nil
 }
 
+// History - get samples of the series in time range
+func (s *Storage) History(ctx context.Context, key string, from, to time.Time) ([]metric.Sample, error) {
+	var res []metric.Sample
+	if err := s.db.SelectContext(ctx, &res, historyQuery, key, from, to); err != nil {
+		return nil, errors.Wrap(err, "select samples")
+	}
+
+	return res, nil
+}
+
+// Aggregate - get samples of the series in time range aggregated by step
+func (s *Storage) Aggregate(ctx context.Context, key string, from, to time.Time, step time.Duration, agg string) ([]metric.Sample, error) {
+	expr, ok := aggregates[agg]
+	if !ok {
+		return nil, metric.ErrBadAggregate
+	}
+
+	query := fmt.Sprintf(aggregateQuery, expr[0], expr[1])
+
+	var res []metric.Sample
+	if err := s.db.SelectContext(ctx, &res, query, key, from, to, step.Seconds()); err != nil {
+		return nil, errors.Wrap(err, "aggregate samples")
+	}
+
+	return res, nil
+}
+
+// Prune - delete samples older than before
+func (s *Storage) Prune(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM metric_sample WHERE ts < $1;`, before)
+	if err != nil {
+		return 0, errors.Wrap(err, "delete samples")
+	}
+
+	return res.RowsAffected()
+}
+
+// RunPruner - periodically delete samples older than retention
+func (s *Storage) RunPruner(ctx context.Context, runner *errgroup.Group, retention time.Duration) {
+	runner.Go(func() error {
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(pruneInterval):
+				n, err := s.Prune(ctx, time.Now().Add(-retention))
+				if err != nil {
+					logger.Log.Error("prune samples", zap.Error(err))
+					continue
+				}
+				logger.Log.Debug("samples pruned", zap.Int64("count", n))
+			}
+		}
+	})
+}
+
+// Delete - remove series and its samples
+func (s *Storage) Delete(ctx context.Context, key string) error {
+	var n int64
+	if err := s.db.GetContext(ctx, &n, fmt.Sprintf(deleteQuery, `key = $1`), key); err != nil {
+		return errors.Wrap(err, "delete metric")
+	}
+
+	if n == 0 {
+		return metric.ErrMetricNotFound
+	}
+
+	return nil
+}
+
+// DeletePrefix - remove all series which names start with prefix
+func (s *Storage) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	var n int64
+	if err := s.db.GetContext(ctx, &n, fmt.Sprintf(deleteQuery, `starts_with(id, $1)`), prefix); err != nil {
+		return 0, errors.Wrap(err, "delete metrics")
+	}
+
+	return n, nil
+}
+
+// Reset - zero counter or histogram observations
+func (s *Storage) Reset(ctx context.Context, key string) error {
+	res, err := s.db.ExecContext(ctx, resetQuery, key)
+	if err != nil {
+		return errors.Wrap(err, "reset metric")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "reset metric")
+	}
+
+	if n == 0 {
+		return metric.ErrMetricNotFound
+	}
+
+	return nil
+}
+
 func (s *Storage) Ping(ctx context.Context) error {
 	return s.db.PingContext(ctx)
 }
@@ -209,7 +516,7 @@ func (s *Storage) Update(ctx context.Context, m []metric.Metric) error {
 	defer stmt.Close()
 
 	for _, v := range m {
-		_, err := stmt.ExecContext(ctx, v.ID, v.MType, v.Delta, v.Value)
+		_, err := stmt.ExecContext(ctx, newRow(v).args()...)
 		if err != nil {
 			return errors.Wrap(err, "exec item")
 		}
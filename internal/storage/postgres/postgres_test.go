@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
@@ -53,11 +54,13 @@ func TestPostgres_Set(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			if tt.wantErr {
 				mock.ExpectExec(`INSERT INTO metric`).
-					WithArgs(tt.value.ID, tt.value.MType, tt.value.Delta, tt.value.Value).
+					WithArgs(tt.value.Key(), tt.value.ID, tt.value.MType, sqlmock.AnyArg(), tt.value.Delta, tt.value.Value,
+						sqlmock.AnyArg(), sqlmock.AnyArg(), tt.value.Sum, sqlmock.AnyArg()).
 					WillReturnError(storage.ErrMetricMalformed)
 			} else {
 				mock.ExpectExec(`INSERT INTO metric`).
-					WithArgs(tt.value.ID, tt.value.MType, tt.value.Delta, tt.value.Value).
+					WithArgs(tt.value.Key(), tt.value.ID, tt.value.MType, sqlmock.AnyArg(), tt.value.Delta, tt.value.Value,
+						sqlmock.AnyArg(), sqlmock.AnyArg(), tt.value.Sum, sqlmock.AnyArg()).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 			}
 
@@ -96,9 +99,9 @@ func TestPostgres_Get(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			rows := sqlmock.NewRows([]string{"id", "mtype", "delta", "value"}).
-				AddRow(tt.want.ID, tt.want.MType, tt.want.Delta, tt.want.Value)
-			mock.ExpectQuery(`SELECT id, mtype, delta, value FROM metric`).
+			rows := sqlmock.NewRows([]string{"id", "mtype", "labels", "delta", "value", "buckets", "counts", "sum", "count"}).
+				AddRow(tt.want.ID, tt.want.MType, "{}", tt.want.Delta, tt.want.Value, nil, nil, nil, nil)
+			mock.ExpectQuery(`SELECT id, mtype, labels, delta, value, buckets, counts, sum, count FROM metric`).
 				WithArgs(tt.want.ID).
 				WillReturnRows(rows)
 
@@ -109,6 +112,170 @@ func TestPostgres_Get(t *testing.T) {
 	}
 }
 
+func TestPostgres_GetHistogram(t *testing.T) {
+	want := metric.Metric{ID: "h", MType: metric.Histogram, Buckets: []float64{0.5, 1},
+		Counts: []uint64{1, 2, 0}, Sum: ptr(1.5), Count: ptr[uint64](3)}
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	st := &Storage{
+		sqlx.NewDb(db, "sqlmock"),
+	}
+
+	rows := sqlmock.NewRows([]string{"id", "mtype", "labels", "delta", "value", "buckets", "counts", "sum", "count"}).
+		AddRow(want.ID, want.MType, "{}", nil, nil, "{0.5,1}", "{1,2,0}", 1.5, 3)
+	mock.ExpectQuery(`SELECT id, mtype, labels, delta, value, buckets, counts, sum, count FROM metric`).
+		WithArgs(want.ID).
+		WillReturnRows(rows)
+
+	res, ok := st.Get(context.Background(), want.ID)
+	assert.True(t, ok)
+	assert.Equal(t, want, res)
+}
+
+func TestPostgres_GetLabels(t *testing.T) {
+	want := metric.Metric{ID: "cpu", MType: metric.Gauge, Value: ptr(0.5),
+		Labels: metric.Labels{"host": "db1", "env": "prod"}}
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	st := &Storage{
+		sqlx.NewDb(db, "sqlmock"),
+	}
+
+	rows := sqlmock.NewRows([]string{"id", "mtype", "labels", "delta", "value", "buckets", "counts", "sum", "count"}).
+		AddRow(want.ID, want.MType, `{"env":"prod","host":"db1"}`, nil, 0.5, nil, nil, nil, nil)
+	mock.ExpectQuery(`SELECT id, mtype, labels, delta, value, buckets, counts, sum, count FROM metric WHERE key`).
+		WithArgs(`cpu{env="prod",host="db1"}`).
+		WillReturnRows(rows)
+
+	res, ok := st.Get(context.Background(), want.Key())
+	assert.True(t, ok)
+	assert.Equal(t, want, res)
+}
+
+func TestPostgres_History(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	st := &Storage{
+		sqlx.NewDb(db, "sqlmock"),
+	}
+
+	from, to := time.Unix(1700000000, 0), time.Unix(1700003600, 0)
+	want := []metric.Sample{
+		{Timestamp: from, Value: ptr(1.0)},
+		{Timestamp: to, Value: ptr(2.0)},
+	}
+
+	rows := sqlmock.NewRows([]string{"ts", "delta", "value"}).
+		AddRow(from, nil, 1.0).
+		AddRow(to, nil, 2.0)
+	mock.ExpectQuery(`SELECT ts, delta, value FROM metric_sample`).
+		WithArgs("one", from, to).
+		WillReturnRows(rows)
+
+	res, err := st.History(context.Background(), "one", from, to)
+	assert.NoError(t, err)
+	assert.Equal(t, want, res)
+}
+
+func TestPostgres_Aggregate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	st := &Storage{
+		sqlx.NewDb(db, "sqlmock"),
+	}
+
+	from, to := time.Unix(1700000000, 0), time.Unix(1700003600, 0)
+
+	rows := sqlmock.NewRows([]string{"ts", "delta", "value"}).
+		AddRow(from, nil, 1.5)
+	mock.ExpectQuery(`avg\(value\) AS value`).
+		WithArgs("one", from, to, 60.0).
+		WillReturnRows(rows)
+
+	res, err := st.Aggregate(context.Background(), "one", from, to, time.Minute, metric.AggAvg)
+	assert.NoError(t, err)
+	assert.Equal(t, []metric.Sample{{Timestamp: from, Value: ptr(1.5)}}, res)
+
+	_, err = st.Aggregate(context.Background(), "one", from, to, time.Minute, "median")
+	assert.Equal(t, metric.ErrBadAggregate, err)
+}
+
+func TestPostgres_Prune(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	st := &Storage{
+		sqlx.NewDb(db, "sqlmock"),
+	}
+
+	before := time.Unix(1700000000, 0)
+	mock.ExpectExec(`DELETE FROM metric_sample`).
+		WithArgs(before).
+		WillReturnResult(sqlmock.NewResult(0, 5))
+
+	n, err := st.Prune(context.Background(), before)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+}
+
+func TestPostgres_Delete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	st := &Storage{
+		sqlx.NewDb(db, "sqlmock"),
+	}
+
+	mock.ExpectQuery(`DELETE FROM metric WHERE key = \$1`).
+		WithArgs("PollCount").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`DELETE FROM metric WHERE key = \$1`).
+		WithArgs("unknown").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`DELETE FROM metric WHERE starts_with\(id, \$1\)`).
+		WithArgs("Heap").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(6))
+
+	assert.NoError(t, st.Delete(context.Background(), "PollCount"))
+	assert.Equal(t, metric.ErrMetricNotFound, st.Delete(context.Background(), "unknown"))
+
+	n, err := st.DeletePrefix(context.Background(), "Heap")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), n)
+}
+
+func TestPostgres_Reset(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	st := &Storage{
+		sqlx.NewDb(db, "sqlmock"),
+	}
+
+	mock.ExpectExec(`UPDATE metric SET`).
+		WithArgs("PollCount").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE metric SET`).
+		WithArgs("Alloc").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, st.Reset(context.Background(), "PollCount"))
+	assert.Equal(t, metric.ErrMetricNotFound, st.Reset(context.Background(), "Alloc"))
+}
+
 func TestPostgres_List(t *testing.T) {
 	tests := []struct {
 		name string
@@ -134,11 +301,11 @@ func TestPostgres_List(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			rows := sqlmock.NewRows([]string{"id", "mtype", "delta", "value"})
+			rows := sqlmock.NewRows([]string{"id", "mtype", "labels", "delta", "value", "buckets", "counts", "sum", "count"})
 			for _, v := range tt.want {
-				rows.AddRow(v.ID, v.MType, v.Delta, v.Value)
+				rows.AddRow(v.ID, v.MType, "{}", v.Delta, v.Value, nil, nil, nil, nil)
 			}
-			mock.ExpectQuery(`SELECT id, mtype, delta, value FROM metric`).
+			mock.ExpectQuery(`SELECT id, mtype, labels, delta, value, buckets, counts, sum, count FROM metric`).
 				WillReturnRows(rows)
 
 			res, err := st.List(context.Background())
@@ -207,7 +374,7 @@ func TestPostgres_clearDatabase(t *testing.T) {
 	assert.NoError(t, err)
 	defer db.Close()
 
-	mock.ExpectExec(`truncate table "metric"`).
+	mock.ExpectExec(`truncate table "metric", "metric_sample"`).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	clearDatabase(context.Background(), sqlx.NewDb(db, "sqlmock"))
@@ -238,11 +405,11 @@ func TestPostgres_Persist(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			rows := sqlmock.NewRows([]string{"id", "mtype", "delta", "value"})
+			rows := sqlmock.NewRows([]string{"id", "mtype", "labels", "delta", "value", "buckets", "counts", "sum", "count"})
 			for _, v := range tt.want {
-				rows.AddRow(v.ID, v.MType, v.Delta, v.Value)
+				rows.AddRow(v.ID, v.MType, "{}", v.Delta, v.Value, nil, nil, nil, nil)
 			}
-			mock.ExpectQuery(`SELECT id, mtype, delta, value FROM metric`).
+			mock.ExpectQuery(`SELECT id, mtype, labels, delta, value, buckets, counts, sum, count FROM metric`).
 				WillReturnRows(rows)
 
 			buf := new(bytes.Buffer)
@@ -251,3 +418,33 @@ func TestPostgres_Persist(t *testing.T) {
 		})
 	}
 }
+
+func TestPostgres_restore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	src := bytes.NewBufferString(`[
+		{"id":"cpu","type":"gauge","value":1.5,"labels":{"host":"a"}},
+		{"id":"PollCount","type":"counter","delta":3}
+	]`)
+
+	mock.ExpectExec(`truncate table "metric", "metric_sample"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	stmt := mock.ExpectPrepare(`COPY "metric"`)
+	// метки передаются строкой JSON, а не bytea
+	stmt.ExpectExec().
+		WithArgs(`cpu{host="a"}`, "cpu", metric.Gauge, `{"host":"a"}`,
+			nil, 1.5, nil, nil, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	stmt.ExpectExec().
+		WithArgs("PollCount", "PollCount", metric.Counter, "{}",
+			int64(3), nil, nil, nil, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	stmt.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	assert.NoError(t, restore(context.Background(), sqlx.NewDb(db, "sqlmock"), src))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
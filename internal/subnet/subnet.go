@@ -4,6 +4,7 @@ import (
 	"context"
 	"net"
 	"net/http"
+	"slices"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -38,30 +39,56 @@ func WithTructedSubnets(subnet string) func(http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-func UnaryServerInterceptor(subnet string) grpc.UnaryServerInterceptor {
+// UnaryServerInterceptor checks client address when present,
+// calls of required methods without address are rejected
+func UnaryServerInterceptor(subnet string, required ...string) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ any, err error) {
-		if subnet != "" {
-			var IP string
-			if md, ok := metadata.FromIncomingContext(ctx); ok {
-				values := md.Get("X-Real-IP")
-				if len(values) > 0 {
-					IP = values[0]
-					realIP := net.ParseIP(IP)
-					if realIP == nil {
-						return nil, status.Errorf(codes.PermissionDenied, "forbidden")
-					}
+		if err := checkIncoming(ctx, subnet, slices.Contains(required, info.FullMethod)); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
 
-					_, ipv4Net, err := net.ParseCIDR(subnet)
-					if err != nil {
-						return nil, status.Errorf(codes.PermissionDenied, "forbidden")
-					}
+// StreamServerInterceptor checks client address once on stream open
+func StreamServerInterceptor(subnet string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkIncoming(ss.Context(), subnet, false); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
 
-					if !ipv4Net.Contains(realIP) {
-						return nil, status.Errorf(codes.PermissionDenied, "forbidden")
-					}
-				}
-			}
+// checkIncoming checks X-Real-IP metadata against subnet,
+// missing address is allowed unless required
+func checkIncoming(ctx context.Context, subnet string, required bool) error {
+	if subnet == "" {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("X-Real-IP")
+	if len(values) == 0 {
+		if required {
+			return status.Errorf(codes.PermissionDenied, "forbidden")
 		}
-		return handler(ctx, req)
+		return nil
 	}
+
+	realIP := net.ParseIP(values[0])
+	if realIP == nil {
+		return status.Errorf(codes.PermissionDenied, "forbidden")
+	}
+
+	_, ipv4Net, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return status.Errorf(codes.PermissionDenied, "forbidden")
+	}
+
+	if !ipv4Net.Contains(realIP) {
+		return status.Errorf(codes.PermissionDenied, "forbidden")
+	}
+
+	return nil
 }
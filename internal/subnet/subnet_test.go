@@ -0,0 +1,40 @@
+package subnet
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	handler := func(ctx context.Context, req any) (any, error) { return req, nil }
+
+	tests := []struct {
+		name   string
+		method string
+		ip     string
+		code   codes.Code
+	}{
+		{name: "no address", method: "/test/Update", code: codes.OK},
+		{name: "no address required", method: "/test/Delete", code: codes.PermissionDenied},
+		{name: "trusted required", method: "/test/Delete", ip: "10.0.0.5", code: codes.OK},
+		{name: "untrusted", method: "/test/Update", ip: "192.168.0.1", code: codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.ip != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("X-Real-IP", tt.ip))
+			}
+
+			interceptor := UnaryServerInterceptor("10.0.0.0/24", "/test/Delete")
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
@@ -24,7 +24,12 @@ const _ = grpc.SupportPackageIsVersion7
 type MetricServiceClient interface {
 	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
 	Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*UpdateResponse, error)
+	StreamUpdate(ctx context.Context, opts ...grpc.CallOption) (MetricService_StreamUpdateClient, error)
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (MetricService_WatchClient, error)
 	Value(ctx context.Context, in *ValueRequest, opts ...grpc.CallOption) (*ValueResponse, error)
+	History(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*HistoryResponse, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	Reset(ctx context.Context, in *ResetRequest, opts ...grpc.CallOption) (*ResetResponse, error)
 }
 
 type metricServiceClient struct {
@@ -53,6 +58,69 @@ func (c *metricServiceClient) Update(ctx context.Context, in *UpdateRequest, opt
 	return out, nil
 }
 
+func (c *metricServiceClient) StreamUpdate(ctx context.Context, opts ...grpc.CallOption) (MetricService_StreamUpdateClient, error) {
+	stream, err := c.cc.NewStream(ctx, &MetricService_ServiceDesc.Streams[0], "/metrics.MetricService/StreamUpdate", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &metricServiceStreamUpdateClient{stream}
+	return x, nil
+}
+
+type MetricService_StreamUpdateClient interface {
+	Send(*StreamUpdateRequest) error
+	Recv() (*StreamUpdateResponse, error)
+	grpc.ClientStream
+}
+
+type metricServiceStreamUpdateClient struct {
+	grpc.ClientStream
+}
+
+func (x *metricServiceStreamUpdateClient) Send(m *StreamUpdateRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *metricServiceStreamUpdateClient) Recv() (*StreamUpdateResponse, error) {
+	m := new(StreamUpdateResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *metricServiceClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (MetricService_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &MetricService_ServiceDesc.Streams[1], "/metrics.MetricService/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &metricServiceWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type MetricService_WatchClient interface {
+	Recv() (*WatchResponse, error)
+	grpc.ClientStream
+}
+
+type metricServiceWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *metricServiceWatchClient) Recv() (*WatchResponse, error) {
+	m := new(WatchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *metricServiceClient) Value(ctx context.Context, in *ValueRequest, opts ...grpc.CallOption) (*ValueResponse, error) {
 	out := new(ValueResponse)
 	err := c.cc.Invoke(ctx, "/metrics.MetricService/Value", in, out, opts...)
@@ -62,13 +130,45 @@ func (c *metricServiceClient) Value(ctx context.Context, in *ValueRequest, opts
 	return out, nil
 }
 
+func (c *metricServiceClient) History(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*HistoryResponse, error) {
+	out := new(HistoryResponse)
+	err := c.cc.Invoke(ctx, "/metrics.MetricService/History", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricServiceClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, "/metrics.MetricService/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricServiceClient) Reset(ctx context.Context, in *ResetRequest, opts ...grpc.CallOption) (*ResetResponse, error) {
+	out := new(ResetResponse)
+	err := c.cc.Invoke(ctx, "/metrics.MetricService/Reset", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MetricServiceServer is the server API for MetricService service.
 // All implementations must embed UnimplementedMetricServiceServer
 // for forward compatibility
 type MetricServiceServer interface {
 	List(context.Context, *ListRequest) (*ListResponse, error)
 	Update(context.Context, *UpdateRequest) (*UpdateResponse, error)
+	StreamUpdate(MetricService_StreamUpdateServer) error
+	Watch(*WatchRequest, MetricService_WatchServer) error
 	Value(context.Context, *ValueRequest) (*ValueResponse, error)
+	History(context.Context, *HistoryRequest) (*HistoryResponse, error)
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	Reset(context.Context, *ResetRequest) (*ResetResponse, error)
 	mustEmbedUnimplementedMetricServiceServer()
 }
 
@@ -82,9 +182,24 @@ func (UnimplementedMetricServiceServer) List(context.Context, *ListRequest) (*Li
 func (UnimplementedMetricServiceServer) Update(context.Context, *UpdateRequest) (*UpdateResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
 }
+func (UnimplementedMetricServiceServer) StreamUpdate(MetricService_StreamUpdateServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamUpdate not implemented")
+}
+func (UnimplementedMetricServiceServer) Watch(*WatchRequest, MetricService_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
 func (UnimplementedMetricServiceServer) Value(context.Context, *ValueRequest) (*ValueResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Value not implemented")
 }
+func (UnimplementedMetricServiceServer) History(context.Context, *HistoryRequest) (*HistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method History not implemented")
+}
+func (UnimplementedMetricServiceServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedMetricServiceServer) Reset(context.Context, *ResetRequest) (*ResetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Reset not implemented")
+}
 func (UnimplementedMetricServiceServer) mustEmbedUnimplementedMetricServiceServer() {}
 
 // UnsafeMetricServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -134,6 +249,53 @@ func _MetricService_Update_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _MetricService_StreamUpdate_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MetricServiceServer).StreamUpdate(&metricServiceStreamUpdateServer{stream})
+}
+
+type MetricService_StreamUpdateServer interface {
+	Send(*StreamUpdateResponse) error
+	Recv() (*StreamUpdateRequest, error)
+	grpc.ServerStream
+}
+
+type metricServiceStreamUpdateServer struct {
+	grpc.ServerStream
+}
+
+func (x *metricServiceStreamUpdateServer) Send(m *StreamUpdateResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *metricServiceStreamUpdateServer) Recv() (*StreamUpdateRequest, error) {
+	m := new(StreamUpdateRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _MetricService_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MetricServiceServer).Watch(m, &metricServiceWatchServer{stream})
+}
+
+type MetricService_WatchServer interface {
+	Send(*WatchResponse) error
+	grpc.ServerStream
+}
+
+type metricServiceWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *metricServiceWatchServer) Send(m *WatchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _MetricService_Value_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ValueRequest)
 	if err := dec(in); err != nil {
@@ -152,6 +314,60 @@ func _MetricService_Value_Handler(srv interface{}, ctx context.Context, dec func
 	return interceptor(ctx, in, info, handler)
 }
 
+func _MetricService_History_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricServiceServer).History(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/metrics.MetricService/History",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricServiceServer).History(ctx, req.(*HistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/metrics.MetricService/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricServiceServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricService_Reset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricServiceServer).Reset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/metrics.MetricService/Reset",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricServiceServer).Reset(ctx, req.(*ResetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // MetricService_ServiceDesc is the grpc.ServiceDesc for MetricService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -171,7 +387,31 @@ var MetricService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Value",
 			Handler:    _MetricService_Value_Handler,
 		},
+		{
+			MethodName: "History",
+			Handler:    _MetricService_History_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _MetricService_Delete_Handler,
+		},
+		{
+			MethodName: "Reset",
+			Handler:    _MetricService_Reset_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamUpdate",
+			Handler:       _MetricService_StreamUpdate_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Watch",
+			Handler:       _MetricService_Watch_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "metrics/metrics.proto",
 }
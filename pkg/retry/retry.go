@@ -11,6 +11,7 @@
 package retry
 
 import (
+	"errors"
 	"time"
 )
 
@@ -21,12 +22,39 @@ var (
 // Func represents functions that can be retried.
 type Func func() (err error)
 
-// Do keeps trying the function
+// PermanentError is an error which is not retried
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent marks err as not worth retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &PermanentError{Err: err}
+}
+
+// Do keeps trying the function until it succeeds or returns permanent error
 func Do(fn Func) (err error) {
 	for _, delay := range delays {
 		if err = fn(); err == nil {
 			break
 		}
+
+		var permanent *PermanentError
+		if errors.As(err, &permanent) {
+			break
+		}
 		time.Sleep(delay)
 	}
 